@@ -0,0 +1,113 @@
+package bqwrapper
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Check the load's post-load action can be done on its source, before
+// loading anything.
+func checkAfterLoad(conf LoadConfig) error {
+	switch conf.AfterLoad {
+	case "":
+		return nil
+	case AfterLoadDelete, AfterLoadGzip:
+	case AfterLoadMove:
+		if conf.ArchiveDir == "" {
+			return errors.New("missing ArchiveDir")
+		}
+	default:
+		return fmt.Errorf("Unsupported AfterLoad %s", conf.AfterLoad)
+	}
+	u, err := parseLocation(conf.SourceFile, "stdin")
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "file" {
+		return errors.New("AfterLoad needs a local SourceFile")
+	}
+	return nil
+}
+
+// Delete, move or compress the source of a successful load as set by
+// conf.AfterLoad.
+func afterLoad(conf LoadConfig) error {
+	u, err := parseLocation(conf.SourceFile, "stdin")
+	if err != nil {
+		return err
+	}
+	switch conf.AfterLoad {
+	case AfterLoadDelete:
+		err = os.Remove(u.Path)
+	case AfterLoadMove:
+		err = moveFile(u.Path, filepath.Join(conf.ArchiveDir, filepath.Base(u.Path)))
+	case AfterLoadGzip:
+		err = gzipFile(u.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("Error archiving source - %s", err)
+	}
+	return nil
+}
+
+// Move a file, copying it if it can't be renamed, e.g. to another file
+// system.
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyFile(src, dst, nil); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Compress a file to name.gz, removing the original once it's complete.
+func gzipFile(name string) error {
+	if err := copyFile(name, name+".gz", func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// Copy a file through wrap if it's not nil. The copy is written to dst.tmp
+// and renamed when it's complete.
+func copyFile(src, dst string, wrap func(io.Writer) io.WriteCloser) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	var w io.WriteCloser = out
+	if wrap != nil {
+		w = wrap(out)
+	}
+	if _, err = io.Copy(w, in); err == nil && wrap != nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(dst+".tmp", dst)
+	}
+	if err != nil {
+		os.Remove(dst + ".tmp")
+	}
+	return err
+}
@@ -0,0 +1,218 @@
+package bqwrapper
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"google.golang.org/api/bigquery/v2"
+	"strconv"
+	"time"
+)
+
+// Writes dump output as an Arrow IPC file (Feather v2), one record batch per
+// page of rows.
+// Columns are in schema order and typed: INTEGER, FLOAT, BOOLEAN, TIMESTAMP
+// (microseconds, UTC), DATE and BYTES map to their Arrow types, and other
+// values, including NUMERIC, are kept as strings. RECORD and REPEATED
+// fields are written as json strings.
+type arrowWriter struct {
+	rowTracker
+	c    *Client
+	conf DumpConfig
+
+	fields []*bigquery.TableFieldSchema
+	mem    memory.Allocator
+	schema *arrow.Schema
+	out    SinkWriter
+	w      *ipc.FileWriter
+
+	// Rows written.
+	total uint64
+}
+
+func newArrowWriter(c *Client, conf DumpConfig) *arrowWriter {
+	var w = &arrowWriter{c: c, conf: conf, mem: memory.NewGoAllocator()}
+	w.skip = conf.SkipBadRows
+	return w
+}
+
+// Write a page of rows as a record batch.
+func (w *arrowWriter) page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+	if w.w == nil {
+		if err := w.open(fields); err != nil {
+			return err
+		}
+	}
+
+	// Each row is converted as a whole first, so a bad one can be skipped.
+	var b = array.NewRecordBuilder(w.mem, w.schema)
+	defer b.Release()
+	var values = make([]interface{}, len(w.fields))
+	var err error
+	for n, row := range rows {
+		for i, field := range w.fields {
+			values[i] = nil
+			if i < len(row.F) {
+				if values[i], err = arrowValue(field, row.F[i].V); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			if err = w.badRow(row, n, err); err != nil {
+				return err
+			}
+			continue
+		}
+		for i, val := range values {
+			appendArrow(b.Field(i), val)
+		}
+		w.total++
+	}
+	w.pageDone(len(rows))
+
+	var rec = b.NewRecord()
+	defer rec.Release()
+	if err = w.w.Write(rec); err != nil {
+		return fmt.Errorf("Error writing output - %s", err)
+	}
+	return nil
+}
+
+// Create the output with the schema of the fields.
+func (w *arrowWriter) open(fields []*bigquery.TableFieldSchema) error {
+	w.fields = fields
+	var af = make([]arrow.Field, len(fields))
+	for i, field := range fields {
+		af[i] = arrow.Field{Name: field.Name, Type: arrowType(field), Nullable: true}
+	}
+	w.schema = arrow.NewSchema(af, nil)
+
+	var err error
+	if w.out, err = w.c.createOutput(w.conf.Output, w.conf); err != nil {
+		return fmt.Errorf("Error creating output - %s", err)
+	}
+	if w.w, err = ipc.NewFileWriter(w.out, ipc.WithSchema(w.schema), ipc.WithAllocator(w.mem)); err != nil {
+		w.out.Abort()
+		w.out = nil
+		return fmt.Errorf("Error creating output - %s", err)
+	}
+	return nil
+}
+
+// Write the footer and commit the output.
+func (w *arrowWriter) close() error {
+	if w.w == nil {
+		return nil
+	}
+	if err := w.w.Close(); err != nil {
+		w.out.Abort()
+		return fmt.Errorf("Error writing output - %s", err)
+	}
+	return w.out.Commit()
+}
+
+// Number of rows written.
+func (w *arrowWriter) count() uint64 {
+	return w.total
+}
+
+// Give up on the output.
+func (w *arrowWriter) abort() {
+	if w.out != nil {
+		w.out.Abort()
+	}
+}
+
+// Arrow type of a column.
+func arrowType(field *bigquery.TableFieldSchema) arrow.DataType {
+	if field.Mode == "REPEATED" {
+		return arrow.BinaryTypes.String
+	}
+	switch field.Type {
+	case "INTEGER", "INT64":
+		return arrow.PrimitiveTypes.Int64
+	case "FLOAT", "FLOAT64":
+		return arrow.PrimitiveTypes.Float64
+	case "BOOLEAN", "BOOL":
+		return arrow.FixedWidthTypes.Boolean
+	case "TIMESTAMP":
+		return arrow.FixedWidthTypes.Timestamp_us
+	case "DATE":
+		return arrow.PrimitiveTypes.Date32
+	case "BYTES":
+		return arrow.BinaryTypes.Binary
+	}
+	return arrow.BinaryTypes.String
+}
+
+// Value of a cell as the type of arrowType(field), nil if it's null.
+func arrowValue(field *bigquery.TableFieldSchema, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	s, ok := v.(string)
+	if !ok || field.Mode == "REPEATED" {
+		// Nested values.
+		by, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value - %s", field.Name, err)
+		}
+		return string(by), nil
+	}
+
+	var val interface{}
+	var err error
+	switch arrowType(field) {
+	case arrow.PrimitiveTypes.Int64:
+		val, err = strconv.ParseInt(s, 10, 64)
+	case arrow.PrimitiveTypes.Float64:
+		val, err = strconv.ParseFloat(s, 64)
+	case arrow.FixedWidthTypes.Boolean:
+		val, err = strconv.ParseBool(s)
+	case arrow.FixedWidthTypes.Timestamp_us:
+		var t time.Time
+		if t, err = parseTimestamp(s); err == nil {
+			val = arrow.Timestamp(t.UnixNano() / 1e3)
+		}
+	case arrow.PrimitiveTypes.Date32:
+		var t time.Time
+		if t, err = time.Parse("2006-01-02", s); err == nil {
+			val = arrow.Date32FromTime(t)
+		}
+	case arrow.BinaryTypes.Binary:
+		val, err = base64.StdEncoding.DecodeString(s)
+	default:
+		val = s
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s value (%s) - %s", field.Name, s, err)
+	}
+	return val, nil
+}
+
+// Append a value from arrowValue to its column builder.
+func appendArrow(b array.Builder, val interface{}) {
+	switch v := val.(type) {
+	case nil:
+		b.AppendNull()
+	case int64:
+		b.(*array.Int64Builder).Append(v)
+	case float64:
+		b.(*array.Float64Builder).Append(v)
+	case bool:
+		b.(*array.BooleanBuilder).Append(v)
+	case arrow.Timestamp:
+		b.(*array.TimestampBuilder).Append(v)
+	case arrow.Date32:
+		b.(*array.Date32Builder).Append(v)
+	case []byte:
+		b.(*array.BinaryBuilder).Append(v)
+	case string:
+		b.(*array.StringBuilder).Append(v)
+	}
+}
@@ -0,0 +1,156 @@
+package bqwrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"net/http"
+	"os"
+)
+
+// Create an audit sink appending records to the file as json lines.
+func NewFileAuditSink(path string) *FileAuditSink {
+	return &FileAuditSink{Path: path}
+}
+
+// Append the record to the file.
+func (s *FileAuditSink) Record(r AuditRecord) error {
+	by, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	by = append(by, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(by); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Post the record to the URL as json.
+func (s *WebhookAuditSink) Record(r AuditRecord) error {
+	by, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	var client = s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Post(s.URL, "application/json", bytes.NewReader(by))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("Did not get OK, got %s", res.Status)
+	}
+	return nil
+}
+
+// Record the finished job to the client's audit sink and journal, if it has
+// them, and count what it was billed against the client's guardrails.
+// Failing to record doesn't fail the operation.
+func (c *Client) auditJob(job *bigquery.Job) {
+	if job == nil {
+		return
+	}
+	c.countBilled(job)
+	c.journalJob(job)
+	if c.Audit == nil {
+		return
+	}
+
+	var r = AuditRecord{User: job.UserEmail}
+	if job.JobReference != nil {
+		r.JobID = job.JobReference.JobId
+	}
+	if conf := job.Configuration; conf != nil {
+		r.Type, r.Target = jobType(conf), jobTarget(conf)
+	}
+	if st := job.Statistics; st != nil {
+		r.Bytes = st.TotalBytesProcessed
+		if st.Load != nil {
+			r.Bytes = st.Load.InputFileBytes
+		}
+		r.Started = msTime(st.StartTime)
+		r.Finished = msTime(st.EndTime)
+		if !r.Started.IsZero() && !r.Finished.IsZero() {
+			r.Duration = r.Finished.Sub(r.Started)
+		}
+	}
+	r.Outcome = "SUCCESS"
+	if job.Status != nil && job.Status.ErrorResult != nil {
+		r.Outcome = "FAILURE"
+		r.Error = job.Status.ErrorResult.Message
+	}
+
+	c.Audit.Record(r)
+}
+
+// Record the finished job in the location to the client's audit sink,
+// looking it up first. If that fails, its journal entry is still closed,
+// as failed with the first of errs if there are any.
+func (c *Client) auditJobID(location, jid string, errs []*bigquery.ErrorProto) {
+	if c.Audit == nil && c.Journal == nil && c.Guardrails.MaxBytesBilledPerDay <= 0 || jid == "" {
+		return
+	}
+	job, err := c.bq.Jobs.Get(c.ProjectID, jid).Location(location).Do()
+	if err != nil {
+		var status = &bigquery.JobStatus{State: "DONE"}
+		if len(errs) != 0 {
+			status.ErrorResult = errs[0]
+		}
+		c.journalJob(&bigquery.Job{
+			JobReference: &bigquery.JobReference{ProjectId: c.ProjectID, JobId: jid, Location: location},
+			Status:       status,
+		})
+		return
+	}
+	c.auditJob(job)
+}
+
+// Type of a job: LOAD, QUERY, COPY or EXTRACT.
+func jobType(conf *bigquery.JobConfiguration) string {
+	switch {
+	case conf.JobType != "":
+		return conf.JobType
+	case conf.Load != nil:
+		return "LOAD"
+	case conf.Query != nil:
+		return "QUERY"
+	case conf.Copy != nil:
+		return "COPY"
+	case conf.Extract != nil:
+		return "EXTRACT"
+	}
+	return ""
+}
+
+// Destination table of a job (project.dataset.table), or source table of
+// extracts, "" if it has none.
+func jobTarget(conf *bigquery.JobConfiguration) string {
+	var dest *bigquery.TableReference
+	switch {
+	case conf.Load != nil:
+		dest = conf.Load.DestinationTable
+	case conf.Query != nil:
+		dest = conf.Query.DestinationTable
+	case conf.Copy != nil:
+		dest = conf.Copy.DestinationTable
+	case conf.Extract != nil:
+		dest = conf.Extract.SourceTable
+	}
+	if dest == nil {
+		return ""
+	}
+	return dest.ProjectId + "." + dest.DatasetId + "." + dest.TableId
+}
@@ -0,0 +1,93 @@
+package bqwrapper
+
+import (
+	"context"
+	"google.golang.org/api/bigquery/v2"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Audit sink keeping records in memory.
+type memoryAuditSink struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+func (s *memoryAuditSink) Record(r AuditRecord) error {
+	s.mu.Lock()
+	s.records = append(s.records, r)
+	s.mu.Unlock()
+	return nil
+}
+
+// BigQuery running queries in another region than the client's. Jobs are
+// only found there, unless lost is set.
+func otherRegion(t *testing.T, lost bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var ref = &bigquery.JobReference{ProjectId: "test", JobId: "job", Location: "asia-northeast1"}
+		switch {
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/projects/test/queries"):
+			writeJSON(w, &bigquery.QueryResponse{
+				JobReference: ref,
+				JobComplete:  true,
+				Schema:       &bigquery.TableSchema{Fields: testSchema()},
+				Rows:         testRows(0, 1),
+			})
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/projects/test/jobs/job"):
+			if lost || r.URL.Query().Get("location") != ref.Location {
+				http.NotFound(w, r)
+				return
+			}
+			writeJSON(w, &bigquery.Job{
+				JobReference:  ref,
+				Configuration: &bigquery.JobConfiguration{Query: &bigquery.JobConfigurationQuery{}},
+				Status:        &bigquery.JobStatus{State: "DONE"},
+				Statistics:    &bigquery.JobStatistics{TotalBytesProcessed: 100},
+			})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func TestAuditJobInOtherRegion(t *testing.T) {
+	var c = newTestClient(t, otherRegion(t, false))
+	var sink = &memoryAuditSink{}
+	c.Location = "US"
+	c.Audit = sink
+	c.Journal = NewJobJournal(filepath.Join(t.TempDir(), "journal"))
+	var noop = func([]*bigquery.TableFieldSchema, []*bigquery.TableRow) error { return nil }
+	if _, err := c.runQuery(context.Background(), &bigquery.QueryRequest{Query: "SELECT 1"}, 0, noop); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.records) != 1 || sink.records[0].Bytes != 100 {
+		t.Fatalf("got audit records %+v", sink.records)
+	}
+	entries, err := c.Journal.List(JournalFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].State != "DONE" || entries[0].Location != "asia-northeast1" {
+		t.Errorf("got journal %+v", entries)
+	}
+}
+
+func TestJournalClosedWithoutJob(t *testing.T) {
+	var c = newTestClient(t, otherRegion(t, true))
+	c.Journal = NewJobJournal(filepath.Join(t.TempDir(), "journal"))
+	var noop = func([]*bigquery.TableFieldSchema, []*bigquery.TableRow) error { return nil }
+	if _, err := c.runQuery(context.Background(), &bigquery.QueryRequest{Query: "SELECT 1"}, 0, noop); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := c.Journal.List(JournalFilter{Incomplete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("jobs left incomplete %+v", entries)
+	}
+}
@@ -0,0 +1,195 @@
+package bqwrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Name of the manifest of a backup.
+const backupManifestName = "backup.json"
+
+// How long a staging table of a restore is kept if it can't be deleted.
+const restoreStagingExpiration = 24 * time.Hour
+
+// Back up every table of the dataset to GCS under location
+// (gs://bucket/prefix): a manifest, and for each table its schema
+// (table/schema.json, in the format Load takes) and data (table/data-*.avro).
+// Views and other tables that aren't plain tables are skipped.
+func (c *Client) BackupDataset(datasetID, location string) error {
+	if datasetID == "" || location == "" {
+		return errors.New("missing params")
+	}
+	bucket, prefix, err := gcsPrefix(location)
+	if err != nil {
+		return err
+	}
+
+	tables, err := c.listTables(c.ProjectID, datasetID)
+	if err != nil {
+		return err
+	}
+	var manifest = backupManifest{Dataset: datasetID, Created: time.Now().UTC()}
+	for _, t := range tables {
+		if t.Type != "TABLE" || t.TableReference == nil {
+			continue
+		}
+		var tableID = t.TableReference.TableId
+		table, err := c.bq.Tables.Get(c.ProjectID, datasetID, tableID).Do()
+		if err != nil {
+			return fmt.Errorf("Error getting table %s - %s", tableID, err)
+		}
+
+		var entry = backupTable{Table: tableID, Partitioning: toTimePartitioning(table.TimePartitioning)}
+		var fields []TableField
+		if table.Schema != nil {
+			fields = toTableFields(table.Schema.Fields)
+		}
+		if err = c.writeGCSJSON(bucket, prefix+tableID+"/schema.json", fields); err != nil {
+			return fmt.Errorf("Error writing schema of %s - %s", tableID, err)
+		}
+
+		_, err = c.runJob(&bigquery.JobConfiguration{
+			Extract: &bigquery.JobConfigurationExtract{
+				SourceTable:         table.TableReference,
+				DestinationUris:     []string{"gs://" + bucket + "/" + prefix + tableID + "/data-*.avro"},
+				DestinationFormat:   "AVRO",
+				UseAvroLogicalTypes: true,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("Error extracting %s - %s", tableID, err)
+		}
+		manifest.Tables = append(manifest.Tables, entry)
+	}
+
+	// Manifest goes last, so an incomplete backup doesn't have one.
+	if err = c.writeGCSJSON(bucket, prefix+backupManifestName, manifest); err != nil {
+		return fmt.Errorf("Error writing manifest - %s", err)
+	}
+	return nil
+}
+
+// Restore tables backed up by BackupDataset at location into the dataset,
+// which is created if it doesn't exist. It may be another dataset than the
+// one backed up, e.g. to clone it. Tables that already exist are replaced.
+func (c *Client) RestoreDataset(location, datasetID string) error {
+	if datasetID == "" || location == "" {
+		return errors.New("missing params")
+	}
+	bucket, prefix, err := gcsPrefix(location)
+	if err != nil {
+		return err
+	}
+
+	var manifest backupManifest
+	if err = c.readGCSJSON(bucket, prefix+backupManifestName, &manifest); err != nil {
+		return fmt.Errorf("Error reading manifest - %s", err)
+	}
+	if err = c.checkDataset(c.ProjectID, datasetID, true); err != nil {
+		return fmt.Errorf("Error checking/creating dataset - %s", err)
+	}
+
+	for _, entry := range manifest.Tables {
+		var fields []TableField
+		if err = c.readGCSJSON(bucket, prefix+entry.Table+"/schema.json", &fields); err != nil {
+			return fmt.Errorf("Error reading schema of %s - %s", entry.Table, err)
+		}
+
+		var ref = &bigquery.TableReference{ProjectId: c.ProjectID, DatasetId: datasetID, TableId: entry.Table}
+		if err = c.restoreTable(c.Location, ref, fields, entry.Partitioning, "gs://"+bucket+"/"+prefix+entry.Table+"/data-*.avro"); err != nil {
+			return fmt.Errorf("Error restoring %s - %s", entry.Table, err)
+		}
+	}
+	return nil
+}
+
+// Replace the table with one made from the schema and partitioning, since
+// Avro doesn't keep all of it (modes, DATETIME etc.), loading the Avro files
+// of uri with a job in the location.
+// The files are loaded to a staging table next to it first, which is copied
+// over the table, so it's left as it was if the load fails.
+func (c *Client) restoreTable(location string, ref *bigquery.TableReference, fields []TableField, partitioning *TimePartitioning, uri string) error {
+	var staging = *ref
+	staging.TableId = fmt.Sprintf("%s_restore_%d", ref.TableId, time.Now().UnixNano())
+	var err = c.createTable(staging.ProjectId, staging.DatasetId, staging.TableId, fields, partitioning, time.Now().Add(restoreStagingExpiration))
+	if err != nil {
+		return err
+	}
+	defer c.bq.Tables.Delete(staging.ProjectId, staging.DatasetId, staging.TableId).Do()
+
+	_, err = c.runJobIn(context.Background(), location, &bigquery.JobConfiguration{
+		Load: &bigquery.JobConfigurationLoad{
+			SourceUris:                         []string{uri},
+			SourceFormat:                       "AVRO",
+			UseAvroLogicalTypes:                true,
+			DestinationTable:                   &staging,
+			WriteDisposition:                   WriteAppend,
+			DestinationEncryptionConfiguration: c.encryption(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.runJobIn(context.Background(), location, &bigquery.JobConfiguration{
+		Copy: &bigquery.JobConfigurationTableCopy{
+			SourceTable:                        &staging,
+			DestinationTable:                   ref,
+			CreateDisposition:                  "CREATE_IF_NEEDED",
+			WriteDisposition:                   WriteTruncate,
+			DestinationEncryptionConfiguration: c.encryption(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Error copying staging table - %s", err)
+	}
+	return nil
+}
+
+// Split gs://bucket/prefix into bucket and prefix, which ends with "/" if
+// it's not empty.
+func gcsPrefix(location string) (string, string, error) {
+	u, err := parseLocation(location, "")
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "gs" || u.Host == "" {
+		return "", "", fmt.Errorf("Invalid GCS location %s", location)
+	}
+	var prefix = strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return u.Host, prefix, nil
+}
+
+// Write v as json to the object.
+func (c *Client) writeGCSJSON(bucket, name string, v interface{}) error {
+	by, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = c.uploadGCS(context.Background(), bucket, name, bytes.NewReader(by), int64(len(by)))
+	return err
+}
+
+// Read json of the object into v.
+func (c *Client) readGCSJSON(bucket, name string, v interface{}) error {
+	r, _, err := gcsSource{}.Open(c, &url.URL{Scheme: "gs", Host: bucket, Path: "/" + name})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	by, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(by, v)
+}
@@ -0,0 +1,127 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"google.golang.org/api/bigquery/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A page of query results as stored in the cache file, one per line.
+type cachedPage struct {
+	Fields []*bigquery.TableFieldSchema `json:"fields"`
+	Rows   []*bigquery.TableRow         `json:"rows"`
+}
+
+// Writes pages to a cache file while passing them on.
+type cacheRecorder struct {
+	name string
+	f    *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+	fn   pageFunc
+}
+
+// Cache file name of the query run in the location.
+// Queries are normalized by collapsing whitespace, so reformatting a query
+// doesn't miss the cache.
+func cacheFile(dir, projectID, location, query string, standard bool, fields []string) string {
+	var h = sha256.New()
+	h.Write([]byte(projectID))
+	h.Write([]byte{0})
+	h.Write([]byte(location))
+	h.Write([]byte{0})
+	h.Write([]byte(strings.Join(strings.Fields(query), " ")))
+	h.Write([]byte{0})
+	if standard {
+		h.Write([]byte("standard"))
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(strings.Join(fields, ",")))
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))+".cache")
+}
+
+// Pass cached pages to fn if the cache file exists and isn't older than ttl.
+// Returns false if there's nothing usable in the cache.
+func readCache(name string, ttl time.Duration, fn pageFunc) (bool, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return false, nil
+	}
+	if ttl > 0 && time.Since(info.ModTime()) > ttl {
+		os.Remove(name)
+		return false, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return false, nil
+	}
+	defer f.Close()
+
+	var dec = json.NewDecoder(bufio.NewReader(f))
+	for dec.More() {
+		var p cachedPage
+		if err := dec.Decode(&p); err != nil {
+			return true, err
+		}
+		if err := fn(p.Fields, p.Rows); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// Start writing a cache file, only readable by the user unless conf sets
+// FileMode and DirMode.
+// Pages go to name.tmp, which is renamed by commit once all rows are read.
+func newCacheRecorder(name string, conf DumpConfig, fn pageFunc) (*cacheRecorder, error) {
+	var dirMode, fileMode = conf.DirMode, conf.FileMode
+	if dirMode == 0 {
+		dirMode = 0700
+	}
+	if fileMode == 0 {
+		fileMode = 0600
+	}
+	if err := os.MkdirAll(filepath.Dir(name), dirMode); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	var w = bufio.NewWriter(f)
+	return &cacheRecorder{name: name, f: f, w: w, enc: json.NewEncoder(w), fn: fn}, nil
+}
+
+// Store a page, then pass it on.
+func (r *cacheRecorder) page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+	if err := r.enc.Encode(cachedPage{Fields: fields, Rows: rows}); err != nil {
+		return err
+	}
+	return r.fn(fields, rows)
+}
+
+// Make the cache file available.
+func (r *cacheRecorder) commit() error {
+	var err = r.w.Flush()
+	if cerr := r.f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(r.name + ".tmp")
+		return err
+	}
+	return os.Rename(r.name+".tmp", r.name)
+}
+
+// Throw away the cache file.
+func (r *cacheRecorder) discard() {
+	r.f.Close()
+	os.Remove(r.name + ".tmp")
+}
@@ -0,0 +1,71 @@
+package bqwrapper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDumpCache(t *testing.T) {
+	var c = newTestClient(t, newFakeBigQuery(t, 10))
+	var dir = t.TempDir()
+	var cache = filepath.Join(dir, "cache")
+
+	// Masked dumps are never cached, so unmasked rows don't reach the disk.
+	var conf = DumpConfig{Query: "SELECT 1", Format: "csv", Output: filepath.Join(dir, "masked.csv"), CacheDir: cache, Mask: map[string]string{"name": MaskRedact}}
+	if err := c.Dump(conf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cache); !os.IsNotExist(err) {
+		t.Fatalf("masked dump cached: %v", err)
+	}
+
+	conf.Mask, conf.Output = nil, filepath.Join(dir, "out.csv")
+	if err := c.Dump(conf); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d cache files, want 1", len(files))
+	}
+	if mode := files[0].Mode().Perm(); mode != 0600 {
+		t.Errorf("cache file has mode %o, want 600", mode)
+	}
+
+	// The same query in another location isn't read from the cache.
+	if cacheFile(cache, "test", "EU", conf.Query, true, nil) == cacheFile(cache, "test", "US", conf.Query, true, nil) {
+		t.Error("cache key ignores location")
+	}
+}
+
+func TestDumpNoCache(t *testing.T) {
+	var f = newFakeBigQuery(t, 10)
+	var c = newTestClient(t, f)
+	var dir = t.TempDir()
+	var conf = DumpConfig{Query: "SELECT 1", Format: "csv", Output: filepath.Join(dir, "out.csv"), CacheDir: filepath.Join(dir, "cache")}
+	if err := c.Dump(conf); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := ioutil.ReadFile(conf.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without BigQuery's cache the local one isn't read either.
+	f.rows = 5
+	conf.NoCache = true
+	if err := c.Dump(conf); err != nil {
+		t.Fatal(err)
+	}
+	by, err := ioutil.ReadFile(conf.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(by) == string(cached) {
+		t.Error("NoCache dump read the cache")
+	}
+}
@@ -0,0 +1,164 @@
+package bqwrapper
+
+import (
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// BigQuery serving queries of testRows and taking loads, enough for dumps
+// and loads to run against.
+type fakeBigQuery struct {
+	t    testing.TB
+	rows int
+
+	mu sync.Mutex
+	// Bytes uploaded by load job ID.
+	loads map[string]int64
+}
+
+func newFakeBigQuery(t testing.TB, rows int) *fakeBigQuery {
+	return &fakeBigQuery{t: t, rows: rows, loads: map[string]int64{}}
+}
+
+func (f *fakeBigQuery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var path = r.URL.Path
+	switch {
+	case r.Method == "POST" && strings.HasSuffix(path, "/projects/test/queries"):
+		writeJSON(w, &bigquery.QueryResponse{
+			JobReference: &bigquery.JobReference{ProjectId: "test", JobId: "query"},
+			JobComplete:  true,
+			Schema:       &bigquery.TableSchema{Fields: testSchema()},
+			Rows:         testRows(0, f.rows),
+			TotalRows:    uint64(f.rows),
+		})
+	case r.Method == "GET" && strings.Contains(path, "/projects/test/datasets/"):
+		writeJSON(w, &bigquery.Dataset{DatasetReference: &bigquery.DatasetReference{ProjectId: "test", DatasetId: path[strings.LastIndex(path, "/")+1:]}})
+	case r.Method == "POST" && strings.HasPrefix(path, "/upload/bigquery/v2/projects/test/jobs"):
+		f.mu.Lock()
+		var id = fmt.Sprintf("load%d", len(f.loads))
+		f.loads[id] = 0
+		f.mu.Unlock()
+		w.Header().Set("Location", "https://www.googleapis.com/upload/session/"+id)
+	case r.Method == "PUT" && strings.HasPrefix(path, "/upload/session/"):
+		var id = path[strings.LastIndex(path, "/")+1:]
+		n, _ := io.Copy(ioutil.Discard, r.Body)
+		f.mu.Lock()
+		f.loads[id] += n
+		f.mu.Unlock()
+		writeJSON(w, &bigquery.Job{
+			JobReference: &bigquery.JobReference{ProjectId: "test", JobId: id},
+			Status:       &bigquery.JobStatus{State: "RUNNING"},
+		})
+	case r.Method == "GET" && strings.Contains(path, "/projects/test/jobs/"):
+		var id = path[strings.LastIndex(path, "/")+1:]
+		f.mu.Lock()
+		var n = f.loads[id]
+		f.mu.Unlock()
+		writeJSON(w, &bigquery.Job{
+			JobReference: &bigquery.JobReference{ProjectId: "test", JobId: id},
+			Status:       &bigquery.JobStatus{State: "DONE"},
+			Statistics:   &bigquery.JobStatistics{Load: &bigquery.JobStatistics3{InputFileBytes: n}},
+		})
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}
+}
+
+func TestConcurrentDumps(t *testing.T) {
+	var c = newTestClient(t, newFakeBigQuery(t, 100))
+	var dir = t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var conf = DumpConfig{Query: "SELECT 1", Format: "csv", Delimiter: "tab", PrintFields: true}
+			if i%2 == 1 {
+				conf = DumpConfig{Query: "SELECT 1", Format: "json", Pretty: true, TypeMapping: map[string]string{"TIMESTAMP": MapRFC3339}}
+			}
+			conf.Output = filepath.Join(dir, fmt.Sprintf("out%d.%s", i, conf.Format))
+			if err := c.Dump(conf); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Outputs of the same format are the same, whatever else ran at once.
+	var want = map[string][]byte{}
+	for i := 0; i < 8; i++ {
+		var ext = []string{"csv", "json"}[i%2]
+		by, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("out%d.%s", i, ext)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want[ext] == nil {
+			want[ext] = by
+		} else if string(by) != string(want[ext]) {
+			t.Errorf("out%d.%s differs from the others", i, ext)
+		}
+	}
+	if n := strings.Count(string(want["csv"]), "\n"); n != 101 {
+		t.Errorf("csv has %d lines, want 101", n)
+	}
+}
+
+func TestConcurrentLoads(t *testing.T) {
+	var f = newFakeBigQuery(t, 0)
+	var c = newTestClient(t, f)
+	var dir = t.TempDir()
+	var schema = filepath.Join(dir, "schema.json")
+	if err := ioutil.WriteFile(schema, []byte(`[{"name": "id", "type": "INTEGER"}, {"name": "name", "type": "STRING"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		var source = filepath.Join(dir, fmt.Sprintf("data%d.json", i))
+		var data = strings.Repeat(fmt.Sprintf(`{"id": %d, "name": "row"}`+"\n", i), i+1)
+		if err := ioutil.WriteFile(source, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := c.Load(LoadConfig{
+				DatasetID:  fmt.Sprintf("ds%d", i%2),
+				TableID:    fmt.Sprintf("t%d", i),
+				SchemaFile: schema,
+				SourceFile: source,
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	// Dumps share the client with the loads.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := c.Dump(DumpConfig{Query: "SELECT 1", Format: "json", Output: filepath.Join(dir, "out.json")}); err != nil {
+			t.Error(err)
+		}
+	}()
+	wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.loads) != 8 {
+		t.Errorf("got %d load jobs, want 8", len(f.loads))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "out.json")); err != nil {
+		t.Error(err)
+	}
+}
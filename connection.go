@@ -0,0 +1,125 @@
+package bqwrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Base URL of the BigQuery Connection API.
+const connectionURL = "https://bigqueryconnection.googleapis.com/v1/"
+
+// Create a connection to Cloud SQL or Spanner for federated queries.
+// Location defaults to the client's.
+func (c *Client) CreateConnection(conn Connection) error {
+	if conn.ConnectionID == "" || (conn.CloudSQL == nil) == (conn.Spanner == nil) {
+		return errors.New("missing params")
+	}
+
+	var res = connectionResource{FriendlyName: conn.FriendlyName, Description: conn.Description}
+	if sql := conn.CloudSQL; sql != nil {
+		res.CloudSQL = &cloudSQLProperties{
+			InstanceID: sql.InstanceID,
+			Database:   sql.Database,
+			Type:       sql.Type,
+			Credential: &cloudSQLCredential{Username: sql.Username, Password: sql.Password},
+		}
+	}
+	if sp := conn.Spanner; sp != nil {
+		res.Spanner = &spannerProperties{Database: sp.Database, UseParallelism: sp.UseParallelism}
+	}
+	by, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	var path = c.connectionParent(conn.Location) + "/connections?connectionId=" + url.QueryEscape(conn.ConnectionID)
+	resp, err := c.client.Post(connectionURL+path, "application/json", bytes.NewReader(by))
+	if err != nil {
+		return fmt.Errorf("Error creating connection %s - %s", conn.ConnectionID, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Error creating connection %s - %s", conn.ConnectionID, newUploadError(resp))
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List connections in the location, the client's by default. Passwords are
+// not returned.
+func (c *Client) ListConnections(location string) ([]Connection, error) {
+	var conns []Connection
+	var token string
+	for {
+		var q = url.Values{"pageSize": {"100"}}
+		if token != "" {
+			q.Set("pageToken", token)
+		}
+		resp, err := c.client.Get(connectionURL + c.connectionParent(location) + "/connections?" + q.Encode())
+		if err != nil {
+			return nil, fmt.Errorf("Error listing connections - %s", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Error listing connections - %s", newUploadError(resp))
+		}
+		var list connectionList
+		err = json.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding response - %s", err)
+		}
+
+		for _, res := range list.Connections {
+			// Name is projects/p/locations/l/connections/id.
+			var parts = strings.Split(res.Name, "/")
+			var conn = Connection{
+				ConnectionID: parts[len(parts)-1],
+				FriendlyName: res.FriendlyName,
+				Description:  res.Description,
+			}
+			if len(parts) == 6 {
+				conn.Location = parts[3]
+			}
+			if sql := res.CloudSQL; sql != nil {
+				conn.CloudSQL = &CloudSQLConnection{InstanceID: sql.InstanceID, Database: sql.Database, Type: sql.Type}
+			}
+			if sp := res.Spanner; sp != nil {
+				conn.Spanner = &SpannerConnection{Database: sp.Database, UseParallelism: sp.UseParallelism}
+			}
+			conns = append(conns, conn)
+		}
+		if token = list.NextPageToken; token == "" {
+			return conns, nil
+		}
+	}
+}
+
+// Standard SQL query running query on the database of a connection
+// ("location.connection" or "project.location.connection") with
+// EXTERNAL_QUERY, to use as a query of its own or as a table in another.
+func ExternalQuery(connection, query string) string {
+	var q = strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(sqlString(query))
+	return "SELECT * FROM EXTERNAL_QUERY(" + sqlString(connection) + ", " + q + ")"
+}
+
+// Dump results of a query run on the database of a connection, see
+// ExternalQuery. conf.Query and conf.Table are replaced.
+func (c *Client) DumpExternalQuery(connection, query string, conf DumpConfig) error {
+	if connection == "" || query == "" {
+		return errors.New("missing params")
+	}
+	conf.Query, conf.Table = standardPrefix+"\n"+ExternalQuery(connection, query), ""
+	return c.Dump(conf)
+}
+
+// Parent of connections in the location.
+func (c *Client) connectionParent(location string) string {
+	if location == "" {
+		location = c.Location
+	}
+	return "projects/" + url.PathEscape(c.ProjectID) + "/locations/" + url.PathEscape(strings.ToLower(location))
+}
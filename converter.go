@@ -0,0 +1,35 @@
+package bqwrapper
+
+import (
+	"google.golang.org/api/bigquery/v2"
+)
+
+// Converters of a dump by field type and by column, see
+// DumpConfig.Converters.
+type converters struct {
+	types   map[string]Converter
+	columns map[string]Converter
+}
+
+// Converters of the dump.
+func dumpConverters(conf DumpConfig) converters {
+	return converters{types: conf.Converters, columns: conf.ColumnConverters}
+}
+
+// Converter for the column or else its type, nil if there's none.
+func (c converters) lookup(name, ftype string) Converter {
+	if conv, ok := c.columns[name]; ok {
+		return conv
+	}
+	return c.types[ftype]
+}
+
+// Convert a value with the converter, the field defaults to one with the
+// column's name and type.
+func convertWith(conv Converter, col fieldType, v interface{}) (interface{}, error) {
+	var field = col.field
+	if field == nil {
+		field = &bigquery.TableFieldSchema{Name: col.name, Type: col.ftype}
+	}
+	return conv.Convert(field, v)
+}
@@ -0,0 +1,46 @@
+package bqwrapper
+
+import (
+	"google.golang.org/api/bigquery/v2"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConvertersPerDump(t *testing.T) {
+	var c = newTestClient(t, newFakeBigQuery(t, 3))
+	var dir = t.TempDir()
+	var upper = ConverterFunc(func(field *bigquery.TableFieldSchema, v interface{}) (interface{}, error) {
+		return strings.ToUpper(v.(string)), nil
+	})
+	var confs = []DumpConfig{
+		{ColumnConverters: map[string]Converter{"name": upper}},
+		{},
+		{Converters: map[string]Converter{"string": upper}},
+	}
+	var wg sync.WaitGroup
+	for i := range confs {
+		confs[i].Query, confs[i].Format = "SELECT 1", "csv"
+		confs[i].Output = filepath.Join(dir, string(rune('a'+i))+".csv")
+		wg.Add(1)
+		go func(conf DumpConfig) {
+			defer wg.Done()
+			if err := c.Dump(conf); err != nil {
+				t.Error(err)
+			}
+		}(confs[i])
+	}
+	wg.Wait()
+
+	for i, want := range []bool{true, false, true} {
+		by, err := ioutil.ReadFile(confs[i].Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(string(by), "NAME"); got != want {
+			t.Errorf("dump %d converted: %v, want %v\n%s", i, got, want, by)
+		}
+	}
+}
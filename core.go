@@ -2,70 +2,227 @@ package bqwrapper
 
 import (
 	"bytes"
-	"encoding/csv"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
-	"sort"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Version of the package, sent in the User-Agent of requests.
+const Version = "0.1.0"
+
+// Idle connections kept by transports unless set in TransportConfig.
+// Go's default of 2 per host makes parallel workloads open (and leave in
+// TIME_WAIT) a new connection for most requests.
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 64
+)
+
+// Row maps for toRows to reuse.
+var rowPool = sync.Pool{
+	New: func() interface{} {
+		return make(map[string]interface{})
+	},
+}
+
+// Transports by their settings and the number of clients using each, see
+// sharedTransport.
+var transports struct {
+	sync.Mutex
+	m     map[TransportConfig]*http.Transport
+	users map[*http.Transport]int
+}
+
 // Load data to BigQuery using source files (json or csv) using HTTP POST.
+// See Client.Load and LoadConfig for more options.
 func Load(projectID, datasetID, tableID, jwtFile, schemaFile, sourceFile, proxy string) error {
-	// All params are required.
-	if projectID == "" || datasetID == "" || tableID == "" ||
-		jwtFile == "" || schemaFile == "" || sourceFile == "" {
+	// All params are required, project and JWT file may come from the
+	// environment.
+	if datasetID == "" || tableID == "" || schemaFile == "" || sourceFile == "" {
 		return errors.New("missing params")
 	}
 
-	// Check and set source format.
-	var format string
-	switch {
-	case strings.HasSuffix(sourceFile, ".json"):
-		format = "NEWLINE_DELIMITED_JSON"
-	case strings.HasSuffix(sourceFile, ".csv"):
-		format = "CSV"
-	default:
-		return errors.New("Unsupported source file format")
+	// Start BigQuery service.
+	c, err := NewClient(projectID, jwtFile, proxy)
+	if err != nil {
+		return err
+	}
+	return c.Load(LoadConfig{
+		DatasetID:  datasetID,
+		TableID:    tableID,
+		SchemaFile: schemaFile,
+		SourceFile: sourceFile,
+	})
+}
+
+// Load data to BigQuery as configured in conf.
+func (c *Client) Load(conf LoadConfig) error {
+	return c.LoadContext(context.Background(), conf)
+}
+
+// Load data to BigQuery as configured in conf, stopping when ctx is done.
+// The load job is cancelled as well if the client's CancelJobs is set.
+func (c *Client) LoadContext(ctx context.Context, conf LoadConfig) error {
+	c.Defaults.load(&conf)
+	defer shareRejects(&conf)()
+	ctx, end, err := c.begin(ctx)
+	if err != nil {
+		return err
 	}
+	defer end()
 
-	// Set proxy if requested.
-	if proxy != "" {
-		os.Setenv("HTTP_PROXY", proxy)
+	// All params are required.
+	if conf.DatasetID == "" || conf.TableID == "" || conf.SchemaFile == "" || conf.SourceFile == "" {
+		return errors.New("missing params")
 	}
 
-	// Start BigQuery service.
-	client, err := oauthClient(jwtFile)
-	if err != nil {
+	if err := expandFields(conf.Vars, &conf.TableID, &conf.SourceFile); err != nil {
 		return err
 	}
-	bq, err := bigquery.New(client)
-	if err != nil {
+	if !conf.ShardDate.IsZero() {
+		if conf.ShardField != "" {
+			return errors.New("ShardDate and ShardField can't both be set")
+		}
+		conf.TableID = shardTable(conf.TableID, conf.ShardDate)
+	}
+	if err := (Destination{DatasetID: conf.DatasetID, TableID: conf.TableID}).Validate(); err != nil {
+		return err
+	}
+	if err := checkAfterLoad(conf); err != nil {
 		return err
 	}
+	if err := checkHivePartitioning(conf); err != nil {
+		return err
+	}
+	if err := checkDedup(conf); err != nil {
+		return err
+	}
+	if conf.ShardField != "" {
+		return c.loadShards(ctx, conf)
+	}
+
+	var started = time.Now()
+
+	// Hive partitioned data is loaded straight from GCS.
+	if conf.HivePartitioning != nil {
+		ctx, cancel := loadContext(ctx, conf)
+		defer cancel()
+		job, err := c.load(ctx, conf, conf.SourceFile, nil, 0)
+		return c.notifyLoad(conf, started, job, timeoutError(ctx, conf, err))
+	}
+
+	// Open source.
+	r, size, err := c.openSource(conf.SourceFile)
+	if err != nil {
+		return c.notifyLoad(conf, started, nil, err)
+	}
+	if r, size, err = applyDefaults(conf, r, size); err != nil {
+		return c.notifyLoad(conf, started, nil, err)
+	}
+	if r, err = c.validateLoad(conf, r); err != nil {
+		return c.notifyLoad(conf, started, nil, err)
+	}
+	defer r.Close()
+
+	ctx, cancel := loadContext(ctx, conf)
+	defer cancel()
+	job, err := c.load(ctx, conf, conf.SourceFile, r, size)
+	if jerr, ok := err.(*JobError); ok && conf.RejectFile != "" {
+		var rconf = conf
+		if d, ok := r.(*defaultedSource); ok {
+			// Bad records are at positions of what was uploaded.
+			rconf.SourceFile = d.Name()
+		}
+		job, err = c.loadWithoutRejects(ctx, rconf, jerr)
+	}
+	err = timeoutError(ctx, conf, err)
+	if err == nil && conf.AfterLoad != "" {
+		r.Close()
+		err = afterLoad(conf)
+	}
+	return c.notifyLoad(conf, started, job, err)
+}
+
+// Context of a load, done with ctx or after conf.OperationTimeout if it's set.
+func loadContext(ctx context.Context, conf LoadConfig) (context.Context, context.CancelFunc) {
+	if conf.OperationTimeout > 0 {
+		return context.WithTimeout(ctx, conf.OperationTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Tell a load that failed because it ran out of time apart from other errors.
+func timeoutError(ctx context.Context, conf LoadConfig, err error) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Load timed out after %s - %s", conf.OperationTimeout, err)
+	}
+	return err
+}
+
+// Load size bytes of data read from body to BigQuery as configured in conf.
+// source is the name of the data, its suffix telling the format.
+// The load stops when ctx is done.
+func (c *Client) load(ctx context.Context, conf LoadConfig, source string, body io.Reader, size int64) (*bigquery.Job, error) {
+	job, err := c.loadData(ctx, conf, source, body, size)
+	if err == nil && len(conf.DedupKeys) != 0 {
+		err = c.dedup(ctx, conf)
+	}
+	return job, err
+}
+
+// Run the load job of load.
+func (c *Client) loadData(ctx context.Context, conf LoadConfig, source string, body io.Reader, size int64) (*bigquery.Job, error) {
+	var projectID, datasetID, tableID = c.ProjectID, conf.DatasetID, conf.TableID
+	var schemaFile, sourceFile = conf.SchemaFile, source
+	var client = c.client
+
+	// Check and set source format.
+	var format = loadFormat(conf, sourceFile)
+	if format == "" {
+		return nil, errors.New("Unsupported source file format")
+	}
+	if err := c.checkDenied(projectID, datasetID); err != nil {
+		return nil, err
+	}
 
 	// First, check if the dataset already exists.
-	// If it doesn't yet, create before calling load job.
-	if err = datasetCreateIfNotExists(bq, projectID, datasetID); err != nil {
-		return fmt.Errorf("Error checking/creating dataset - %s", err)
+	// If it doesn't yet, create before calling load job unless told not to.
+	if err := c.checkDataset(projectID, datasetID, !conf.NoCreateDataset); err != nil {
+		return nil, fmt.Errorf("Error checking/creating dataset - %s", err)
 	}
 
 	// Load the schema configuration.
-	var fields []TableField
-	by, err := ioutil.ReadFile(schemaFile)
+	fields, err := readSchema(schemaFile)
 	if err != nil {
-		return fmt.Errorf("Error reading schema - %s", err)
+		return nil, err
 	}
-	if err = json.Unmarshal(by, &fields); err != nil {
-		return fmt.Errorf("Error reading schema - %s", err)
+
+	// Time partitioning of the table, if requested.
+	var partitioning = loadPartitioning(conf)
+
+	// Load job can't set table expiration, so create the table ourselves first.
+	if conf.TableExpiration > 0 {
+		if err = c.createTable(projectID, datasetID, tableID, fields, partitioning, time.Now().Add(conf.TableExpiration)); err != nil {
+			return nil, err
+		}
 	}
 
 	// Generate job configuration.
@@ -73,25 +230,50 @@ func Load(projectID, datasetID, tableID, jwtFile, schemaFile, sourceFile, proxy
 		Conf: jobMainConf{
 			Load: jobLoadConf{
 				Format: format,
-				Schema: Schema{Fields: fields},
+				Schema: Schema{Fields: withoutDefaults(fields)},
 				Destination: Destination{
 					ProjectID: projectID,
 					DatasetID: datasetID,
 					TableID:   tableID,
 				},
+				Partitioning: partitioning,
 			},
 		},
 	}
+	if c.Location != "" {
+		bqConf.Reference = &jobReference{Location: c.Location}
+	}
+	if c.KMSKeyName != "" {
+		bqConf.Conf.Load.Encryption = &encryptionConf{KMSKeyName: c.KMSKeyName}
+	}
+
+	if conf.HivePartitioning != nil {
+		return c.hiveLoad(ctx, conf, bqConf.Conf.Load)
+	}
+
+	// Stage the data in GCS and load it from there if asked to.
+	if conf.StagingBucket != "" {
+		return c.stagedLoad(ctx, conf, bqConf.Conf.Load, source, body, size)
+	}
+
 	var confBytes []byte
 	if confBytes, err = json.Marshal(bqConf); err != nil {
-		return err
+		return nil, err
 	}
 
-	// Read in source.
-	data, err := ioutil.ReadFile(sourceFile)
+	ctx, end, err := c.begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer end()
+	release, err := c.acquireJob(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
+
+	// Count what we send so we can tell later whether BigQuery got all of it.
+	var sent sizeWriter
 
 	// Initiate the load request.
 	req, err := http.NewRequest(
@@ -100,81 +282,60 @@ func Load(projectID, datasetID, tableID, jwtFile, schemaFile, sourceFile, proxy
 		bytes.NewBuffer(confBytes),
 	)
 	if err != nil {
-		return fmt.Errorf("Error creating initial request - %s", err)
+		return nil, fmt.Errorf("Error creating initial request - %s", err)
 	}
 
 	// Set header values.
 	req.Header.Set("X-Upload-Content-Type", "application/json")
-	req.Header.Set("X-Upload-Content-Length", strconv.Itoa(len(data)))
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
 	req.Header.Set("Content-Length", strconv.Itoa(len(confBytes)))
 	req.Header.Set("Content-Type", "application/json")
 
 	// Send the request and get upload uri.
-	res, err := client.Do(req)
+	res, err := client.Do(req.WithContext(ctx))
 	if err != nil {
-		return fmt.Errorf("error in intial request - %s", err)
+		return nil, fmt.Errorf("error in intial request - %s", err)
 	}
 	if res.StatusCode != http.StatusOK {
-		code := res.Status
-		var errRes ErrorResponse
-		json.NewDecoder(res.Body).Decode(&errRes)
-		res.Body.Close()
-		return fmt.Errorf("did not get OK, got %s (%s)",
-			code, errRes.Error.Message)
+		return nil, newUploadError(res)
 	}
 	loc, err := res.Location()
 	if err != nil {
 		res.Body.Close()
-		return fmt.Errorf("error getting Location header - %s", err)
+		return nil, fmt.Errorf("error getting Location header - %s", err)
 	}
 	res.Body.Close()
 
-	if req, err = http.NewRequest("POST", loc.String(), bytes.NewBuffer(data)); err != nil {
-		return fmt.Errorf("Error creating request - %s", err)
-	}
-	if res, err = client.Do(req); err != nil {
-		return fmt.Errorf("Error in response - %s", err)
-	}
-	if res.StatusCode != http.StatusOK {
-		code := res.Status
-		res.Body.Close()
-		return fmt.Errorf("Did not get OK, got %s", code)
+	// Send the data, resuming on server errors.
+	by, err := c.resumeUpload(ctx, loc.String(), io.TeeReader(body, &sent), size)
+	if err != nil {
+		return nil, err
 	}
 
 	// Need JobID to check on its status.
-	r, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("Error reading response - %s", err)
-	}
 	var response bigquery.Job
-	if err = json.Unmarshal(r, &response); err != nil {
-		res.Body.Close()
-		return fmt.Errorf("Error decoding response - %s", err)
+	if err = json.Unmarshal(by, &response); err != nil {
+		return nil, fmt.Errorf("Error decoding response - %s", err)
 	}
 	if response.JobReference.ProjectId != projectID {
-		res.Body.Close()
-		return fmt.Errorf("Returned ProjectID %s != configured ID %s",
+		return nil, fmt.Errorf("Returned ProjectID %s != configured ID %s",
 			response.JobReference.ProjectId, projectID)
 	}
 	job := response.JobReference.JobId
+	c.journalJob(&response)
 
-	// Now wait until this job is done.
-	tick := time.NewTicker(3 * time.Second)
-	defer tick.Stop()
-	var done bool
-	for {
-		select {
-		case <-tick.C:
-			if done, err = jobDone(bq, projectID, job); err != nil {
-				return err
-			}
-			if done {
-				return nil
-			}
-		}
+	// Now wait until this job is done, where BigQuery put it.
+	var location = c.Location
+	if response.JobReference.Location != "" {
+		location = response.JobReference.Location
+	}
+	status, err := c.waitJob(ctx, location, job)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	// Make sure BigQuery read as much as we sent.
+	return status, verifyLoad(sourceFile, int64(sent), status)
 }
 
 // Select rows from BigQuery, then dump to a json or csv file.
@@ -187,366 +348,1412 @@ func Load(projectID, datasetID, tableID, jwtFile, schemaFile, sourceFile, proxy
 //   If this is set, output file will have field names written in ti.
 //
 // This function takes query to run, but you can easily modify/add to select the entire table too.
+// See Client.Dump and DumpConfig for more options.
 func Dump(projectID, jwtFile, output, fileFormat, delimiter, query, proxy string, pretty, printFields bool, timeout int64, nocache bool) error {
-	// Required params check.
-	if projectID == "" || jwtFile == "" || output == "" || fileFormat == "" || query == "" {
-		return errors.New("no paramters")
-	}
-
-	// Check and set per filetype option.
-	switch strings.ToLower(fileFormat) {
-	case "json":
-		fileFormat = "json"
-	case "csv":
-		fileFormat = "csv"
-		if delimiter == "" {
-			// Default "," (comma)
-			delimiter = ","
-		}
-	default:
-		return errors.New("Unsupported output file format")
+	// Project and JWT file are checked by NewClient, as they may come from
+	// the environment.
+	c, err := NewClient(projectID, jwtFile, proxy)
+	if err != nil {
+		return err
 	}
+	return c.Dump(DumpConfig{
+		Output:      output,
+		Format:      fileFormat,
+		Delimiter:   delimiter,
+		Query:       query,
+		Pretty:      pretty,
+		PrintFields: printFields,
+		Timeout:     timeout,
+		NoCache:     nocache,
+	})
+}
 
-	// Set proxy if requested.
-	if proxy != "" {
-		os.Setenv("HTTP_PROXY", proxy)
-	}
+// Select rows from BigQuery, then dump to a json or csv file as configured in conf.
+func (c *Client) Dump(conf DumpConfig) error {
+	return c.DumpContext(context.Background(), conf)
+}
 
-	// Start BigQuery service.
-	client, err := oauthClient(jwtFile)
+// Dump as configured in conf, stopping when ctx is done. The query job is
+// cancelled as well if the client's CancelJobs is set.
+func (c *Client) DumpContext(ctx context.Context, conf DumpConfig) error {
+	c.Defaults.dump(&conf)
+	ctx, end, err := c.begin(ctx)
 	if err != nil {
 		return err
 	}
-	bq, err := bigquery.New(client)
-	if err != nil {
+	defer end()
+	if err := expandFields(conf.Vars, &conf.Query, &conf.Table, &conf.Output); err != nil {
+		return err
+	}
+	var done = Completion{Operation: "dump", Output: conf.Output, Started: time.Now()}
+	err = c.dump(ctx, conf, &done)
+	return c.notify(conf.Notify, done, err)
+}
+
+// Run the dump, setting job ID and number of rows in done.
+func (c *Client) dump(ctx context.Context, conf DumpConfig, done *Completion) error {
+	// Required params check.
+	if conf.Query == "" && conf.Table == "" {
+		return errors.New("no paramters")
+	}
+	if conf.Query != "" && !conf.AsOf.IsZero() {
+		return errors.New("AsOf needs Table, not Query")
+	}
+	if err := checkDumpConfig(&conf); err != nil {
 		return err
 	}
 
+	// Queries starting with #standardSQL are standard SQL, as well as
+	// queries in a session and of a table.
+	// If only a table is given, select the whole table (as of conf.AsOf, if set).
+	// TABLESAMPLE only works on a table, not on a query or a table as of a time.
+	var sampleTable = conf.Query == "" && conf.Table != "" && conf.AsOf.IsZero()
+	var standard = conf.SessionID != ""
+	if strings.HasPrefix(conf.Query, standardPrefix) {
+		conf.Query = strings.TrimPrefix(conf.Query, standardPrefix)
+		standard = true
+	}
+	if conf.Query == "" {
+		var err error
+		if conf.Query, err = tableQuery(c.ProjectID, conf.Table, conf.AsOf); err != nil {
+			return err
+		}
+		standard = true
+	}
+	if conf.Sample > 0 {
+		conf.Query = sampleQuery(conf.Query, conf.Sample, sampleTable)
+	}
+	if len(conf.Columns) != 0 {
+		var err error
+		if conf.Query, err = columnsQuery(conf.Query, conf.Columns, standard); err != nil {
+			return err
+		}
+	}
+
 	// Create request.
-	conf := &bigquery.QueryRequest{
-		Kind:  "bigquery#queryRequest",
-		Query: query,
+	req := &bigquery.QueryRequest{
+		Kind:     "bigquery#queryRequest",
+		Query:    conf.Query,
+		Location: c.Location,
+	}
+	if standard {
+		req.UseLegacySql = new(bool)
 	}
 
 	// Set timeout if passed.
-	if timeout != 0 {
-		conf.TimeoutMs = timeout
+	if conf.Timeout != 0 {
+		req.TimeoutMs = conf.Timeout
 	}
 
 	// If "nocache" is set, we do not use cached data but run the query against
 	// the actual table(s) the query refers to.
-	if nocache {
-		conf.UseQueryCache = new(bool)
+	if conf.NoCache {
+		req.UseQueryCache = new(bool)
 	}
 
-	// Send it.
-	req := bq.Jobs.Query(projectID, conf)
-	res, err := req.Do()
-	if err != nil {
-		return fmt.Errorf("Error sending request - %s", err)
+	// Sessions are only available to standard SQL.
+	if conf.SessionID != "" {
+		req.ConnectionProperties = []*bigquery.ConnectionProperty{
+			{Key: "session_id", Value: conf.SessionID},
+		}
 	}
 
-	// Verify response.
-	if len(res.Errors) != 0 {
-		return fmt.Errorf("%d errors returned", len(res.Errors))
+	if conf.Lint != nil {
+		if err := c.lintDump(ctx, req, *conf.Lint); err != nil {
+			return err
+		}
 	}
 
-	// Wait until we get all rows.
-	// Since number of rows returned from BigQuery at a time is limited, it's possible
-	// that we got only part of results.
-	var total = res.TotalRows
-	var retrieved = len(res.Rows)
-	var rows = res.Rows
+	// A resumable dump leaves its output for the next run when it fails.
+	if conf.ResumeFile != "" {
+		conf.KeepPartial = true
+		return c.resumeDump(ctx, conf, req, c.newOutput(conf), done)
+	}
 
-	// Make sure we got rows.
-	if res.Schema == nil {
-		return errors.New("Error getting reply, no schema data returned")
-	}
-	var fields = res.Schema.Fields
-
-	if retrieved != int(total) {
-		// Still rows waiting to be requested, request again until we get all.
-		var jobID = res.JobReference.JobId
-		var token = res.PageToken
-		if res.Schema == nil {
-			return errors.New("Error getting reply, no data returned")
-		}
-		for int(total) != retrieved {
-			req := bq.Jobs.GetQueryResults(projectID, jobID)
-			req.PageToken(token)
-			req.StartIndex(uint64(retrieved))
-			res, err := req.Do()
+	var w = c.newOutput(conf)
+	var fn = w.page
+
+	// Use results cached on local disk if there are any.
+	// Queries in a session may read its temporary tables, so they're not
+	// cached, nor are results of masked dumps, which would be stored unmasked.
+	var rec *cacheRecorder
+	if conf.CacheDir != "" && conf.SessionID == "" && len(conf.Mask) == 0 {
+		var name = cacheFile(conf.CacheDir, c.ProjectID, req.Location, conf.Query, standard, conf.Fields)
+		if !conf.BypassCache && !conf.NoCache {
+			ok, err := readCache(name, conf.CacheTTL, w.page)
 			if err != nil {
-				return fmt.Errorf("Error getting query results - %s", err)
+				w.abort()
+				return fmt.Errorf("Error reading cached results - %s", err)
 			}
-			if len(res.Errors) != 0 {
-				return fmt.Errorf("%d errors returned", len(res.Errors))
+			if ok {
+				return c.closeOutput(w, conf, req.Location, done)
 			}
-			token = res.PageToken
-			rows = append(rows, res.Rows...)
-			retrieved += len(res.Rows)
 		}
+		var err error
+		if rec, err = newCacheRecorder(name, conf, w.page); err != nil {
+			return fmt.Errorf("Error creating cache file - %s", err)
+		}
+		fn = rec.page
 	}
 
-	// Finished getting rows, convert it to map of interface for write.
-	result, err := toRows(fields, rows)
+	// Send it and write out rows page by page.
+	jobID, outErr, err := c.sendQuery(ctx, req, conf, fn)
+	done.JobID, done.Location = jobID, req.Location
 	if err != nil {
+		if rec != nil {
+			rec.discard()
+		}
+		w.abort()
+		if len(conf.Failover) != 0 && !outErr && ctx.Err() == nil {
+			return c.failover(ctx, conf, req, done, err)
+		}
 		return err
 	}
 
-	// Write out to a file.
-	if fileFormat == "json" {
-		return dumpJSON(result, output, pretty)
-	} else {
-		return dumpCSV(result, output, delimiter, printFields)
+	if rec != nil {
+		if err := rec.commit(); err != nil {
+			w.abort()
+			return fmt.Errorf("Error writing cached results - %s", err)
+		}
 	}
+	return c.closeOutput(w, conf, req.Location, done)
+}
 
-	return errors.New("something went wrong!!")
+// Dump the whole table to a json or csv file, reading rows with tabledata.list
+// instead of a query so it costs nothing.
+// Output options are taken from conf, Query and Table are not used. If AsOf
+// or Sample is set, the table is queried instead.
+// projectID defaults to the client's project.
+func (c *Client) DumpTable(projectID, datasetID, tableID string, conf DumpConfig) error {
+	return c.DumpTableContext(context.Background(), projectID, datasetID, tableID, conf)
 }
 
-// Check status of the requested job.
-func jobDone(bq *bigquery.Service, pid, jid string) (bool, error) {
-	// Send the Job status call.
-	call := bq.Jobs.Get(pid, jid)
-	res, err := call.Do()
+// Dump the whole table as DumpTable does, stopping when ctx is done.
+func (c *Client) DumpTableContext(ctx context.Context, projectID, datasetID, tableID string, conf DumpConfig) error {
+	c.Defaults.dump(&conf)
+	ctx, end, err := c.begin(ctx)
 	if err != nil {
-		return false, err
-	}
-
-	// If there was an application error from BigQuery, the error will not be set in error
-	// from the library's Do() call (FML).
-	if len(res.Status.Errors) != 0 {
-		return false, fmt.Errorf("%d errors returned", len(res.Status.Errors))
+		return err
 	}
-
-	switch res.Status.State {
-	case "PENDING", "RUNNING":
-		return false, nil
-	case "DONE":
-		return true, nil
+	defer end()
+	if err := expandFields(conf.Vars, &tableID, &conf.Output); err != nil {
+		return err
 	}
-
-	return false, fmt.Errorf("Unknown job status returned - %s (%s,%s)",
-		res.Status.State, pid, jid)
+	var done = Completion{Operation: "dump", Output: conf.Output, Started: time.Now()}
+	err = c.dumpTable(ctx, projectID, datasetID, tableID, conf, &done)
+	return c.notify(conf.Notify, done, err)
 }
 
-// Check if requested dataset exists under the project and create the dataset
-// if it doesn't exist yet.
-func datasetCreateIfNotExists(bq *bigquery.Service, projectID, datasetID string) error {
-	// Check list of datasets in the requested project.
-	checkReq := bq.Datasets.List(projectID)
-	res, err := checkReq.Do()
-	if err != nil {
-		return fmt.Errorf("Error checking datasets - %s", err)
+// Dump the table, setting number of rows in done.
+func (c *Client) dumpTable(ctx context.Context, projectID, datasetID, tableID string, conf DumpConfig, done *Completion) error {
+	// Required params check.
+	if datasetID == "" || tableID == "" {
+		return errors.New("no paramters")
+	}
+	if err := (Destination{ProjectID: projectID, DatasetID: datasetID, TableID: tableID}).Validate(); err != nil {
+		return err
+	}
+	if err := checkDumpConfig(&conf); err != nil {
+		return err
+	}
+	if projectID == "" {
+		projectID = c.ProjectID
 	}
 
-	for _, dataset := range res.Datasets {
-		if dataset.DatasetReference.DatasetId == datasetID {
-			// The dataset already exists, no need to create.
-			return nil
-		}
+	// Table data can't be sampled or read as of a time, so it's queried.
+	if conf.Sample > 0 || !conf.AsOf.IsZero() {
+		conf.Query, conf.Table = "", projectID+"."+datasetID+"."+tableID
+		return c.dump(ctx, conf, done)
 	}
 
-	// If the response has more list, loop all through and try finding
-	// this dataset.
-	var token = res.NextPageToken
-	for token != "" {
-		checkReq.PageToken(token)
-		if res, err = checkReq.Do(); err != nil {
-			return err
-		}
-		for _, dataset := range res.Datasets {
-			if dataset.DatasetReference.DatasetId == datasetID {
-				return nil
-			}
+	// Columns are read as selected fields, which checks they exist.
+	for _, col := range conf.Columns {
+		if !columnName.MatchString(col) {
+			return fmt.Errorf("Invalid column %s", col)
 		}
-		token = res.NextPageToken
+		conf.Fields = append(conf.Fields, col)
 	}
 
-	// Dataset not exist, need to create.
-	createReq := bq.Datasets.Insert(projectID, &bigquery.Dataset{
-		DatasetReference: &bigquery.DatasetReference{DatasetId: datasetID},
-	})
-	if _, err := createReq.Do(); err != nil {
+	// Table is only used for the metadata file.
+	conf.Table = projectID + "." + datasetID + "." + tableID
+	var w = c.newOutput(conf)
+	err := c.tableData(ctx, &bigquery.TableReference{
+		ProjectId: projectID,
+		DatasetId: datasetID,
+		TableId:   tableID,
+	}, conf.Fields, conf.PageSize, w.page)
+	if err != nil {
+		w.abort()
 		return err
 	}
 
-	return nil
-}
-
-// Parse JWT file and initiate http.Client with it.
-func oauthClient(jwtFile string) (*http.Client, error) {
-	// Parse JWT file and set up credentials.
-	by, err := ioutil.ReadFile(jwtFile)
-	if err != nil {
-		return nil, err
-	}
-	conf, err := google.JWTConfigFromJSON(by, bigquery.BigqueryScope)
-	if err != nil {
-		return nil, err
-	}
-	return conf.Client(oauth2.NoContext), nil
+	return c.closeOutput(w, conf, c.Location, done)
 }
 
-// Write out json file with given interface map.
-func dumpJSON(data []map[string]interface{}, output string, pretty bool) error {
-	// Open file for write.
-	f, err := os.Create(output)
-	if err != nil {
-		return err
+// Check output options of the dump and set defaults.
+func checkDumpConfig(conf *DumpConfig) error {
+	if conf.Output == "" || conf.Format == "" {
+		return errors.New("no paramters")
 	}
 
-	// Marshal the json data then write down.
-	if pretty {
-		by, err := json.MarshalIndent(data, "", "\t")
-		if err != nil {
-			return err
+	// Check and set per filetype option.
+	switch strings.ToLower(conf.Format) {
+	case "json":
+		conf.Format = "json"
+	case "csv":
+		conf.Format = "csv"
+		if conf.Delimiter == "" {
+			// Default "," (comma)
+			conf.Delimiter = ","
 		}
-		if _, err = f.Write(by); err != nil {
-			os.Remove(output)
-			return err
+	case "arrow", "feather":
+		conf.Format = "arrow"
+	case "proto", "protobuf":
+		conf.Format = "proto"
+		if conf.ProtoDescriptor == "" || conf.ProtoMessage == "" {
+			return errors.New("missing ProtoDescriptor or ProtoMessage")
 		}
-	} else {
-		enc := json.NewEncoder(f)
-		if err = enc.Encode(data); err != nil {
-			os.Remove(output)
-			return err
+	case "sqlite":
+		// Output is the database file.
+		conf.Format = "sqlite"
+	case "sql":
+		// Output is the data source name for SQLDriver.
+		conf.Format = "sql"
+		if conf.SQLDriver == "" {
+			return errors.New("missing SQLDriver")
 		}
+	case "sheets":
+		// Output is the spreadsheet.
+		conf.Format = "sheets"
+	default:
+		return errors.New("Unsupported output file format")
 	}
-
-	return nil
-}
-
-// Write out a csv file with the given interface value.
-// If "printField" is set, the output will have field names in the beginning of file.
-// The "fields" has to be passed to ensure values for fields and the order are guaranteed.
-func dumpCSV(data []map[string]interface{}, output, delim string, printFields bool) error {
-	// Get field names from the source data.
-	var fields sort.StringSlice
-	for key, _ := range data[0] {
-		fields = append(fields, key)
-	}
-
-	// Sort alphabetically so the field order is always same.
-	fields.Sort()
-
-	// Create slic eof strings so it'll be csv writer compatible.
-	var lines = make([][]string, len(data), len(data)+1)
-	var val interface{}
-	var ok bool
-	var i int
-	for num, rows := range data {
-		lines[num] = make([]string, len(fields))
-		for i = 0; i < len(fields); i++ {
-			if val, ok = rows[fields[i]]; ok {
-				lines[num][i] = fmt.Sprintf("%v", val)
-			} else {
-				lines[num][i] = ""
-			}
+	if conf.MarshalRow != nil && conf.Format != "json" {
+		return errors.New("MarshalRow only applies to json output")
+	}
+	switch conf.OversizeAction {
+	case "", OversizeTruncate, OversizeSkip, OversizeError:
+	default:
+		return fmt.Errorf("Unsupported OversizeAction %s", conf.OversizeAction)
+	}
+	switch conf.UnknownTypeMode {
+	case "", UnknownTypeError, UnknownTypeString, UnknownTypeSkip:
+	default:
+		return fmt.Errorf("Unsupported UnknownTypeMode %s", conf.UnknownTypeMode)
+	}
+	if conf.TimeZone != "" {
+		if _, err := time.LoadLocation(conf.TimeZone); err != nil {
+			return fmt.Errorf("Invalid TimeZone %s - %s", conf.TimeZone, err)
 		}
 	}
-
-	// If we need to print fields, prepend it.
-	if printFields {
-		lines = append([][]string{fields}, lines...)
+	if conf.Sample < 0 || conf.Sample > 100 {
+		return errors.New("Sample must be between 0 and 100")
 	}
-
-	// Open file for write.
-	f, err := os.Create(output)
-	if err != nil {
+	if err := checkTypeMapping(conf.TypeMapping); err != nil {
 		return err
 	}
-	defer f.Close()
-
-	w := csv.NewWriter(f)
-	// Set custom delimiter if specified.
-	if delim != "" {
-		// Tab is a special word. If a word "tab" is defined, use tab.
-		if delim == "tab" {
-			w.Comma = rune('\t')
-		} else {
-			w.Comma = rune(delim[0])
+	if len(conf.Converters) != 0 {
+		var types = make(map[string]Converter, len(conf.Converters))
+		for ftype, conv := range conf.Converters {
+			types[strings.ToUpper(ftype)] = conv
 		}
+		conf.Converters = types
 	}
+	return checkMetadata(*conf)
+}
 
-	w.WriteAll(lines)
-	return nil
+// Mappings each type can have in TypeMapping.
+var typeMappings = map[string][]string{
+	"TIMESTAMP":  {MapEpoch, MapRFC3339},
+	"NUMERIC":    {MapString, MapNumber, MapBigRat, MapFloat},
+	"BIGNUMERIC": {MapString, MapNumber, MapBigRat, MapFloat},
+	"BYTES":      {MapBase64, MapRaw},
+	"JSON":       {MapString},
+	"INTERVAL":   {MapString, MapISO8601},
 }
 
-// Convert rows and field names returned from BigQuery into map of interface.
-func toRows(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) ([]map[string]interface{}, error) {
-	// Get list of field names first.
-	var names []fieldType
-	var name, ftype string
-	for _, field := range fields {
-		name, ftype = walkFields("", field)
-		names = append(names, fieldType{name: name, ftype: ftype})
+// Check types and values of a TypeMapping, an empty value is the default.
+func checkTypeMapping(mapping map[string]string) error {
+	for ftype, value := range mapping {
+		values, ok := typeMappings[ftype]
+		if !ok {
+			return fmt.Errorf("Unsupported TypeMapping type %s", ftype)
+		}
+		var valid = value == ""
+		for _, v := range values {
+			valid = valid || v == value
+		}
+		if !valid {
+			return fmt.Errorf("Unsupported TypeMapping %s for %s", value, ftype)
+		}
 	}
+	return nil
+}
 
-	// Now read values and save in return slice.
-	var results = make([]map[string]interface{}, 0)
-	var result map[string]interface{}
-	var i int
+// Run the dump's query, passing each page of result rows to fn.
+// If only some fields are wanted, they are read from the query's result table.
+// Returns ID of the query job, and whether the error came from fn.
+func (c *Client) sendQuery(ctx context.Context, req *bigquery.QueryRequest, conf DumpConfig, fn pageFunc) (string, bool, error) {
+	var outErr error
+	var page = func(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+		outErr = fn(fields, rows)
+		return outErr
+	}
+	var jobID string
 	var err error
-	var row *bigquery.TableRow
-	var cell *bigquery.TableCell
-	var ival int64
-	var fval float64
-	var bval bool
-	for _, row = range rows {
-		result = make(map[string]interface{}, len(row.F))
-		for i, cell = range row.F {
-			// If the cell value is null, just save the field name
-			// with null value.
-			if cell.V == nil {
-				result[names[i].name] = nil
-				continue
-			}
-
-			// What type of data is it?
-			switch names[i].ftype {
-			case "STRING":
-				result[names[i].name] = cell.V
-			case "INTEGER", "TIMESTAMP":
-				if ival, err = strconv.ParseInt(cell.V.(string), 10, 64); err != nil {
-					return nil, fmt.Errorf("Invalid %s value (%s) - %s", names[i].name, cell.V, err)
-				}
-				result[names[i].name] = ival
-			case "FLOAT":
-				if fval, err = strconv.ParseFloat(cell.V.(string), 64); err != nil {
-					return nil, fmt.Errorf("Invalid %s value (%s) - %s", names[i].name, cell.V, err)
-				}
-				result[names[i].name] = fval
-			case "BOOLEAN":
-				if bval, err = strconv.ParseBool(cell.V.(string)); err != nil {
-					return nil, fmt.Errorf("Invalid %s value (%s) - %s", names[i].name, cell.V, err)
-				}
-				result[names[i].name] = bval
-			default:
-				return nil, fmt.Errorf("Unsupported field type %s on %s", names[i].ftype, names[i].name)
-			}
-		}
-		results = append(results, result)
+	if len(conf.Fields) != 0 {
+		jobID, err = c.selectedQuery(ctx, req, conf.Fields, conf.PageSize, page)
+	} else {
+		jobID, err = c.runQuery(ctx, req, conf.PageSize, page)
 	}
-
-	return results, nil
+	return jobID, outErr != nil, err
 }
 
-// Walk through the given schema recursively until there's no more nested loop inside.
-// Returns field name and field type.
-func walkFields(prefix string, schema *bigquery.TableFieldSchema) (string, string) {
-	if schema.Type != "RECORD" {
-		// No nested field inside, return this one.
-		if prefix == "" {
-			return schema.Name, schema.Type
-		} else {
-			return prefix + "." + schema.Name, schema.Type
-		}
+// Run the query and pass each page of result rows with their schema to fn,
+// at least once even if there are no rows.
+// If pageSize is set, at most that many rows are requested at a time.
+// Returns ID of the query job, and sets req.Location to where it ran.
+func (c *Client) runQuery(ctx context.Context, req *bigquery.QueryRequest, pageSize int64, fn pageFunc) (string, error) {
+	// Send it.
+	if pageSize > 0 {
+		req.MaxResults = pageSize
 	}
-
-	for _, field := range schema.Fields {
-		return walkFields(field.Name, field)
+	if err := c.checkQueryGuardrails(ctx, req); err != nil {
+		return "", err
 	}
-
-	return "", ""
+	ctx, end, err := c.begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer end()
+	release, err := c.acquireJob(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	res, err := c.bq.Jobs.Query(c.ProjectID, req).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("Error sending request - %s", err)
+	}
+	if res.JobReference != nil {
+		c.journalJob(&bigquery.Job{
+			JobReference:  res.JobReference,
+			Configuration: &bigquery.JobConfiguration{Query: &bigquery.JobConfigurationQuery{}},
+			Status:        &bigquery.JobStatus{State: "RUNNING"},
+		})
+	}
+
+	// The job runs where BigQuery put it, which is where it's looked up.
+	// req tells the caller where that is.
+	var location = req.Location
+	if res.JobReference != nil && res.JobReference.Location != "" {
+		location = res.JobReference.Location
+	}
+	req.Location = location
+
+	// Verify response.
+	if len(res.Errors) != 0 {
+		var jid string
+		if res.JobReference != nil {
+			jid = res.JobReference.JobId
+		}
+		c.auditJobID(location, jid, res.Errors)
+		return jid, newJobError(jid, nil, res.Errors)
+	}
+
+	var jobID = res.JobReference.JobId
+	var schema, rows, token = res.Schema, res.Rows, res.PageToken
+	defer func() {
+		if ctx.Err() != nil {
+			c.cancelJob(location, jobID)
+		}
+	}()
+
+	// If the query didn't finish within the request's timeout, the job keeps running
+	// and there are no schema or rows yet. Wait for it by asking for the results
+	// until the job is complete.
+	var complete = res.JobComplete
+	for !complete {
+		call := c.bq.Jobs.GetQueryResults(c.ProjectID, jobID)
+		call.Location(location).Context(ctx)
+		if pageSize > 0 {
+			call.MaxResults(pageSize)
+		}
+		res, err := call.Do()
+		if err != nil {
+			return jobID, fmt.Errorf("Error getting query results - %s", err)
+		}
+		if len(res.Errors) != 0 {
+			c.auditJobID(location, jobID, res.Errors)
+			return jobID, newJobError(jobID, nil, res.Errors)
+		}
+		complete = res.JobComplete
+		schema, rows, token = res.Schema, res.Rows, res.PageToken
+	}
+
+	c.auditJobID(location, jobID, nil)
+	release()
+
+	// Make sure we got rows.
+	if schema == nil {
+		return jobID, errors.New("Error getting reply, no schema data returned")
+	}
+	var fields = schema.Fields
+	if err = fn(fields, rows); err != nil {
+		return jobID, err
+	}
+
+	// Since number of rows returned from BigQuery at a time is limited, it's possible
+	// that we got only part of results. Keep requesting the next page until there's
+	// no page token, total row count is not reliable enough to decide when to stop.
+	for token != "" {
+		call := c.bq.Jobs.GetQueryResults(c.ProjectID, jobID)
+		call.Location(location).Context(ctx)
+		call.PageToken(token)
+		if pageSize > 0 {
+			call.MaxResults(pageSize)
+		}
+		res, err := call.Do()
+		if err != nil {
+			return jobID, fmt.Errorf("Error getting query results - %s", err)
+		}
+		if len(res.Errors) != 0 {
+			return jobID, newJobError(jobID, nil, res.Errors)
+		}
+		if err = fn(fields, res.Rows); err != nil {
+			return jobID, err
+		}
+		token = res.PageToken
+	}
+
+	return jobID, nil
+}
+
+// Run the query as a job, then read only the selected fields from its result table.
+// Returns ID of the query job.
+func (c *Client) selectedQuery(ctx context.Context, req *bigquery.QueryRequest, selected []string, pageSize int64, fn pageFunc) (string, error) {
+	job, err := c.runJobIn(ctx, req.Location, &bigquery.JobConfiguration{
+		Query: &bigquery.JobConfigurationQuery{
+			Query:                req.Query,
+			UseLegacySql:         req.UseLegacySql,
+			UseQueryCache:        req.UseQueryCache,
+			ConnectionProperties: req.ConnectionProperties,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	var jobID = job.JobReference.JobId
+	if job.JobReference.Location != "" {
+		req.Location = job.JobReference.Location
+	}
+	if job.Configuration == nil || job.Configuration.Query == nil || job.Configuration.Query.DestinationTable == nil {
+		return jobID, errors.New("Error getting reply, no result table returned")
+	}
+	return jobID, c.tableData(ctx, job.Configuration.Query.DestinationTable, selected, pageSize, fn)
+}
+
+// Replace numeric values with their formatted representation, as set in conf.
+// Floats become json.Number so json output keeps them as numbers.
+// Integers are always written in decimal, IntegerAsString only changes json output.
+func formatNumbers(data []map[string]interface{}, conf DumpConfig) {
+	var nf = newNumberFormat(conf)
+	if !nf.intString && !nf.float {
+		return
+	}
+
+	for _, row := range data {
+		for key, val := range row {
+			row[key] = nf.format(val)
+		}
+	}
+}
+
+// Number formatting as set in DumpConfig.
+type numberFormat struct {
+	intString bool
+	float     bool
+	verb      byte
+	prec      int
+}
+
+func newNumberFormat(conf DumpConfig) numberFormat {
+	var nf = numberFormat{
+		intString: conf.IntegerAsString,
+		float:     conf.FloatFormat != "" || conf.FloatDigits > 0,
+		verb:      'g',
+		prec:      -1,
+	}
+
+	// Pick format and precision for strconv.
+	switch conf.FloatFormat {
+	case FloatDecimal:
+		nf.verb = 'f'
+	case FloatExponent:
+		nf.verb = 'e'
+	}
+	if conf.FloatDigits > 0 {
+		nf.prec = conf.FloatDigits
+		if nf.verb == 'g' {
+			nf.verb = 'f'
+		}
+	}
+	return nf
+}
+
+// Formatted representation of a value, or the value itself if it isn't
+// a number to format.
+func (nf numberFormat) format(val interface{}) interface{} {
+	switch v := val.(type) {
+	case int64:
+		if nf.intString {
+			return strconv.FormatInt(v, 10)
+		}
+	case float64:
+		if nf.float {
+			return json.Number(strconv.FormatFloat(v, nf.verb, nf.prec, 64))
+		}
+	}
+	return val
+}
+
+// Csv layouts of time values as set in DumpConfig, by field type.
+type timeFormat struct {
+	layouts map[string]string
+	loc     *time.Location
+}
+
+func newTimeFormat(conf DumpConfig) timeFormat {
+	var tf = timeFormat{layouts: make(map[string]string, 3), loc: time.UTC}
+	if conf.TimeZone != "" {
+		// Checked by checkDumpConfig.
+		if loc, err := time.LoadLocation(conf.TimeZone); err == nil {
+			tf.loc = loc
+		}
+		tf.layouts["TIMESTAMP"] = time.RFC3339
+	}
+	for ftype, layout := range map[string]string{
+		"TIMESTAMP": conf.TimestampLayout,
+		"DATE":      conf.DateLayout,
+		"DATETIME":  conf.DatetimeLayout,
+	} {
+		if layout != "" {
+			tf.layouts[ftype] = layout
+		}
+	}
+	return tf
+}
+
+// Value of a time cell in its layout. ok is false if the field isn't
+// formatted.
+func (tf timeFormat) format(field fieldType, v interface{}) (val interface{}, ok bool, err error) {
+	var layout = tf.layouts[field.ftype]
+	s, isString := v.(string)
+	if layout == "" || !isString {
+		return nil, false, nil
+	}
+
+	var t time.Time
+	switch field.ftype {
+	case "TIMESTAMP":
+		if t, err = parseTimestamp(s); err == nil {
+			t = t.In(tf.loc)
+		}
+	case "DATE":
+		t, err = time.Parse("2006-01-02", s)
+	case "DATETIME":
+		t, err = time.Parse("2006-01-02T15:04:05.999999999", s)
+	}
+	if err != nil {
+		return nil, true, fmt.Errorf("Invalid %s value (%s) - %s", field.name, s, err)
+	}
+	return t.Format(layout), true, nil
+}
+
+// Generate a file name for the n'th split output.
+// "output.json" becomes "output-00001.json", "output-00002.json", etc.
+func splitName(output string, n int) string {
+	ext := filepath.Ext(output)
+	return fmt.Sprintf("%s-%05d%s", strings.TrimSuffix(output, ext), n, ext)
+}
+
+// Submit a job in the location ("" to let BigQuery pick it).
+// Returns ID of the job.
+func (c *Client) insertJob(ctx context.Context, location string, conf *bigquery.JobConfiguration) (string, error) {
+	if err := c.checkGuardrails(ctx, location, conf); err != nil {
+		return "", err
+	}
+	res, err := c.bq.Jobs.Insert(c.ProjectID, &bigquery.Job{
+		JobReference:  &bigquery.JobReference{ProjectId: c.ProjectID, Location: location},
+		Configuration: conf,
+	}).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("Error sending request - %s", err)
+	}
+	c.journalJob(res)
+	return res.JobReference.JobId, nil
+}
+
+// Submit a job in the client's location and wait until it's done.
+func (c *Client) runJob(conf *bigquery.JobConfiguration) (*bigquery.Job, error) {
+	return c.runJobIn(context.Background(), c.Location, conf)
+}
+
+// Submit a job in the location and wait until it's done or ctx is.
+func (c *Client) runJobIn(ctx context.Context, location string, conf *bigquery.JobConfiguration) (*bigquery.Job, error) {
+	ctx, end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	release, err := c.acquireJob(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	jid, err := c.insertJob(ctx, location, conf)
+	if err != nil {
+		return nil, err
+	}
+	return c.waitJob(ctx, location, jid)
+}
+
+// Poll the job in the location until it's done, then return its final status.
+// Waiting stops when ctx is done.
+func (c *Client) waitJob(ctx context.Context, location, jid string) (*bigquery.Job, error) {
+	tick := time.NewTicker(3 * time.Second)
+	defer tick.Stop()
+	var done bool
+	var job *bigquery.Job
+	var err error
+	for !done {
+		select {
+		case <-ctx.Done():
+			c.cancelJob(location, jid)
+			return nil, fmt.Errorf("Stopped waiting for job %s - %s", jid, ctx.Err())
+		case <-tick.C:
+		}
+		if job, done, err = c.jobDone(ctx, location, jid); err != nil {
+			return nil, err
+		}
+	}
+	return job, nil
+}
+
+// Cancel the job if the client is set to, since whoever waited for it is gone.
+func (c *Client) cancelJob(location, jid string) {
+	if c.CancelJobs && jid != "" {
+		c.bq.Jobs.Cancel(c.ProjectID, jid).Location(location).Do()
+	}
+}
+
+// Check status of the requested job.
+// The job is returned as well so callers can look at its statistics once done.
+func (c *Client) jobDone(ctx context.Context, location, jid string) (*bigquery.Job, bool, error) {
+	// Send the Job status call.
+	call := c.bq.Jobs.Get(c.ProjectID, jid).Location(location).Context(ctx)
+	res, err := call.Do()
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch res.Status.State {
+	case "PENDING", "RUNNING":
+		// Errors reported while running are not final, the job decides
+		// whether it failed only when it's done.
+		return res, false, nil
+	case "DONE":
+		c.auditJob(res)
+
+		// If there was an application error from BigQuery, the error will not be set in error
+		// from the library's Do() call (FML).
+		// The job failed only if ErrorResult is set, Errors alone are things like
+		// bad records skipped within the allowed limit.
+		if res.Status.ErrorResult != nil {
+			jerr := newJobError(jid, res.Status.ErrorResult, res.Status.Errors)
+			if res.Statistics != nil && res.Statistics.Load != nil {
+				jerr.BadRecords = res.Statistics.Load.BadRecords
+			}
+			return nil, false, jerr
+		}
+		return res, true, nil
+	}
+
+	return nil, false, fmt.Errorf("Unknown job status returned - %s (%s,%s)",
+		res.Status.State, c.ProjectID, jid)
+}
+
+// Build a JobError from errors BigQuery returned for the job.
+func newJobError(jid string, result *bigquery.ErrorProto, errs []*bigquery.ErrorProto) *JobError {
+	var jerr = &JobError{JobID: jid}
+	if result != nil {
+		jerr.Result = toJobErrorItem(result)
+	} else if len(errs) != 0 {
+		jerr.Result = toJobErrorItem(errs[0])
+	}
+	for _, e := range errs {
+		jerr.Errors = append(jerr.Errors, toJobErrorItem(e))
+	}
+	return jerr
+}
+
+func toJobErrorItem(e *bigquery.ErrorProto) JobErrorItem {
+	return JobErrorItem{Reason: e.Reason, Message: e.Message, Location: e.Location}
+}
+
+func newChecksumWriter() *checksumWriter {
+	return &checksumWriter{
+		crc: crc32.New(crc32.MakeTable(crc32.Castagnoli)),
+		md5: md5.New(),
+	}
+}
+
+// Add data to the checksums.
+func (w *checksumWriter) Write(p []byte) (int, error) {
+	w.crc.Write(p)
+	w.md5.Write(p)
+	w.size += int64(len(p))
+	return len(p), nil
+}
+
+// Size and checksums of everything written so far.
+// CRC32C and MD5 are kept in the same format GCS reports them in.
+func (w *checksumWriter) checksum() checksum {
+	return checksum{
+		size:   w.size,
+		crc32c: w.crc.Sum32(),
+		md5:    base64.StdEncoding.EncodeToString(w.md5.Sum(nil)),
+	}
+}
+
+// Add up the size of data written to it.
+func (w *sizeWriter) Write(p []byte) (int, error) {
+	*w += sizeWriter(len(p))
+	return len(p), nil
+}
+
+// Compare the size of what we uploaded with the bytes the finished load job
+// read, the only thing BigQuery reports about the data it got.
+func verifyLoad(source string, size int64, job *bigquery.Job) error {
+	var ierr = &IntegrityError{Source: source, SentBytes: size}
+	if job == nil || job.Statistics == nil || job.Statistics.Load == nil {
+		ierr.Reason = "no load statistics returned"
+		return ierr
+	}
+	if job.Statistics.Load.InputFileBytes != size {
+		ierr.Reason = "size mismatch"
+		ierr.ReceivedBytes = job.Statistics.Load.InputFileBytes
+		return ierr
+	}
+	return nil
+}
+
+// Encryption configuration for tables created by the client's jobs.
+// nil if no key is set.
+func (c *Client) encryption() *bigquery.EncryptionConfiguration {
+	if c.KMSKeyName == "" {
+		return nil
+	}
+	return &bigquery.EncryptionConfiguration{KmsKeyName: c.KMSKeyName}
+}
+
+// Error of a response that isn't OK, with all errors in its body.
+// The body is closed.
+func newUploadError(res *http.Response) *UploadError {
+	defer res.Body.Close()
+	var uerr = &UploadError{Status: res.Status, StatusCode: res.StatusCode}
+	by, _ := ioutil.ReadAll(res.Body)
+	var errRes ErrorResponse
+	if err := json.Unmarshal(by, &errRes); err != nil {
+		// Not from BigQuery, e.g. a proxy.
+		if len(by) > 512 {
+			by = by[:512]
+		}
+		uerr.Message = strings.TrimSpace(string(by))
+		return uerr
+	}
+	uerr.Message = errRes.Error.Message
+	uerr.Errors = errRes.Error.Errors
+	return uerr
+}
+
+// Load job format of the source, "" if it's not supported.
+func loadFormat(conf LoadConfig, source string) string {
+	switch {
+	case conf.SourceFormat == "json", conf.SourceFormat == "" && strings.HasSuffix(source, ".json"):
+		return "NEWLINE_DELIMITED_JSON"
+	case conf.SourceFormat == "csv", conf.SourceFormat == "" && strings.HasSuffix(source, ".csv"):
+		return "CSV"
+	}
+	return ""
+}
+
+// Read table fields from the schema file.
+func readSchema(schemaFile string) ([]TableField, error) {
+	var fields []TableField
+	by, err := ioutil.ReadFile(schemaFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading schema - %s", err)
+	}
+	if err = json.Unmarshal(by, &fields); err != nil {
+		return nil, fmt.Errorf("Error reading schema - %s", err)
+	}
+	return fields, nil
+}
+
+// Time partitioning of the load's table, nil if it isn't partitioned.
+func loadPartitioning(conf LoadConfig) *TimePartitioning {
+	if conf.Partitioning == "" {
+		return nil
+	}
+	return &TimePartitioning{
+		Type:         conf.Partitioning,
+		Field:        conf.PartitionField,
+		ExpirationMs: int64(conf.PartitionExpiration / time.Millisecond),
+	}
+}
+
+// Create a table with the schema, partitioning and expiration (none if zero).
+// If the table already exists, it's left as it is.
+func (c *Client) createTable(projectID, datasetID, tableID string, fields []TableField, partitioning *TimePartitioning, expires time.Time) error {
+	var table = &bigquery.Table{
+		TableReference: &bigquery.TableReference{
+			ProjectId: projectID,
+			DatasetId: datasetID,
+			TableId:   tableID,
+		},
+		Schema:                  &bigquery.TableSchema{Fields: fromTableFields(fields)},
+		EncryptionConfiguration: c.encryption(),
+	}
+	if !expires.IsZero() {
+		table.ExpirationTime = expires.UnixNano() / int64(time.Millisecond)
+	}
+	if partitioning != nil {
+		table.TimePartitioning = &bigquery.TimePartitioning{
+			Type:         partitioning.Type,
+			Field:        partitioning.Field,
+			ExpirationMs: partitioning.ExpirationMs,
+		}
+	}
+
+	_, err := c.bq.Tables.Insert(projectID, datasetID, table).Do()
+	if err != nil && !isHTTPError(err, http.StatusConflict) {
+		return fmt.Errorf("Error creating table - %s", err)
+	}
+	return nil
+}
+
+// Check if requested dataset exists under the project and create the dataset
+// if it doesn't exist yet and create is set.
+//
+// Concurrent calls for the same dataset and create share a single check, and
+// a dataset created by someone else in the meantime is not an error.
+func (c *Client) checkDataset(projectID, datasetID string, create bool) error {
+	var key = projectID + "." + datasetID + "." + strconv.FormatBool(create)
+	_, err, _ := c.datasets.Do(key, func() (interface{}, error) {
+		_, err := c.bq.Datasets.Get(projectID, datasetID).Do()
+		if err == nil {
+			// The dataset already exists, no need to create.
+			return nil, nil
+		}
+		if !isHTTPError(err, http.StatusNotFound) {
+			return nil, fmt.Errorf("Error checking dataset - %s", err)
+		}
+		if !create {
+			return nil, fmt.Errorf("Dataset %s not found", datasetID)
+		}
+
+		// Dataset not exist, need to create.
+		createReq := c.bq.Datasets.Insert(projectID, &bigquery.Dataset{
+			DatasetReference: &bigquery.DatasetReference{DatasetId: datasetID},
+			Location:         c.Location,
+		})
+		if _, err := createReq.Do(); err != nil && !isHTTPError(err, http.StatusConflict) {
+			return nil, err
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// Create a client for the project, using the JWT file for credentials.
+// If proxy is set, it'll be used for the requests.
+func NewClient(projectID, jwtFile, proxy string) (*Client, error) {
+	return NewClientWithTransport(projectID, jwtFile, TransportConfig{Proxy: proxy})
+}
+
+// Create a client for the project with the given HTTP transport settings.
+// Clients with the same settings share connections.
+// Project, JWT file, proxy and the client's location default to the
+// BQWRAPPER_PROJECT, BQWRAPPER_CREDENTIALS, BQWRAPPER_PROXY and
+// BQWRAPPER_LOCATION environment variables.
+func NewClientWithTransport(projectID, jwtFile string, tc TransportConfig) (*Client, error) {
+	envDefault(&projectID, envProject)
+	envDefault(&jwtFile, envCredentials)
+	envDefault(&tc.Proxy, envProxy)
+	if projectID == "" || jwtFile == "" {
+		return nil, errors.New("missing params")
+	}
+
+	// Start BigQuery service.
+	client, transport, err := oauthClient(jwtFile, tc)
+	if err != nil {
+		return nil, err
+	}
+	bq, err := bigquery.New(client)
+	if err != nil {
+		releaseTransport(transport)
+		return nil, err
+	}
+
+	var c = &Client{ProjectID: projectID, client: client, bq: bq, transport: transport}
+	envDefault(&c.Location, envLocation)
+	return c, nil
+}
+
+// Check whether the error is an API error with the given HTTP status code.
+func isHTTPError(err error, code int) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == code
+}
+
+// Parse JWT file and initiate http.Client with it, along with the transport
+// under it.
+func oauthClient(jwtFile string, tc TransportConfig) (*http.Client, *http.Transport, error) {
+	// Parse JWT file and set up credentials.
+	by, err := ioutil.ReadFile(jwtFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	conf, err := google.JWTConfigFromJSON(by, bigquery.BigqueryScope, storageScope, pubsubScope, sheetsScope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	transport, err := sharedTransport(tc)
+	if err != nil {
+		return nil, nil, err
+	}
+	var headers = &headerTransport{base: transport, userAgent: tc.UserAgent, quotaProject: tc.QuotaProject}
+	if headers.userAgent == "" {
+		headers.userAgent = "bqwrapper/" + Version
+	}
+	var ctx = context.WithValue(oauth2.NoContext, oauth2.HTTPClient, &http.Client{Transport: headers})
+	return conf.Client(ctx), transport, nil
+}
+
+// Send the request with the transport's headers set.
+// The request is cloned, since a RoundTripper must not change it.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	if t.quotaProject != "" {
+		req.Header.Set("X-Goog-User-Project", t.quotaProject)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Transport with the given settings, shared by clients with the same settings
+// so connections are reused instead of each client opening its own.
+// Clients don't affect each other through the environment, e.g. the proxy is
+// set on the transport rather than through HTTP_PROXY.
+// Each client using it releases it with releaseTransport.
+func sharedTransport(tc TransportConfig) (*http.Transport, error) {
+	// Headers are not set by the transport.
+	tc.UserAgent, tc.QuotaProject = "", ""
+
+	transports.Lock()
+	defer transports.Unlock()
+	if t, ok := transports.m[tc]; ok {
+		transports.users[t]++
+		return t, nil
+	}
+
+	var t = http.DefaultTransport.(*http.Transport).Clone()
+	if tc.Proxy != "" {
+		u, err := url.Parse(tc.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid proxy - %s", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+	t.MaxIdleConns = defaultMaxIdleConns
+	if tc.MaxIdleConns > 0 {
+		t.MaxIdleConns = tc.MaxIdleConns
+	}
+	t.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	if tc.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = tc.MaxIdleConnsPerHost
+	}
+	t.MaxConnsPerHost = tc.MaxConnsPerHost
+	if tc.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = tc.IdleConnTimeout
+	}
+	if tc.DisableHTTP2 {
+		// A non-nil empty map is what turns HTTP/2 off.
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if transports.m == nil {
+		transports.m = make(map[TransportConfig]*http.Transport)
+		transports.users = make(map[*http.Transport]int)
+	}
+	transports.m[tc] = t
+	transports.users[t]++
+	return t, nil
+}
+
+// Stop using a transport of sharedTransport. Its idle connections are closed
+// once no client uses it, and clients created after that get a new one.
+func releaseTransport(t *http.Transport) {
+	transports.Lock()
+	if transports.users[t]--; transports.users[t] > 0 {
+		transports.Unlock()
+		return
+	}
+	delete(transports.users, t)
+	for tc, st := range transports.m {
+		if st == t {
+			delete(transports.m, tc)
+		}
+	}
+	transports.Unlock()
+	t.CloseIdleConnections()
+}
+
+// Quote and escape a single csv field.
+//
+// QuoteAlways quotes every field, QuoteMinimal only the ones containing the delimiter,
+// quotes, newlines or leading space. Quotes inside a quoted field are doubled, or
+// prefixed with escape if set.
+// QuoteNone never quotes. If escape is set, the delimiter, newlines and the escape
+// itself are prefixed with it, otherwise the field is written as is.
+func csvField(field string, comma rune, mode, escape string) string {
+	if mode == QuoteNone {
+		if escape == "" {
+			return field
+		}
+		var buf strings.Builder
+		for _, r := range field {
+			if r == comma || r == '\n' || r == '\r' || string(r) == escape {
+				buf.WriteString(escape)
+			}
+			buf.WriteRune(r)
+		}
+		return buf.String()
+	}
+
+	if mode != QuoteAlways && field != "" &&
+		!strings.ContainsRune(field, comma) && !strings.ContainsAny(field, "\"\r\n") &&
+		field[0] != ' ' && field[0] != '\t' {
+		return field
+	}
+
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range field {
+		switch {
+		case r == '"' && escape == "":
+			buf.WriteString(`""`)
+		case r == '"' || string(r) == escape:
+			buf.WriteString(escape)
+			buf.WriteRune(r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// Convert rows and field names returned from BigQuery into map of interface.
+// The mapping sets how values of some types are represented, see DumpConfig.TypeMapping.
+// RECORDs become nested maps, or with flatten, values of their fields are
+// keyed by their path (e.g. "addr.city"), see resultColumns.
+// If t is set, a row failing conversion is reported with its place in the
+// results, or skipped.
+func toRows(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow, mapping map[string]string, conv converters, flatten bool, t *rowTracker) ([]map[string]interface{}, error) {
+	// Get list of columns first.
+	var cols = resultColumns(fields, flatten)
+
+	// Now read values and save in return slice.
+	// Row maps come from rowPool, where releaseRows puts them back.
+	var results = make([]map[string]interface{}, 0, len(rows))
+	var result map[string]interface{}
+	var err error
+	var col fieldType
+	for n, row := range rows {
+		result = rowPool.Get().(map[string]interface{})
+		for _, col = range cols {
+			if result[col.name], err = convertValue(col, col.value(row), mapping, conv); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			releaseRows([]map[string]interface{}{result})
+			if t == nil {
+				releaseRows(results)
+				return nil, err
+			}
+			if err = t.badRow(row, n, err); err != nil {
+				releaseRows(results)
+				return nil, err
+			}
+			continue
+		}
+		results = append(results, result)
+	}
+	if t != nil {
+		t.pageDone(len(rows))
+	}
+
+	return results, nil
+}
+
+// Columns of results with the schema: top level fields, or if flatten is
+// set, fields nested in RECORDs named by their path (e.g. "addr.city").
+// REPEATED fields are never flattened.
+func resultColumns(fields []*bigquery.TableFieldSchema, flatten bool) []fieldType {
+	return appendColumns(nil, fields, "", nil, flatten)
+}
+
+func appendColumns(cols []fieldType, fields []*bigquery.TableFieldSchema, prefix string, path []int, flatten bool) []fieldType {
+	for i, field := range fields {
+		var fpath = append(append([]int(nil), path...), i)
+		if flatten && isRecord(field.Type) && field.Mode != "REPEATED" {
+			cols = appendColumns(cols, field.Fields, prefix+field.Name+".", fpath, flatten)
+			continue
+		}
+		cols = append(cols, fieldType{name: prefix + field.Name, ftype: field.Type, field: field, path: fpath})
+	}
+	return cols
+}
+
+// Whether the field type is a RECORD.
+func isRecord(ftype string) bool {
+	return ftype == "RECORD" || ftype == "STRUCT"
+}
+
+// Value of the column's cell in the row, nil if it or a RECORD it's in is null.
+func (col fieldType) value(row *bigquery.TableRow) interface{} {
+	if len(col.path) == 0 || col.path[0] >= len(row.F) {
+		return nil
+	}
+	var v = row.F[col.path[0]].V
+	for _, i := range col.path[1:] {
+		v = recordField(v, i)
+	}
+	return v
+}
+
+// Value of the i'th field of a RECORD value ({"f": [{"v": ...}, ...]}).
+func recordField(v interface{}, i int) interface{} {
+	rec, _ := v.(map[string]interface{})
+	cells, _ := rec["f"].([]interface{})
+	if i >= len(cells) {
+		return nil
+	}
+	cell, _ := cells[i].(map[string]interface{})
+	return cell["v"]
+}
+
+// Convert a value of the column, RECORDs to maps and REPEATED fields to
+// slices.
+func convertValue(col fieldType, v interface{}, mapping map[string]string, conv converters) (interface{}, error) {
+	if v == nil || col.field == nil || col.field.Mode != "REPEATED" {
+		return convertRecord(col, v, mapping, conv)
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Invalid %s value (%v) - not a list", col.name, v)
+	}
+	var result = make([]interface{}, len(list))
+	var err error
+	for i, item := range list {
+		cell, _ := item.(map[string]interface{})
+		if result[i], err = convertRecord(col, cell["v"], mapping, conv); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Convert a single value of the column, a RECORD to a map of its fields,
+// with the converter of the dump for it if any.
+func convertRecord(col fieldType, v interface{}, mapping map[string]string, conv converters) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if c := conv.lookup(col.name, col.ftype); c != nil {
+		val, err := convertWith(c, col, v)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value (%v) - %s", col.name, v, err)
+		}
+		return val, nil
+	}
+	if col.field == nil || !isRecord(col.ftype) {
+		return convertCell(col, v, mapping)
+	}
+	var result = make(map[string]interface{}, len(col.field.Fields))
+	var err error
+	for i, sub := range col.field.Fields {
+		var sc = fieldType{name: col.name + "." + sub.Name, ftype: sub.Type, field: sub}
+		if result[sub.Name], err = convertValue(sc, recordField(v, i), mapping, conv); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Convert a cell value of the field to its Go type.
+// mapping sets how TIMESTAMP, NUMERIC/BIGNUMERIC, BYTES, INTERVAL and JSON
+// values are converted.
+func convertCell(field fieldType, v interface{}, mapping map[string]string) (interface{}, error) {
+	// If the cell value is null, just keep it null.
+	if v == nil {
+		return nil, nil
+	}
+
+	// What type of data is it?
+	switch field.ftype {
+	case "STRING", "DATE", "DATETIME", "TIME":
+		return v, nil
+	case "INTEGER":
+		ival, err := strconv.ParseInt(v.(string), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value (%s) - %s", field.name, v, err)
+		}
+		return ival, nil
+	case "TIMESTAMP":
+		tval, err := parseTimestamp(v.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value (%s) - %s", field.name, v, err)
+		}
+		if mapping["TIMESTAMP"] == MapRFC3339 {
+			return tval.UTC().Format(time.RFC3339Nano), nil
+		}
+		return tval.Unix(), nil
+	case "NUMERIC", "BIGNUMERIC":
+		// Values are exact unless asked for floats.
+		switch mapping[field.ftype] {
+		case MapFloat:
+			fval, err := strconv.ParseFloat(v.(string), 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s value (%s) - %s", field.name, v, err)
+			}
+			return fval, nil
+		case MapNumber, MapBigRat:
+			dval, ok := parseDecimal(v.(string))
+			if !ok {
+				return nil, fmt.Errorf("Invalid %s value (%s) - not a number", field.name, v)
+			}
+			if mapping[field.ftype] == MapNumber {
+				return json.Number(v.(string)), nil
+			}
+			return dval, nil
+		}
+		return v, nil
+	case "BYTES":
+		if mapping["BYTES"] != MapRaw {
+			return v, nil
+		}
+		by, err := base64.StdEncoding.DecodeString(v.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value (%s) - %s", field.name, v, err)
+		}
+		return string(by), nil
+	case "FLOAT":
+		fval, err := strconv.ParseFloat(v.(string), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value (%s) - %s", field.name, v, err)
+		}
+		return fval, nil
+	case "BOOLEAN":
+		bval, err := strconv.ParseBool(v.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value (%s) - %s", field.name, v, err)
+		}
+		return bval, nil
+	case "INTERVAL":
+		if mapping["INTERVAL"] != MapISO8601 {
+			return v, nil
+		}
+		ival, err := intervalISO(v.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value (%s) - %s", field.name, v, err)
+		}
+		return ival, nil
+	case "RANGE":
+		rval, err := parseRange(v.(string))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s value (%s) - %s", field.name, v, err)
+		}
+		return rval, nil
+	case "JSON":
+		// The value is json text, written as it is.
+		if mapping["JSON"] == MapString {
+			return v, nil
+		}
+		if !json.Valid([]byte(v.(string))) {
+			return nil, fmt.Errorf("Invalid %s value (%s) - not json", field.name, v)
+		}
+		return json.RawMessage(v.(string)), nil
+	}
+	return nil, fmt.Errorf("Unsupported field type %s on %s", field.ftype, field.name)
+}
+
+// Give rows returned by toRows back for reuse.
+// They must not be used afterwards.
+func releaseRows(rows []map[string]interface{}) {
+	for _, row := range rows {
+		for k := range row {
+			delete(row, k)
+		}
+		rowPool.Put(row)
+	}
+}
+
+// Parse a TIMESTAMP value, which BigQuery returns as seconds since epoch
+// in float notation (e.g. "1.4084520952E9"). The digits are parsed as
+// integers, since a float64 of current epochs can be off by a microsecond.
+func parseTimestamp(val string) (time.Time, error) {
+	var digits, exp = val, 0
+	if i := strings.IndexAny(val, "eE"); i >= 0 {
+		var err error
+		if exp, err = strconv.Atoi(val[i+1:]); err != nil || exp > 20 || exp < -20 {
+			return time.Time{}, fmt.Errorf("Invalid timestamp %s", val)
+		}
+		digits = val[:i]
+	}
+	var neg = strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "-")
+
+	// Move the point by the exponent, then split seconds and nanoseconds.
+	var point = strings.IndexByte(digits, '.')
+	if point < 0 {
+		point = len(digits)
+	} else {
+		digits = digits[:point] + digits[point+1:]
+	}
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return time.Time{}, fmt.Errorf("Invalid timestamp %s", val)
+	}
+	point += exp
+	if point < 0 {
+		digits, point = strings.Repeat("0", -point)+digits, 0
+	}
+	if point > len(digits) {
+		digits += strings.Repeat("0", point-len(digits))
+	}
+	var frac = digits[point:] + "000000000"
+	sec, err := strconv.ParseInt("0"+digits[:point], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid timestamp %s", val)
+	}
+	nsec, _ := strconv.ParseInt(frac[:9], 10, 64)
+	if neg {
+		sec, nsec = -sec, -nsec
+	}
+	return time.Unix(sec, nsec), nil
 }
@@ -0,0 +1,248 @@
+package bqwrapper
+
+import (
+	"context"
+	"encoding/json"
+	"google.golang.org/api/bigquery/v2"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func BenchmarkToRows(b *testing.B) {
+	var fields, rows = testSchema(), testRows(0, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := toRows(fields, rows, nil, converters{}, false, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		releaseRows(result)
+	}
+}
+
+func BenchmarkToRowsFlatten(b *testing.B) {
+	var fields, rows = testSchema(), testRows(0, 1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := toRows(fields, rows, map[string]string{"TIMESTAMP": MapRFC3339}, converters{}, true, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		releaseRows(result)
+	}
+}
+
+// Query results served in pages: by page token, the rows and next token.
+type pagedResults struct {
+	t        *testing.T
+	complete bool
+	pages    map[string]int
+	next     map[string]string
+
+	mu        sync.Mutex
+	requested map[string]int
+}
+
+func (p *pagedResults) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var token = r.URL.Query().Get("pageToken")
+	if r.URL.Query().Get("startIndex") != "" {
+		p.t.Errorf("startIndex sent with page token %q", token)
+	}
+	var res = &bigquery.QueryResponse{
+		JobReference: &bigquery.JobReference{ProjectId: "test", JobId: "job", Location: "EU"},
+		JobComplete:  true,
+		Schema:       &bigquery.TableSchema{Fields: testSchema()},
+		TotalRows:    10,
+	}
+	switch {
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/projects/test/queries"):
+		if !p.complete {
+			// Results are read with getQueryResults once the job is done.
+			res.JobComplete, res.Schema = false, nil
+			writeJSON(w, res)
+			return
+		}
+	case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/projects/test/queries/job"):
+		if loc := r.URL.Query().Get("location"); loc != "EU" {
+			p.t.Errorf("results read in location %q", loc)
+		}
+	default:
+		p.t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+		return
+	}
+
+	p.mu.Lock()
+	p.requested[token]++
+	var n = p.requested[token]
+	p.mu.Unlock()
+	if n > 1 {
+		p.t.Errorf("page %q requested %d times", token, n)
+	}
+	res.Rows = testRows(0, p.pages[token])
+	res.PageToken = p.next[token]
+	writeJSON(w, res)
+}
+
+func TestRunQueryPaging(t *testing.T) {
+	for _, complete := range []bool{true, false} {
+		// A short first page, an empty one that still has a token, then the
+		// rest up to the last page without a token.
+		var p = &pagedResults{
+			t:         t,
+			complete:  complete,
+			pages:     map[string]int{"": 2, "a": 0, "b": 3, "c": 5},
+			next:      map[string]string{"": "a", "a": "b", "b": "c", "c": ""},
+			requested: map[string]int{},
+		}
+		var c = newTestClient(t, p)
+		var rows, calls int
+		_, err := c.runQuery(context.Background(), &bigquery.QueryRequest{Query: "SELECT 1", Location: "EU"}, 5,
+			func(fields []*bigquery.TableFieldSchema, page []*bigquery.TableRow) error {
+				if len(fields) != len(testSchema()) {
+					t.Errorf("got %d fields", len(fields))
+				}
+				rows += len(page)
+				calls++
+				return nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows != 10 || calls != 4 {
+			t.Errorf("complete=%v: got %d rows in %d pages, want 10 in 4", complete, rows, calls)
+		}
+		for token := range p.next {
+			if p.requested[token] != 1 {
+				t.Errorf("complete=%v: page %q requested %d times", complete, token, p.requested[token])
+			}
+		}
+	}
+}
+
+func TestDumpSample(t *testing.T) {
+	var queries []string
+	var c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req bigquery.QueryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		queries = append(queries, req.Query)
+		writeJSON(w, &bigquery.QueryResponse{
+			JobReference: &bigquery.JobReference{ProjectId: "test", JobId: "job"},
+			JobComplete:  true,
+			Schema:       &bigquery.TableSchema{Fields: testSchema()},
+		})
+	}))
+	var dir = t.TempDir()
+	for _, tc := range []struct {
+		conf DumpConfig
+		want string
+	}{
+		{DumpConfig{Table: "ds.t"}, "SELECT * FROM `test.ds.t` TABLESAMPLE SYSTEM (10 PERCENT)"},
+		// Query wins over Table, so it's sampled as a query.
+		{DumpConfig{Query: "SELECT 1", Table: "ds.t"}, "SELECT * FROM (SELECT 1) WHERE RAND() < 0.1"},
+		{DumpConfig{Query: "SELECT 1"}, "SELECT * FROM (SELECT 1) WHERE RAND() < 0.1"},
+	} {
+		queries = nil
+		tc.conf.Sample, tc.conf.Format, tc.conf.Output = 10, "csv", filepath.Join(dir, "out.csv")
+		if err := c.Dump(tc.conf); err != nil {
+			t.Fatal(err)
+		}
+		if len(queries) != 1 || queries[0] != tc.want {
+			t.Errorf("%+v: got queries %q, want %q", tc.conf, queries, tc.want)
+		}
+	}
+}
+
+func TestDumpAsOfQuery(t *testing.T) {
+	var c = newTestClient(t, http.NotFoundHandler())
+	var err = c.Dump(DumpConfig{Query: "SELECT 1", Table: "ds.t", AsOf: time.Now(), Format: "csv", Output: filepath.Join(t.TempDir(), "out.csv")})
+	if err == nil || !strings.Contains(err.Error(), "AsOf") {
+		t.Errorf("got %v, want AsOf error", err)
+	}
+}
+
+func TestCheckDatasetCreate(t *testing.T) {
+	// The check without create waits until the dataset is created, which it
+	// would never be if the other check shared it.
+	var first, inserted = make(chan struct{}), make(chan struct{})
+	var c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			select {
+			case first <- struct{}{}:
+				select {
+				case <-inserted:
+					writeJSON(w, &bigquery.Dataset{})
+					return
+				case <-time.After(time.Second):
+				}
+			default:
+			}
+			http.NotFound(w, r)
+		case "POST":
+			close(inserted)
+			writeJSON(w, &bigquery.Dataset{})
+		}
+	}))
+	var errc = make(chan error)
+	go func() {
+		errc <- c.checkDataset("test", "ds", false)
+	}()
+	<-first
+	if err := c.checkDataset("test", "ds", true); err != nil {
+		t.Errorf("creating check failed - %s", err)
+	}
+	if err := <-errc; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckTypeMapping(t *testing.T) {
+	for _, tc := range []struct {
+		mapping map[string]string
+		err     string
+	}{
+		{map[string]string{"TIMESTAMP": MapRFC3339, "NUMERIC": MapBigRat, "BYTES": MapRaw, "JSON": "", "INTERVAL": MapISO8601}, ""},
+		{map[string]string{"TIMESTAMP": "rfc-3339"}, "rfc-3339"},
+		{map[string]string{"BYTES": MapFloat}, "float"},
+		{map[string]string{"DATE": MapString}, "DATE"},
+	} {
+		var err = checkDumpConfig(&DumpConfig{Output: "out.json", Format: "json", TypeMapping: tc.mapping})
+		if tc.err == "" && err != nil || tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%v: got %v, want error naming %q", tc.mapping, err, tc.err)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	for val, want := range map[string]time.Time{
+		"1.408452095123456E9":    time.Unix(1408452095, 123456000),
+		"1.7e9":                  time.Unix(1700000000, 0),
+		"1760523123.999999":      time.Unix(1760523123, 999999000),
+		"1.760523123000001E9":    time.Unix(1760523123, 1000),
+		"-1.5":                   time.Unix(-2, 500000000),
+		"0":                      time.Unix(0, 0),
+		"2.53402300799999999E11": time.Date(9999, 12, 31, 23, 59, 59, 999999000, time.UTC),
+		"80463553582.668721":     time.Unix(80463553582, 668721000),
+	} {
+		got, err := parseTimestamp(val)
+		if err != nil {
+			t.Errorf("%s: %v", val, err)
+		} else if !got.Equal(want) {
+			t.Errorf("%s: got %s, want %s", val, got.UTC(), want.UTC())
+		}
+	}
+	for _, val := range []string{"", "abc", "1.2.3", "1E", "--1"} {
+		if _, err := parseTimestamp(val); err == nil {
+			t.Errorf("%q parsed", val)
+		}
+	}
+}
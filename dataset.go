@@ -0,0 +1,231 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tables DumpDataset and LoadDataset do at once by default.
+const defaultParallelism = 4
+
+// Suffix of schema files of LoadDataset.
+const schemaSuffix = ".schema.json"
+
+// Dump each table of the dataset to its own output, several at once.
+// conf.Output names the outputs with the {{table}} variable, e.g.
+// "out/{{table}}.csv" or "gs://bucket/{{ds}}/{{table}}.json", and its other
+// options are used for every table. Tables are read with tabledata.list
+// like DumpTable, views and other tables that aren't plain tables are
+// queried if ds.Views is set and skipped otherwise.
+//
+// A table failing doesn't stop the others. Returns the result of each table
+// dumped, and a DatasetDumpError listing those that failed.
+// projectID defaults to the client's project.
+func (c *Client) DumpDataset(projectID, datasetID string, conf DumpConfig, ds DatasetDumpConfig) ([]TableDump, error) {
+	return c.DumpDatasetContext(context.Background(), projectID, datasetID, conf, ds)
+}
+
+// Dump every table of the dataset as DumpDataset does, stopping when ctx is
+// done.
+func (c *Client) DumpDatasetContext(ctx context.Context, projectID, datasetID string, conf DumpConfig, ds DatasetDumpConfig) ([]TableDump, error) {
+	c.Defaults.dump(&conf)
+	ctx, end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	if datasetID == "" || conf.Output == "" {
+		return nil, errors.New("missing params")
+	}
+	if !hasTableVar(conf.Output) {
+		return nil, errors.New("Output has to name each table with {{table}}")
+	}
+	if conf.ResumeFile != "" {
+		return nil, errors.New("ResumeFile can't be used with DumpDataset")
+	}
+	if _, err := path.Match(ds.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("Invalid pattern %s - %s", ds.Pattern, err)
+	}
+	if projectID == "" {
+		projectID = c.ProjectID
+	}
+	if err := validateDatasetID(datasetID); err != nil {
+		return nil, err
+	}
+
+	tables, err := c.listTables(projectID, datasetID)
+	if err != nil {
+		return nil, err
+	}
+	var results []TableDump
+	var views []bool
+	for _, t := range tables {
+		if t.TableReference == nil || t.Type != "TABLE" && !ds.Views {
+			continue
+		}
+		var tableID = t.TableReference.TableId
+		if ds.Pattern != "" {
+			if ok, _ := path.Match(ds.Pattern, tableID); !ok {
+				continue
+			}
+		}
+		results = append(results, TableDump{Table: projectID + "." + datasetID + "." + tableID})
+		views = append(views, t.Type != "TABLE")
+	}
+
+	var parallelism = ds.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultParallelism
+	}
+	runParallel(parallelism, len(results), func(i int) {
+		var r = &results[i]
+		r.Output, r.Rows, r.Err = c.dumpDatasetTable(ctx, r.Table, views[i], conf)
+	})
+
+	var derr = &DatasetDumpError{}
+	for _, r := range results {
+		if r.Err != nil {
+			derr.Failed = append(derr.Failed, r)
+		}
+	}
+	if len(derr.Failed) != 0 {
+		return results, derr
+	}
+	return results, nil
+}
+
+// Dump a table of DumpDataset, a view with a query. Returns the output
+// written and number of rows.
+func (c *Client) dumpDatasetTable(ctx context.Context, table string, view bool, conf DumpConfig) (string, uint64, error) {
+	var vars = map[string]string{}
+	for k, v := range conf.Vars {
+		vars[k] = v
+	}
+	dest, _ := ParseDestination(table)
+	vars["table"] = dest.TableID
+	if err := expandFields(vars, &conf.Output); err != nil {
+		return "", 0, err
+	}
+	conf.Vars = nil
+
+	var done = Completion{Operation: "dump", Output: conf.Output, Started: time.Now()}
+	var err error
+	if view {
+		conf.Query, conf.Table = "", table
+		err = c.dump(ctx, conf, &done)
+	} else {
+		err = c.dumpTable(ctx, dest.ProjectID, dest.DatasetID, dest.TableID, conf, &done)
+	}
+	return conf.Output, done.Rows, c.notify(conf.Notify, done, err)
+}
+
+// Whether the output has the {{table}} variable.
+func hasTableVar(output string) bool {
+	for _, m := range templateVar.FindAllStringSubmatch(output, -1) {
+		if m[1] == "table" {
+			return true
+		}
+	}
+	return false
+}
+
+// Load a directory tree of datasets: each subdirectory of dir is a dataset,
+// and each json or csv file in it is loaded to the table of its name, with
+// the schema of table.schema.json next to it, e.g. dir/sales/orders.csv and
+// dir/sales/orders.schema.json to sales.orders.
+// The other options of conf are used for every table. Datasets are created
+// unless conf.NoCreateDataset is set.
+//
+// ds.Parallelism tables are loaded at once, and a table failing doesn't stop
+// the others. Returns the result of each table, and a DatasetLoadError
+// listing those that failed.
+func (c *Client) LoadDataset(dir string, conf LoadConfig, ds DatasetLoadConfig) ([]TableLoad, error) {
+	if dir == "" {
+		return nil, errors.New("missing params")
+	}
+	datasets, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading directory - %s", err)
+	}
+
+	var results []TableLoad
+	for _, d := range datasets {
+		if !d.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(dir, d.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("Error reading directory - %s", err)
+		}
+		for _, f := range files {
+			var name = f.Name()
+			if !f.Mode().IsRegular() || strings.HasSuffix(name, schemaSuffix) {
+				continue
+			}
+			var ext = filepath.Ext(name)
+			if ext != ".json" && ext != ".csv" {
+				continue
+			}
+			results = append(results, TableLoad{
+				Table:  c.ProjectID + "." + d.Name() + "." + strings.TrimSuffix(name, ext),
+				Source: filepath.Join(dir, d.Name(), name),
+			})
+		}
+	}
+
+	var parallelism = ds.Parallelism
+	if parallelism <= 0 {
+		parallelism = defaultParallelism
+	}
+	defer shareRejects(&conf)()
+	runParallel(parallelism, len(results), func(i int) {
+		var r = &results[i]
+		var tconf = conf
+		tconf.SourceFile = r.Source
+		tconf.SchemaFile = strings.TrimSuffix(r.Source, filepath.Ext(r.Source)) + schemaSuffix
+		tconf.DatasetID = filepath.Base(filepath.Dir(r.Source))
+		tconf.TableID = strings.TrimSuffix(filepath.Base(r.Source), filepath.Ext(r.Source))
+		if _, err := os.Stat(tconf.SchemaFile); err != nil {
+			r.Err = fmt.Errorf("Error reading schema - %s", err)
+			return
+		}
+		r.Err = c.Load(tconf)
+	})
+
+	var lerr = &DatasetLoadError{}
+	for _, r := range results {
+		if r.Err != nil {
+			lerr.Failed = append(lerr.Failed, r)
+		}
+	}
+	if len(lerr.Failed) != 0 {
+		return results, lerr
+	}
+	return results, nil
+}
+
+// Call fn for each of 0 to count-1, at most n at once, and wait for all.
+func runParallel(n, count int, fn func(i int)) {
+	var slots = make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,57 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+)
+
+// Rewriting an ingestion-time partitioned table would move every row to
+// today's partition.
+var errDedupIngestionTime = errors.New("DedupKeys can't be used with ingestion-time partitioned tables")
+
+// Check the load can remove duplicates from its table.
+func checkDedup(conf LoadConfig) error {
+	if len(conf.DedupKeys) != 0 && conf.Partitioning != "" && conf.PartitionField == "" {
+		return errDedupIngestionTime
+	}
+	return nil
+}
+
+// Rewrite the loaded table with one row of each set of conf.DedupKeys values.
+func (c *Client) dedup(ctx context.Context, conf LoadConfig) error {
+	var order string
+	if conf.DedupOrderBy != "" {
+		order = " ORDER BY " + conf.DedupOrderBy
+	}
+	var query = &bigquery.JobConfigurationQuery{
+		Query: "SELECT * FROM " + tableName(c.ProjectID, conf.DatasetID, conf.TableID) +
+			" WHERE TRUE QUALIFY ROW_NUMBER() OVER (PARTITION BY " + quoteColumns(conf.DedupKeys) + order + ") = 1",
+		UseLegacySql: new(bool),
+		DestinationTable: &bigquery.TableReference{
+			ProjectId: c.ProjectID,
+			DatasetId: conf.DatasetID,
+			TableId:   conf.TableID,
+		},
+		WriteDisposition:                   WriteTruncate,
+		DestinationEncryptionConfiguration: c.encryption(),
+	}
+	// Partitioning and clustering have to match the table's, which may have
+	// been set before the load.
+	table, err := c.bq.Tables.Get(c.ProjectID, conf.DatasetID, conf.TableID).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("Error getting table - %s", err)
+	}
+	if table.TimePartitioning != nil && table.TimePartitioning.Field == "" {
+		return errDedupIngestionTime
+	}
+	query.TimePartitioning = table.TimePartitioning
+	query.RangePartitioning = table.RangePartitioning
+	query.Clustering = table.Clustering
+
+	if _, err = c.runJobIn(ctx, c.Location, &bigquery.JobConfiguration{Query: query}); err != nil {
+		return fmt.Errorf("Error removing duplicates - %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package bqwrapper
+
+import (
+	"context"
+	"encoding/json"
+	"google.golang.org/api/bigquery/v2"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDedupKeepsPartitioning(t *testing.T) {
+	var table = &bigquery.Table{
+		RangePartitioning: &bigquery.RangePartitioning{Field: "id", Range: &bigquery.RangePartitioningRange{Start: 0, End: 100, Interval: 10}},
+		Clustering:        &bigquery.Clustering{Fields: []string{"name"}},
+	}
+	var query *bigquery.JobConfigurationQuery
+	var c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/datasets/ds/tables/t"):
+			writeJSON(w, table)
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/projects/test/jobs"):
+			var job bigquery.Job
+			if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+				t.Error(err)
+			}
+			query = job.Configuration.Query
+			writeJSON(w, &bigquery.Job{JobReference: &bigquery.JobReference{ProjectId: "test", JobId: "dedup"}})
+		case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/projects/test/jobs/dedup"):
+			writeJSON(w, &bigquery.Job{Status: &bigquery.JobStatus{State: "DONE"}})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	if err := c.dedup(context.Background(), LoadConfig{DatasetID: "ds", TableID: "t", DedupKeys: []string{"id"}}); err != nil {
+		t.Fatal(err)
+	}
+	if query == nil || query.WriteDisposition != WriteTruncate {
+		t.Fatalf("got query %+v", query)
+	}
+	if query.RangePartitioning == nil || query.RangePartitioning.Field != "id" || query.TimePartitioning != nil {
+		t.Errorf("got partitioning %+v %+v", query.RangePartitioning, query.TimePartitioning)
+	}
+	if query.Clustering == nil || len(query.Clustering.Fields) != 1 || query.Clustering.Fields[0] != "name" {
+		t.Errorf("got clustering %+v", query.Clustering)
+	}
+}
+
+func TestDedupIngestionTime(t *testing.T) {
+	// Nothing is rewritten, the table is only looked up.
+	var c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || !strings.HasSuffix(r.URL.Path, "/datasets/ds/tables/t") {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		writeJSON(w, &bigquery.Table{TimePartitioning: &bigquery.TimePartitioning{Type: "DAY"}})
+	}))
+	var conf = LoadConfig{DatasetID: "ds", TableID: "t", DedupKeys: []string{"id"}}
+	if err := c.dedup(context.Background(), conf); err != errDedupIngestionTime {
+		t.Errorf("got %v, want %v", err, errDedupIngestionTime)
+	}
+
+	// Loads asking for it fail before anything is sent.
+	conf.SchemaFile, conf.SourceFile, conf.Partitioning = "schema.json", "data.json", "DAY"
+	if err := c.Load(conf); err != errDedupIngestionTime {
+		t.Errorf("got %v, want %v", err, errDedupIngestionTime)
+	}
+	conf.PartitionField = "created"
+	if err := checkDedup(conf); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,240 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// Default of a field set to the time the load started.
+const defaultNow = "now()"
+
+// Source of a load with defaults filled in, in a temporary file named with
+// the suffix of its format.
+type defaultedSource struct {
+	*tempFile
+}
+
+// Fills defaults of a source row by row.
+type defaultFiller struct {
+	now      time.Time
+	required bool
+
+	// Rows missing REQUIRED fields, and those fields up to
+	// maxValidationProblems.
+	rows    int64
+	last    int64
+	missing []ValidationProblem
+}
+
+// Fill fields missing from the source with the default of their schema,
+// and if conf.EnforceRequired is set, fail listing the lines missing
+// REQUIRED fields before anything is uploaded.
+// The result goes to a temporary file, returned in place of r (which is
+// closed) along with its size. r is returned as it is if the schema has no
+// defaults and required fields aren't enforced.
+func applyDefaults(conf LoadConfig, r io.ReadCloser, size int64) (io.ReadCloser, int64, error) {
+	fields, err := readSchema(conf.SchemaFile)
+	if err != nil {
+		r.Close()
+		return nil, 0, err
+	}
+	if !conf.EnforceRequired && !hasDefaults(fields) {
+		return r, size, nil
+	}
+	defer r.Close()
+
+	var format = loadFormat(conf, conf.SourceFile)
+	var ext = ".json"
+	switch format {
+	case "CSV":
+		ext = ".csv"
+	case "NEWLINE_DELIMITED_JSON":
+	default:
+		return nil, 0, errors.New("Unsupported source file format")
+	}
+	f, err := ioutil.TempFile("", "bqwrapper-*"+ext)
+	if err != nil {
+		return nil, 0, err
+	}
+	var d = &defaultedSource{&tempFile{f}}
+
+	var fill = &defaultFiller{now: time.Now().UTC(), required: conf.EnforceRequired}
+	var w = bufio.NewWriter(f)
+	if format == "CSV" {
+		err = fill.csv(fields, r, w)
+	} else {
+		err = fill.json(fields, r, w)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil && fill.rows != 0 {
+		err = &RequiredFieldError{Rows: fill.rows, Missing: fill.missing}
+	}
+	if err == nil {
+		if size, err = f.Seek(0, io.SeekCurrent); err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+	}
+	if err != nil {
+		d.Close()
+		return nil, 0, err
+	}
+	return d, size, nil
+}
+
+// Whether any field of the schema has a default.
+func hasDefaults(fields []TableField) bool {
+	for _, field := range fields {
+		if field.Default != "" || hasDefaults(field.Fields) {
+			return true
+		}
+	}
+	return false
+}
+
+// Schema without defaults, which are not sent to BigQuery.
+func withoutDefaults(fields []TableField) []TableField {
+	if !hasDefaults(fields) {
+		return fields
+	}
+	var result = make([]TableField, len(fields))
+	for i, field := range fields {
+		field.Default = ""
+		field.Fields = withoutDefaults(field.Fields)
+		result[i] = field
+	}
+	return result
+}
+
+// Fill defaults of each line of newline delimited json. Lines with nothing
+// to fill are copied as they are, as are malformed ones, which BigQuery
+// reports.
+func (f *defaultFiller) json(fields []TableField, r io.Reader, w *bufio.Writer) error {
+	var br = bufio.NewReader(r)
+	var line int64
+	for {
+		by, err := br.ReadBytes('\n')
+		if len(by) != 0 {
+			line++
+			var row map[string]interface{}
+			var dec = json.NewDecoder(bytes.NewReader(by))
+			dec.UseNumber()
+			if len(bytes.TrimSpace(by)) != 0 && dec.Decode(&row) == nil && f.record(fields, "", row, line) {
+				out, merr := json.Marshal(row)
+				if merr != nil {
+					return fmt.Errorf("Error writing line %d - %s", line, merr)
+				}
+				by = append(out, '\n')
+			}
+			w.Write(by)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading source - %s", err)
+		}
+	}
+}
+
+// Fill defaults of the record's fields, and of records nested in it, and
+// note REQUIRED fields still missing. Returns whether anything was filled.
+func (f *defaultFiller) record(fields []TableField, prefix string, row map[string]interface{}, line int64) bool {
+	var changed bool
+	for _, field := range fields {
+		var val = row[field.Name]
+		if val == nil && field.Default != "" && field.Mode != "REPEATED" {
+			val = f.value(field)
+			row[field.Name] = val
+			changed = true
+		}
+		switch v := val.(type) {
+		case nil:
+			if field.Mode == "REQUIRED" {
+				f.miss(line, prefix+field.Name)
+			}
+		case map[string]interface{}:
+			changed = f.record(field.Fields, prefix+field.Name+".", v, line) || changed
+		case []interface{}:
+			for _, item := range v {
+				if rec, ok := item.(map[string]interface{}); ok {
+					changed = f.record(field.Fields, prefix+field.Name+".", rec, line) || changed
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// Fill defaults of each csv record, where empty values are NULL. Short
+// records are extended to fields with a default.
+func (f *defaultFiller) csv(fields []TableField, r io.Reader, w *bufio.Writer) error {
+	var cr = csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	var cw = csv.NewWriter(w)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading source - %s", err)
+		}
+		line, _ := cr.FieldPos(0)
+		for i, field := range fields {
+			switch {
+			case i < len(record) && record[i] != "":
+			case field.Default != "":
+				if i >= len(record) {
+					record = append(record, make([]string, i+1-len(record))...)
+				}
+				record[i] = f.value(field).(string)
+			case field.Mode == "REQUIRED":
+				f.miss(int64(line), field.Name)
+			}
+		}
+		if err = cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Default value of the field.
+func (f *defaultFiller) value(field TableField) interface{} {
+	if field.Default != defaultNow {
+		return field.Default
+	}
+	switch field.Type {
+	case "DATE":
+		return f.now.Format("2006-01-02")
+	case "TIME":
+		return f.now.Format("15:04:05.000000")
+	case "DATETIME":
+		return f.now.Format("2006-01-02 15:04:05.000000")
+	}
+	return f.now.Format("2006-01-02 15:04:05.000000 UTC")
+}
+
+// Note a REQUIRED field missing on the line, if they're enforced.
+func (f *defaultFiller) miss(line int64, name string) {
+	if !f.required {
+		return
+	}
+	if line != f.last {
+		f.rows++
+		f.last = line
+	}
+	if len(f.missing) < maxValidationProblems {
+		f.missing = append(f.missing, ValidationProblem{Line: line, Field: name, Message: "missing required field"})
+	}
+}
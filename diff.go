@@ -0,0 +1,114 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"strings"
+	"time"
+)
+
+// Values of the "diff" column of Diff output.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// Compare rows of conf.Left and conf.Right by conf.Keys and write those that
+// differ to conf.Output: rows only in Right as DiffAdded, rows only in Left
+// as DiffRemoved, and rows whose other columns differ as DiffChanged. Each
+// has the keys, the "diff" column and both rows as json ("left_row" and
+// "right_row", null if it's missing).
+//
+// The comparison runs in BigQuery, as one standard SQL query joining both
+// sides on the keys. Rows are compared as json, so columns have to be in the
+// same order on both sides, and rows with a NULL key never match.
+func (c *Client) Diff(conf DiffConfig) (*DiffReport, error) {
+	// Required params check.
+	if conf.Left == "" || conf.Right == "" || len(conf.Keys) == 0 || conf.Output == "" {
+		return nil, errors.New("missing params")
+	}
+	if conf.Format == "" {
+		conf.Format = "json"
+	}
+	query, err := c.diffQuery(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var dconf = DumpConfig{Output: conf.Output, Format: conf.Format, Query: query}
+	if err = checkDumpConfig(&dconf); err != nil {
+		return nil, err
+	}
+	var req = &bigquery.QueryRequest{
+		Kind:         "bigquery#queryRequest",
+		Query:        query,
+		Location:     c.Location,
+		UseLegacySql: new(bool),
+	}
+
+	// The diff column comes first.
+	var report = &DiffReport{}
+	var w = c.newOutput(dconf)
+	_, err = c.runQuery(context.Background(), req, 0, func(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+		for _, row := range rows {
+			switch cellString(row, 0) {
+			case DiffAdded:
+				report.Added++
+			case DiffRemoved:
+				report.Removed++
+			case DiffChanged:
+				report.Changed++
+			}
+		}
+		return w.page(fields, rows)
+	})
+	if err != nil {
+		w.abort()
+		return nil, err
+	}
+	if err = w.close(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Query selecting rows that differ between both sides.
+func (c *Client) diffQuery(conf DiffConfig) (string, error) {
+	left, err := c.diffSide(conf.Left)
+	if err != nil {
+		return "", err
+	}
+	right, err := c.diffSide(conf.Right)
+	if err != nil {
+		return "", err
+	}
+
+	var keys, on []string
+	for _, key := range conf.Keys {
+		if !columnName.MatchString(key) {
+			return "", fmt.Errorf("Invalid key %s", key)
+		}
+		var col = "`" + strings.Replace(key, ".", "`.`", -1) + "`"
+		keys = append(keys, fmt.Sprintf("COALESCE(l.row.%s, r.row.%s) AS `%s`", col, col, strings.Replace(key, ".", "_", -1)))
+		on = append(on, fmt.Sprintf("l.row.%s = r.row.%s", col, col))
+	}
+
+	return "WITH l AS (SELECT t AS row, TO_JSON_STRING(t) AS js FROM (" + left + ") t), " +
+		"r AS (SELECT t AS row, TO_JSON_STRING(t) AS js FROM (" + right + ") t) " +
+		"SELECT CASE WHEN l.row IS NULL THEN '" + DiffAdded + "' WHEN r.row IS NULL THEN '" + DiffRemoved +
+		"' ELSE '" + DiffChanged + "' END AS diff, " + strings.Join(keys, ", ") +
+		", l.js AS left_row, r.js AS right_row " +
+		"FROM l FULL OUTER JOIN r ON " + strings.Join(on, " AND ") +
+		" WHERE l.row IS NULL OR r.row IS NULL OR l.js != r.js", nil
+}
+
+// Standard SQL query of a side of a diff, a table or a query.
+func (c *Client) diffSide(side string) (string, error) {
+	if strings.ContainsAny(side, " \t\r\n") {
+		return strings.TrimPrefix(strings.TrimSpace(side), standardPrefix), nil
+	}
+	return tableQuery(c.ProjectID, side, time.Time{})
+}
@@ -0,0 +1,54 @@
+package bqwrapper
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"regexp"
+	"sort"
+)
+
+// Run the dump's query against the replicas of conf.Failover in turn after
+// it failed with qerr, until one succeeds. Output of the failed query is
+// already removed, and each replica writes it anew.
+func (c *Client) failover(ctx context.Context, conf DumpConfig, req *bigquery.QueryRequest, done *Completion, qerr error) error {
+	for _, f := range conf.Failover {
+		var freq = *req
+		freq.Query = replicaQuery(req.Query, f.Datasets)
+		freq.Location = f.Location
+
+		var w = c.newOutput(conf)
+		jobID, outErr, err := c.sendQuery(ctx, &freq, conf, w.page)
+		done.JobID, done.Location = jobID, freq.Location
+		if err == nil {
+			// The metadata file tells the query that ran.
+			conf.Query = freq.Query
+			return c.closeOutput(w, conf, freq.Location, done)
+		}
+		w.abort()
+		if outErr || ctx.Err() != nil {
+			return err
+		}
+		qerr = fmt.Errorf("%s; in %s - %s", qerr, f.Location, err)
+	}
+	return qerr
+}
+
+// Replace datasets ("dataset" or "project.dataset") in the query with their
+// replicas. A dataset is replaced where it's followed by ".", and not
+// preceded by a letter, digit, "_", "-" or ".", so "sales.orders" and
+// "`sales.orders`" both are.
+func replicaQuery(query string, datasets map[string]string) string {
+	// Longest first, so "project.dataset" wins over "dataset".
+	var names = make([]string, 0, len(datasets))
+	for name := range datasets {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+
+	for _, name := range names {
+		var re = regexp.MustCompile(`(^|[^\w.-])` + regexp.QuoteMeta(name) + `\.`)
+		query = re.ReplaceAllString(query, "${1}"+datasets[name]+".")
+	}
+	return query
+}
@@ -0,0 +1,179 @@
+package bqwrapper
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"sync"
+	"time"
+)
+
+// Usage of a client counted against its guardrails.
+type guardState struct {
+	mu sync.Mutex
+
+	// UTC day and bytes billed by queries finished on it.
+	day    string
+	billed int64
+
+	// One entry per running job, made on first use.
+	slots chan struct{}
+}
+
+// Wait for a slot to run a job if the client limits how many run at once.
+// The returned func gives the slot back, calling it again does nothing.
+func (c *Client) acquireJob(ctx context.Context) (func(), error) {
+	var max = c.Guardrails.MaxConcurrentJobs
+	if max <= 0 {
+		return func() {}, nil
+	}
+	c.guard.mu.Lock()
+	if c.guard.slots == nil {
+		c.guard.slots = make(chan struct{}, max)
+	}
+	var slots = c.guard.slots
+	c.guard.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("Stopped waiting for a job slot - %s", ctx.Err())
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-slots }) }, nil
+}
+
+// Check a job against the client's guardrails before submitting it.
+// Tables it reads or writes can't be in a denied dataset, and a query's
+// maximumBytesBilled is lowered to what's left of the day's limit so it
+// fails on BigQuery instead of going over.
+func (c *Client) checkGuardrails(ctx context.Context, location string, conf *bigquery.JobConfiguration) error {
+	if conf.DryRun {
+		return nil
+	}
+	if len(c.Guardrails.DeniedDatasets) != 0 {
+		var tables []*bigquery.TableReference
+		switch {
+		case conf.Load != nil:
+			tables = append(tables, conf.Load.DestinationTable)
+		case conf.Copy != nil:
+			tables = append(tables, conf.Copy.DestinationTable, conf.Copy.SourceTable)
+			tables = append(tables, conf.Copy.SourceTables...)
+		case conf.Extract != nil:
+			tables = append(tables, conf.Extract.SourceTable)
+		case conf.Query != nil:
+			refs, err := c.queryTables(ctx, location, conf.Query)
+			if err != nil {
+				return err
+			}
+			tables = append(refs, conf.Query.DestinationTable)
+		}
+		for _, t := range tables {
+			if t != nil {
+				if err := c.checkDenied(t.ProjectId, t.DatasetId); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if conf.Query == nil {
+		return nil
+	}
+	left, limited := c.bytesLeft()
+	if !limited {
+		return nil
+	}
+	if left <= 0 {
+		return &GuardrailError{Message: fmt.Sprintf("%d bytes billed today, the limit is reached", c.Guardrails.MaxBytesBilledPerDay)}
+	}
+	if conf.Query.MaximumBytesBilled == 0 || conf.Query.MaximumBytesBilled > left {
+		conf.Query.MaximumBytesBilled = left
+	}
+	return nil
+}
+
+// Check a query request against the client's guardrails, see checkGuardrails.
+func (c *Client) checkQueryGuardrails(ctx context.Context, req *bigquery.QueryRequest) error {
+	var conf = &bigquery.JobConfiguration{
+		DryRun: req.DryRun,
+		Query: &bigquery.JobConfigurationQuery{
+			Query:                req.Query,
+			UseLegacySql:         req.UseLegacySql,
+			DefaultDataset:       req.DefaultDataset,
+			ConnectionProperties: req.ConnectionProperties,
+			MaximumBytesBilled:   req.MaximumBytesBilled,
+		},
+	}
+	if err := c.checkGuardrails(ctx, req.Location, conf); err != nil {
+		return err
+	}
+	req.MaximumBytesBilled = conf.Query.MaximumBytesBilled
+	return nil
+}
+
+// Tables a query reads, found by dry running it.
+func (c *Client) queryTables(ctx context.Context, location string, query *bigquery.JobConfigurationQuery) ([]*bigquery.TableReference, error) {
+	job, err := c.bq.Jobs.Insert(c.ProjectID, &bigquery.Job{
+		JobReference: &bigquery.JobReference{ProjectId: c.ProjectID, Location: location},
+		Configuration: &bigquery.JobConfiguration{
+			DryRun: true,
+			Query: &bigquery.JobConfigurationQuery{
+				Query:                query.Query,
+				UseLegacySql:         query.UseLegacySql,
+				DefaultDataset:       query.DefaultDataset,
+				ConnectionProperties: query.ConnectionProperties,
+			},
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Error checking query - %s", err)
+	}
+	if job.Statistics == nil || job.Statistics.Query == nil {
+		return nil, nil
+	}
+	return job.Statistics.Query.ReferencedTables, nil
+}
+
+// Fail if the dataset is in the client's DeniedDatasets, which are either
+// "project.dataset" or a dataset of the client's project.
+func (c *Client) checkDenied(projectID, datasetID string) error {
+	if projectID == "" {
+		projectID = c.ProjectID
+	}
+	for _, d := range c.Guardrails.DeniedDatasets {
+		if d == projectID+"."+datasetID || d == datasetID && projectID == c.ProjectID {
+			return &GuardrailError{Message: fmt.Sprintf("dataset %s.%s is denied", projectID, datasetID)}
+		}
+	}
+	return nil
+}
+
+// Bytes the client may still be billed today, and whether there's a limit.
+func (c *Client) bytesLeft() (int64, bool) {
+	if c.Guardrails.MaxBytesBilledPerDay <= 0 {
+		return 0, false
+	}
+	c.guard.mu.Lock()
+	defer c.guard.mu.Unlock()
+	c.guard.today()
+	return c.Guardrails.MaxBytesBilledPerDay - c.guard.billed, true
+}
+
+// Count the bytes billed by a finished query job against the day's limit.
+func (c *Client) countBilled(job *bigquery.Job) {
+	if c.Guardrails.MaxBytesBilledPerDay <= 0 || job.Statistics == nil || job.Statistics.Query == nil {
+		return
+	}
+	c.guard.mu.Lock()
+	defer c.guard.mu.Unlock()
+	c.guard.today()
+	c.guard.billed += job.Statistics.Query.TotalBytesBilled
+}
+
+// Start counting again when the UTC day changed. Called with mu held.
+func (g *guardState) today() {
+	if day := time.Now().UTC().Format("2006-01-02"); day != g.day {
+		g.day, g.billed = day, 0
+	}
+}
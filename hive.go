@@ -0,0 +1,58 @@
+package bqwrapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"strings"
+)
+
+// Check the hive partitioning of the load, if it's set.
+func checkHivePartitioning(conf LoadConfig) error {
+	var h = conf.HivePartitioning
+	if h == nil {
+		return nil
+	}
+	switch h.Mode {
+	case "", "AUTO", "STRINGS", "CUSTOM":
+	default:
+		return fmt.Errorf("Unsupported hive partitioning mode %s", h.Mode)
+	}
+	if !strings.HasPrefix(conf.SourceFile, "gs://") {
+		return errors.New("HivePartitioning needs a gs:// SourceFile")
+	}
+	if h.SourceURIPrefix == "" {
+		return errors.New("missing SourceURIPrefix")
+	}
+	if conf.Validate || conf.RejectFile != "" || conf.StagingBucket != "" || conf.ShardField != "" {
+		return errors.New("HivePartitioning can't be used with Validate, RejectFile, StagingBucket or ShardField")
+	}
+	return nil
+}
+
+// Load the GCS objects of conf.SourceFile (wildcards allowed) with the
+// configuration of load, filling partition columns from their paths.
+func (c *Client) hiveLoad(ctx context.Context, conf LoadConfig, load jobLoadConf) (*bigquery.Job, error) {
+	by, err := json.Marshal(load)
+	if err != nil {
+		return nil, err
+	}
+	var jobConf = &bigquery.JobConfiguration{Load: &bigquery.JobConfigurationLoad{}}
+	if err = json.Unmarshal(by, jobConf.Load); err != nil {
+		return nil, err
+	}
+	jobConf.Load.SourceUris = []string{conf.SourceFile}
+
+	var mode = conf.HivePartitioning.Mode
+	if mode == "" {
+		mode = "AUTO"
+	}
+	jobConf.Load.HivePartitioningOptions = &bigquery.HivePartitioningOptions{
+		Mode:                   mode,
+		SourceUriPrefix:        conf.HivePartitioning.SourceURIPrefix,
+		RequirePartitionFilter: conf.HivePartitioning.RequirePartitionFilter,
+	}
+	return c.runJobIn(ctx, c.Location, jobConf)
+}
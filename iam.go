@@ -0,0 +1,146 @@
+package bqwrapper
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"strings"
+)
+
+// Get IAM policy of the table.
+func (c *Client) GetTableIamPolicy(datasetID, tableID string) (*bigquery.Policy, error) {
+	if datasetID == "" || tableID == "" {
+		return nil, errors.New("missing params")
+	}
+	policy, err := c.bq.Tables.GetIamPolicy(tableResource(c.ProjectID, datasetID, tableID),
+		&bigquery.GetIamPolicyRequest{}).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting IAM policy - %s", err)
+	}
+	return policy, nil
+}
+
+// Set IAM policy of the table.
+// The policy should come from GetTableIamPolicy so its etag prevents
+// overwriting someone else's change.
+func (c *Client) SetTableIamPolicy(datasetID, tableID string, policy *bigquery.Policy) error {
+	if datasetID == "" || tableID == "" || policy == nil {
+		return errors.New("missing params")
+	}
+	_, err := c.bq.Tables.SetIamPolicy(tableResource(c.ProjectID, datasetID, tableID),
+		&bigquery.SetIamPolicyRequest{Policy: policy}).Do()
+	if err != nil {
+		return fmt.Errorf("Error setting IAM policy - %s", err)
+	}
+	return nil
+}
+
+// Grant a role (e.g. "roles/bigquery.dataViewer") on the table to a member
+// (e.g. "serviceAccount:reader@project.iam.gserviceaccount.com").
+// Nothing is changed if the member already has the role.
+func (c *Client) GrantTableRole(datasetID, tableID, role, member string) error {
+	if role == "" || member == "" {
+		return errors.New("missing params")
+	}
+	policy, err := c.GetTableIamPolicy(datasetID, tableID)
+	if err != nil {
+		return err
+	}
+
+	// Add to the existing binding for the role if there is one.
+	var binding *bigquery.Binding
+	for _, b := range policy.Bindings {
+		if b.Role == role {
+			binding = b
+			break
+		}
+	}
+	if binding == nil {
+		binding = &bigquery.Binding{Role: role}
+		policy.Bindings = append(policy.Bindings, binding)
+	}
+	for _, m := range binding.Members {
+		if m == member {
+			return nil
+		}
+	}
+	binding.Members = append(binding.Members, member)
+
+	return c.SetTableIamPolicy(datasetID, tableID, policy)
+}
+
+// Get access entries of the dataset.
+func (c *Client) GetDatasetAccess(datasetID string) ([]*bigquery.DatasetAccess, error) {
+	if datasetID == "" {
+		return nil, errors.New("missing params")
+	}
+	dataset, err := c.bq.Datasets.Get(c.ProjectID, datasetID).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting dataset - %s", err)
+	}
+	return dataset.Access, nil
+}
+
+// Grant a role (e.g. "READER" or "roles/bigquery.dataViewer") on the dataset
+// to a member, adding an access entry. Member is in IAM format such as
+// "user:alice@example.com", "group:...", "serviceAccount:...", "domain:..."
+// or "specialGroup:projectReaders".
+// Nothing is changed if the entry already exists.
+func (c *Client) GrantDatasetRole(datasetID, role, member string) error {
+	if datasetID == "" || role == "" || member == "" {
+		return errors.New("missing params")
+	}
+	entry, err := accessEntry(role, member)
+	if err != nil {
+		return err
+	}
+
+	dataset, err := c.bq.Datasets.Get(c.ProjectID, datasetID).Do()
+	if err != nil {
+		return fmt.Errorf("Error getting dataset - %s", err)
+	}
+	for _, a := range dataset.Access {
+		if a.Role == entry.Role && a.UserByEmail == entry.UserByEmail &&
+			a.GroupByEmail == entry.GroupByEmail && a.Domain == entry.Domain &&
+			a.SpecialGroup == entry.SpecialGroup && a.IamMember == entry.IamMember {
+			return nil
+		}
+	}
+
+	// Access list has to be sent as a whole.
+	_, err = c.bq.Datasets.Patch(c.ProjectID, datasetID, &bigquery.Dataset{
+		Access: append(dataset.Access, entry),
+	}).Do()
+	if err != nil {
+		return fmt.Errorf("Error updating dataset access - %s", err)
+	}
+	return nil
+}
+
+// Build a dataset access entry from an IAM style member.
+func accessEntry(role, member string) (*bigquery.DatasetAccess, error) {
+	var parts = strings.SplitN(member, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("Invalid member %s", member)
+	}
+
+	var entry = &bigquery.DatasetAccess{Role: role}
+	switch parts[0] {
+	case "user", "serviceAccount":
+		entry.UserByEmail = parts[1]
+	case "group":
+		entry.GroupByEmail = parts[1]
+	case "domain":
+		entry.Domain = parts[1]
+	case "specialGroup":
+		entry.SpecialGroup = parts[1]
+	default:
+		entry.IamMember = member
+	}
+	return entry, nil
+}
+
+// Resource name of a table for IAM calls.
+func tableResource(projectID, datasetID, tableID string) string {
+	return "projects/" + projectID + "/datasets/" + datasetID + "/tables/" + tableID
+}
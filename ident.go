@@ -0,0 +1,80 @@
+package bqwrapper
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Syntax of identifiers. Project IDs may have a domain ("example.com:proj"),
+// table IDs a partition decorator ("events$20240101").
+var (
+	projectIDSyntax = regexp.MustCompile(`^([a-z0-9][a-z0-9.-]*:)?[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+	datasetIDSyntax = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	tableIDSyntax   = regexp.MustCompile(`^[\p{L}\p{M}\p{N}\p{Pc}\p{Pd}\p{Zs}]+(\$[A-Za-z0-9_]+)?$`)
+)
+
+// Longest dataset and table IDs, in bytes.
+const maxIdentifierBytes = 1024
+
+// Parse "project.dataset.table" or "dataset.table" (in the client's project),
+// with or without backquotes, into a Destination and check its syntax.
+func ParseDestination(s string) (Destination, error) {
+	var name = strings.Trim(s, "`")
+	var d Destination
+	var i = strings.LastIndex(name, ".")
+	if i < 0 {
+		return d, fmt.Errorf("Invalid table %s - expected dataset.table or project.dataset.table", s)
+	}
+	d.DatasetID, d.TableID = name[:i], name[i+1:]
+	// The project may have dots itself, if it has a domain.
+	if i = strings.LastIndex(d.DatasetID, "."); i >= 0 {
+		d.ProjectID, d.DatasetID = d.DatasetID[:i], d.DatasetID[i+1:]
+	}
+	if err := d.Validate(); err != nil {
+		return Destination{}, err
+	}
+	return d, nil
+}
+
+// Check syntax of the IDs, telling what's wrong with the first invalid one.
+// ProjectID may be empty.
+func (d Destination) Validate() error {
+	if d.ProjectID != "" && !projectIDSyntax.MatchString(d.ProjectID) {
+		return fmt.Errorf("Invalid project ID %s - it has 6 to 30 lowercase letters, digits and hyphens, starting with a letter", d.ProjectID)
+	}
+	if err := validateDatasetID(d.DatasetID); err != nil {
+		return err
+	}
+	switch {
+	case d.TableID == "":
+		return errors.New("Invalid table ID - it's empty")
+	case len(d.TableID) > maxIdentifierBytes:
+		return fmt.Errorf("Invalid table ID %s - it's longer than %d bytes", d.TableID, maxIdentifierBytes)
+	case !tableIDSyntax.MatchString(d.TableID):
+		return fmt.Errorf("Invalid table ID %s - only letters, marks, digits, connectors, dashes and spaces are allowed", d.TableID)
+	}
+	return nil
+}
+
+// Check syntax of a dataset ID.
+func validateDatasetID(id string) error {
+	switch {
+	case id == "":
+		return errors.New("Invalid dataset ID - it's empty")
+	case len(id) > maxIdentifierBytes:
+		return fmt.Errorf("Invalid dataset ID %s - it's longer than %d bytes", id, maxIdentifierBytes)
+	case !datasetIDSyntax.MatchString(id):
+		return fmt.Errorf("Invalid dataset ID %s - only letters, digits and underscores are allowed", id)
+	}
+	return nil
+}
+
+// "project.dataset.table", or "dataset.table" without a project.
+func (d Destination) String() string {
+	if d.ProjectID == "" {
+		return d.DatasetID + "." + d.TableID
+	}
+	return d.ProjectID + "." + d.DatasetID + "." + d.TableID
+}
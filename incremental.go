@@ -0,0 +1,155 @@
+package bqwrapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Query prefix telling a dump query is standard SQL.
+const standardPrefix = "#standardSQL"
+
+// Dump only rows of conf.Query or conf.Table newer than the last run, by
+// inc.Column which has to only ever increase (e.g. an updated_at timestamp or
+// an auto-incremented id). The highest value dumped is kept in inc.StateFile,
+// and saved only once the dump succeeds, so a failed run is done again next
+// time. Without a state file, all rows are dumped.
+//
+// Query has to be standard SQL. If there are no new rows, nothing is written.
+func (c *Client) IncrementalDump(conf DumpConfig, inc IncrementalConfig) error {
+	// Required params check.
+	if inc.Column == "" || inc.StateFile == "" || (conf.Query == "" && conf.Table == "") {
+		return errors.New("missing params")
+	}
+	if !columnName.MatchString(inc.Column) {
+		return fmt.Errorf("Invalid column %s", inc.Column)
+	}
+	if err := expandFields(conf.Vars, &conf.Query, &conf.Table, &conf.Output); err != nil {
+		return err
+	}
+	conf.Vars = nil
+
+	var query = conf.Query
+	if query == "" {
+		var err error
+		if query, err = tableQuery(c.ProjectID, conf.Table, conf.AsOf); err != nil {
+			return err
+		}
+	}
+
+	state, err := readWatermark(inc.StateFile)
+	if err != nil {
+		return err
+	}
+	if state.Column != "" && state.Column != inc.Column {
+		return fmt.Errorf("State file is for column %s", state.Column)
+	}
+
+	var col = "`" + strings.Replace(inc.Column, ".", "`.`", -1) + "`"
+	query = "SELECT * FROM (" + query + ")"
+	if state.Watermark != "" {
+		query += fmt.Sprintf(" WHERE %s > CAST(%s AS %s)", col, sqlString(state.Watermark), state.Type)
+	}
+
+	// Rows added while the dump runs are left for the next run.
+	high, ftype, err := c.highWatermark(query, col)
+	if err != nil {
+		return err
+	}
+	if high == "" {
+		return nil
+	}
+	if state.Watermark == "" {
+		query += " WHERE "
+	} else {
+		query += " AND "
+	}
+	query += fmt.Sprintf("%s <= CAST(%s AS %s)", col, sqlString(high), ftype)
+
+	conf.Query, conf.Table, conf.AsOf = standardPrefix+"\n"+query, "", time.Time{}
+	if err = c.Dump(conf); err != nil {
+		return err
+	}
+	return writeWatermark(inc.StateFile, watermarkState{
+		Column:    inc.Column,
+		Watermark: high,
+		Type:      ftype,
+		Updated:   time.Now(),
+	})
+}
+
+// Highest value of the column in the query's results as string, and its
+// standard SQL type. The value is "" if there are no rows.
+func (c *Client) highWatermark(query, col string) (string, string, error) {
+	var req = &bigquery.QueryRequest{
+		Kind:         "bigquery#queryRequest",
+		Query:        "SELECT CAST(MAX(" + col + ") AS STRING), MAX(" + col + ") FROM (" + query + ")",
+		Location:     c.Location,
+		UseLegacySql: new(bool),
+	}
+	var high, ftype string
+	_, err := c.runQuery(context.Background(), req, 0, func(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+		if len(fields) == 2 {
+			ftype = sqlTypeName(fields[1].Type)
+		}
+		if len(rows) != 0 {
+			high = cellString(rows[0], 0)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("Error getting watermark - %s", err)
+	}
+	return high, ftype, nil
+}
+
+// Standard SQL name of a type as the API returns it.
+func sqlTypeName(ftype string) string {
+	switch ftype {
+	case "INTEGER":
+		return "INT64"
+	case "FLOAT":
+		return "FLOAT64"
+	case "BOOLEAN":
+		return "BOOL"
+	}
+	return ftype
+}
+
+// Read the state of an incremental dump, empty if the file doesn't exist yet.
+func readWatermark(path string) (watermarkState, error) {
+	var state watermarkState
+	by, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(by, &state)
+	}
+	if err != nil {
+		return state, fmt.Errorf("Error reading state file - %s", err)
+	}
+	return state, nil
+}
+
+// Save the state of an incremental dump.
+func writeWatermark(path string, state watermarkState) error {
+	by, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0777); err == nil {
+		err = writeFileAtomic(path, by, 0666)
+	}
+	if err != nil {
+		return fmt.Errorf("Error writing state file - %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"strconv"
+	"strings"
+)
+
+// List tables of the dataset with their number of rows and size, from
+// INFORMATION_SCHEMA.PARTITIONS.
+func (c *Client) ListTableSizes(datasetID string) ([]TableSize, error) {
+	if datasetID == "" {
+		return nil, errors.New("missing params")
+	}
+	rows, err := c.queryRows("SELECT table_name, SUM(total_rows), SUM(total_logical_bytes), UNIX_MILLIS(MAX(last_modified_time)) FROM " +
+		tableName(c.ProjectID, datasetID, "INFORMATION_SCHEMA.PARTITIONS") + " GROUP BY table_name ORDER BY table_name")
+	if err != nil {
+		return nil, err
+	}
+	var result = make([]TableSize, len(rows))
+	for i, row := range rows {
+		result[i] = TableSize{
+			Table:        cellString(row, 0),
+			Rows:         cellInt(row, 1),
+			Bytes:        cellInt(row, 2),
+			LastModified: msTime(cellInt(row, 3)),
+		}
+	}
+	return result, nil
+}
+
+// List partitions of the table with their number of rows and size, from
+// INFORMATION_SCHEMA.PARTITIONS.
+func (c *Client) ListPartitions(datasetID, tableID string) ([]Partition, error) {
+	if datasetID == "" || tableID == "" {
+		return nil, errors.New("missing params")
+	}
+	rows, err := c.queryRows("SELECT partition_id, total_rows, total_logical_bytes, UNIX_MILLIS(last_modified_time) FROM " +
+		tableName(c.ProjectID, datasetID, "INFORMATION_SCHEMA.PARTITIONS") +
+		" WHERE table_name = " + sqlString(tableID) + " ORDER BY partition_id")
+	if err != nil {
+		return nil, err
+	}
+	var result = make([]Partition, len(rows))
+	for i, row := range rows {
+		result[i] = Partition{
+			ID:           cellString(row, 0),
+			Rows:         cellInt(row, 1),
+			Bytes:        cellInt(row, 2),
+			LastModified: msTime(cellInt(row, 3)),
+		}
+	}
+	return result, nil
+}
+
+// Profile the top level columns of the table (listed in
+// INFORMATION_SCHEMA.COLUMNS): number of nulls, approximate number of
+// distinct values, and min and max. Arrays, structs, GEOGRAPHY and JSON
+// columns are left out. This queries the whole table.
+func (c *Client) ColumnProfile(datasetID, tableID string) ([]ColumnStats, error) {
+	if datasetID == "" || tableID == "" {
+		return nil, errors.New("missing params")
+	}
+	cols, err := c.queryRows("SELECT column_name, data_type FROM " +
+		tableName(c.ProjectID, datasetID, "INFORMATION_SCHEMA.COLUMNS") +
+		" WHERE table_name = " + sqlString(tableID) + " ORDER BY ordinal_position")
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ColumnStats
+	var exprs = []string{"COUNT(*)"}
+	for _, row := range cols {
+		var name, typ = cellString(row, 0), cellString(row, 1)
+		if strings.HasPrefix(typ, "ARRAY") || strings.HasPrefix(typ, "STRUCT") || typ == "GEOGRAPHY" || typ == "JSON" {
+			continue
+		}
+		var col = "`" + name + "`"
+		exprs = append(exprs, "COUNTIF("+col+" IS NULL)", "APPROX_COUNT_DISTINCT("+col+")",
+			"CAST(MIN("+col+") AS STRING)", "CAST(MAX("+col+") AS STRING)")
+		result = append(result, ColumnStats{Name: name, Type: typ})
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	rows, err := c.queryRows("SELECT " + strings.Join(exprs, ", ") + " FROM " + tableName(c.ProjectID, datasetID, tableID))
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 1 {
+		return nil, errors.New("unexpected query result")
+	}
+	var total = cellInt(rows[0], 0)
+	for i := range result {
+		var n = 1 + i*4
+		result[i].Rows = total
+		result[i].Nulls = cellInt(rows[0], n)
+		result[i].Distinct = cellInt(rows[0], n+1)
+		result[i].Min = cellString(rows[0], n+2)
+		result[i].Max = cellString(rows[0], n+3)
+	}
+	return result, nil
+}
+
+// Run a standard SQL query and return all rows of its results.
+func (c *Client) queryRows(query string) ([]*bigquery.TableRow, error) {
+	var req = &bigquery.QueryRequest{
+		Kind:         "bigquery#queryRequest",
+		Query:        query,
+		Location:     c.Location,
+		UseLegacySql: new(bool),
+	}
+	var result []*bigquery.TableRow
+	_, err := c.runQuery(context.Background(), req, 0, func(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+		result = append(result, rows...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error running query - %s", err)
+	}
+	return result, nil
+}
+
+// Value of the i'th cell of the row as string, "" if it's null.
+func cellString(row *bigquery.TableRow, i int) string {
+	if i >= len(row.F) {
+		return ""
+	}
+	s, _ := row.F[i].V.(string)
+	return s
+}
+
+// Value of the i'th cell of the row as integer, 0 if it's null.
+func cellInt(row *bigquery.TableRow, i int) int64 {
+	n, _ := strconv.ParseInt(cellString(row, i), 10, 64)
+	return n
+}
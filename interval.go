@@ -0,0 +1,75 @@
+package bqwrapper
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// INTERVAL values as the API returns them: Y-M D H:M:S[.F], where the
+// year-month, day and time parts each have their own sign.
+var intervalSyntax = regexp.MustCompile(`^(-?)(\d+)-(\d+) (-?)(\d+) (-?)(\d+):(\d+):(\d+(?:\.\d+)?)$`)
+
+// Bound of a RANGE that has none.
+const unbounded = "UNBOUNDED"
+
+// Convert an INTERVAL value to ISO 8601 duration, e.g. "1-2 3 4:5:6.5" to
+// "P1Y2M3DT4H5M6.5S". Negative parts are written with a minus sign, and
+// zero parts are left out.
+func intervalISO(s string) (string, error) {
+	var m = intervalSyntax.FindStringSubmatch(s)
+	if m == nil {
+		return "", errors.New("not an interval")
+	}
+	var date = durationPart(m[1], m[2], "Y") + durationPart(m[1], m[3], "M") + durationPart(m[4], m[5], "D")
+	var clock = durationPart(m[6], m[7], "H") + durationPart(m[6], m[8], "M") + durationPart(m[6], m[9], "S")
+	switch {
+	case clock != "":
+		return "P" + date + "T" + clock, nil
+	case date != "":
+		return "P" + date, nil
+	}
+	return "PT0S", nil
+}
+
+// Part of an ISO 8601 duration, "" if n is zero.
+func durationPart(sign, n, unit string) string {
+	if strings.Trim(n, "0.") == "" {
+		return ""
+	}
+	if strings.HasPrefix(n, "0") && len(n) > 1 && n[1] != '.' {
+		n = strings.TrimLeft(n, "0")
+	}
+	return sign + n + unit
+}
+
+// Parse a RANGE value, e.g. "[2024-01-01, 2024-07-01)".
+func parseRange(s string) (Range, error) {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, ")") {
+		return Range{}, errors.New("not a range")
+	}
+	var bounds = strings.Split(s[1:len(s)-1], ",")
+	if len(bounds) != 2 {
+		return Range{}, errors.New("not a range")
+	}
+	var r Range
+	if start := strings.TrimSpace(bounds[0]); start != unbounded {
+		r.Start = &start
+	}
+	if end := strings.TrimSpace(bounds[1]); end != unbounded {
+		r.End = &end
+	}
+	return r, nil
+}
+
+// Range as BigQuery writes it, e.g. "[2024-01-01, UNBOUNDED)".
+func (r Range) String() string {
+	var start, end = unbounded, unbounded
+	if r.Start != nil {
+		start = *r.Start
+	}
+	if r.End != nil {
+		end = *r.End
+	}
+	return "[" + start + ", " + end + ")"
+}
@@ -0,0 +1,191 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"os"
+	"time"
+)
+
+// Create a job journal appending to the file as json lines.
+func NewJobJournal(path string) *JobJournal {
+	return &JobJournal{Path: path}
+}
+
+// Jobs in the journal matching the filter, each with its latest state, in
+// order of submission.
+func (j *JobJournal) List(filter JournalFilter) ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.Open(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading journal - %s", err)
+	}
+	defer f.Close()
+
+	// A job has a line when it's submitted and another once it's done.
+	var entries []JournalEntry
+	var index = make(map[string]int)
+	var sc = bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var e JournalEntry
+		if err = json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("Error reading journal - %s", err)
+		}
+		i, ok := index[e.JobID]
+		if !ok {
+			index[e.JobID] = len(entries)
+			entries = append(entries, e)
+			continue
+		}
+		var prev = entries[i]
+		prev.State, prev.Error, prev.Finished = e.State, e.Error, e.Finished
+		if e.Location != "" {
+			prev.Location = e.Location
+		}
+		if e.Type != "" {
+			prev.Type = e.Type
+		}
+		if e.Target != "" {
+			prev.Target = e.Target
+		}
+		entries[i] = prev
+	}
+	if err = sc.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading journal - %s", err)
+	}
+
+	var list []JournalEntry
+	for _, e := range entries {
+		if filter.match(e) {
+			list = append(list, e)
+		}
+	}
+	return list, nil
+}
+
+// Whether the entry matches the filter.
+func (f JournalFilter) match(e JournalEntry) bool {
+	switch {
+	case f.Type != "" && e.Type != f.Type,
+		f.Target != "" && e.Target != f.Target,
+		!f.Since.IsZero() && e.Submitted.Before(f.Since),
+		f.Incomplete && e.State == "DONE",
+		f.Failed && e.Error == "":
+		return false
+	}
+	return true
+}
+
+// Append the entry to the file.
+func (j *JobJournal) record(e JournalEntry) error {
+	by, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	by = append(by, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(by); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Record the job's current state to the client's journal, if it has one.
+// Failing to record doesn't fail the operation.
+func (c *Client) journalJob(job *bigquery.Job) {
+	if c.Journal == nil || job == nil || job.JobReference == nil {
+		return
+	}
+	var e = JournalEntry{
+		JobID:     job.JobReference.JobId,
+		Location:  job.JobReference.Location,
+		State:     "PENDING",
+		Submitted: time.Now(),
+	}
+	if conf := job.Configuration; conf != nil {
+		e.Type, e.Target = jobType(conf), jobTarget(conf)
+	}
+	if job.Status != nil {
+		if job.Status.State != "" {
+			e.State = job.Status.State
+		}
+		if job.Status.ErrorResult != nil {
+			e.Error = job.Status.ErrorResult.Message
+		}
+	}
+	if st := job.Statistics; st != nil {
+		if st.CreationTime != 0 {
+			e.Submitted = msTime(st.CreationTime)
+		}
+		e.Finished = msTime(st.EndTime)
+	}
+	c.Journal.record(e)
+}
+
+// Wait for a job of the client's journal, e.g. one still running when the
+// process that submitted it stopped, and record its final state.
+// Returns the job's error if it failed.
+func (c *Client) AttachJob(ctx context.Context, jobID string) error {
+	if c.Journal == nil {
+		return errors.New("missing Journal")
+	}
+	entries, err := c.Journal.List(JournalFilter{})
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.JobID == jobID {
+			_, err = c.waitJob(ctx, e.Location, jobID)
+			return err
+		}
+	}
+	return fmt.Errorf("Job %s is not in the journal", jobID)
+}
+
+// Wait for every job of the client's journal not seen done yet, and return
+// them with their final state. A job failing doesn't stop the others.
+func (c *Client) AttachJobs(ctx context.Context) ([]JournalEntry, error) {
+	if c.Journal == nil {
+		return nil, errors.New("missing Journal")
+	}
+	entries, err := c.Journal.List(JournalFilter{Incomplete: true})
+	if err != nil {
+		return nil, err
+	}
+	var jerr *JobError
+	var attached = make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if _, err = c.waitJob(ctx, e.Location, e.JobID); err != nil && !errors.As(err, &jerr) {
+			return nil, err
+		}
+		attached[e.JobID] = true
+	}
+
+	// Waiting recorded where they ended.
+	if entries, err = c.Journal.List(JournalFilter{}); err != nil {
+		return nil, err
+	}
+	var list []JournalEntry
+	for _, e := range entries {
+		if attached[e.JobID] {
+			list = append(list, e)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,142 @@
+package bqwrapper
+
+import (
+	"context"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"regexp"
+	"strings"
+)
+
+// Tables of at least this size are large for LintSelectStar by default.
+const defaultLargeTableBytes = 10 << 30
+
+// Patterns the lint rules look for in queries.
+var (
+	selectStar     = regexp.MustCompile(`(?i)\bSELECT\s+(DISTINCT\s+)?\*(\s*$|\s+FROM\b|\s*,)`)
+	legacyTable    = regexp.MustCompile(`\[[\w.:-]+\]`)
+	legacyFunction = regexp.MustCompile(`(?i)\b(TABLE_DATE_RANGE|TABLE_QUERY|FLATTEN|NEST|WITHIN)\s*\(|\b(JOIN|GROUP)\s+EACH\b`)
+	whereClause    = regexp.MustCompile(`(?i)\bWHERE\b`)
+)
+
+// Check a query before running it: SELECT * on tables of conf.LargeTableBytes
+// or more, partitioned tables without a filter on their partition column,
+// legacy SQL constructs, and bytes processed over conf.MaxBytesProcessed.
+// The query is dry run, which costs nothing, to find the tables it reads and
+// how much. Queries starting with #standardSQL are standard SQL.
+func (c *Client) LintQuery(query string, conf LintConfig) ([]LintIssue, error) {
+	var standard = strings.HasPrefix(query, standardPrefix)
+	var req = &bigquery.QueryRequest{Query: strings.TrimPrefix(query, standardPrefix), Location: c.Location}
+	if standard {
+		req.UseLegacySql = new(bool)
+	}
+	return c.lintQuery(context.Background(), req, conf)
+}
+
+// Lint the query of req, see LintQuery.
+func (c *Client) lintQuery(ctx context.Context, req *bigquery.QueryRequest, conf LintConfig) ([]LintIssue, error) {
+	var standard = req.UseLegacySql != nil && !*req.UseLegacySql
+	job, err := c.bq.Jobs.Insert(c.ProjectID, &bigquery.Job{
+		JobReference: &bigquery.JobReference{ProjectId: c.ProjectID, Location: req.Location},
+		Configuration: &bigquery.JobConfiguration{
+			DryRun: true,
+			Query: &bigquery.JobConfigurationQuery{
+				Query:                req.Query,
+				UseLegacySql:         req.UseLegacySql,
+				ConnectionProperties: req.ConnectionProperties,
+			},
+		},
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Error checking query - %s", err)
+	}
+
+	var issues []LintIssue
+	if m := legacyTable.FindString(req.Query); m != "" && !standard {
+		issues = append(issues, LintIssue{Rule: LintLegacySQL, Message: "legacy table reference " + m})
+	}
+	if m := legacyFunction.FindString(req.Query); m != "" {
+		issues = append(issues, LintIssue{Rule: LintLegacySQL, Message: "legacy SQL " + strings.TrimRight(m, "( ")})
+	}
+
+	var large int64 = defaultLargeTableBytes
+	if conf.LargeTableBytes > 0 {
+		large = conf.LargeTableBytes
+	}
+	var stats *bigquery.JobStatistics2
+	if job.Statistics != nil {
+		stats = job.Statistics.Query
+	}
+	if stats == nil {
+		return issues, nil
+	}
+	var star = selectStar.MatchString(req.Query)
+	var where = whereClause.FindStringIndex(req.Query)
+	for _, ref := range stats.ReferencedTables {
+		table, err := c.bq.Tables.Get(ref.ProjectId, ref.DatasetId, ref.TableId).Context(ctx).Do()
+		if err != nil {
+			return nil, fmt.Errorf("Error getting table - %s", err)
+		}
+		var name = ref.ProjectId + "." + ref.DatasetId + "." + ref.TableId
+		if star && table.NumBytes >= large {
+			issues = append(issues, LintIssue{Rule: LintSelectStar, Table: name,
+				Message: fmt.Sprintf("SELECT * on %s of %d bytes", name, table.NumBytes)})
+		}
+		if col := partitionColumn(table); col != "" &&
+			(where == nil || !strings.Contains(strings.ToLower(req.Query[where[0]:]), strings.ToLower(col))) {
+			issues = append(issues, LintIssue{Rule: LintPartitionFilter, Table: name,
+				Message: fmt.Sprintf("%s is partitioned by %s with no filter on it", name, col)})
+		}
+	}
+	if conf.MaxBytesProcessed > 0 && stats.TotalBytesProcessed > conf.MaxBytesProcessed {
+		issues = append(issues, LintIssue{Rule: LintCost,
+			Message: fmt.Sprintf("query processes %d bytes, over %d", stats.TotalBytesProcessed, conf.MaxBytesProcessed)})
+	}
+	return issues, nil
+}
+
+// Lint the query of a dump, calling conf.Warn with warnings and failing
+// with a *LintError if any issue is of a rule in conf.Errors.
+func (c *Client) lintDump(ctx context.Context, req *bigquery.QueryRequest, conf LintConfig) error {
+	issues, err := c.lintQuery(ctx, req, conf)
+	if err != nil {
+		return err
+	}
+	var errs []LintIssue
+	for _, issue := range issues {
+		if conf.isError(issue.Rule) {
+			errs = append(errs, issue)
+		} else if conf.Warn != nil {
+			conf.Warn(issue)
+		}
+	}
+	if len(errs) != 0 {
+		return &LintError{Issues: errs}
+	}
+	return nil
+}
+
+// Whether issues of the rule are errors.
+func (conf LintConfig) isError(rule string) bool {
+	for _, r := range conf.Errors {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Column a table is partitioned by, _PARTITIONTIME for ingestion time
+// partitioning, "" if it's not partitioned.
+func partitionColumn(table *bigquery.Table) string {
+	switch {
+	case table.TimePartitioning != nil && table.TimePartitioning.Field != "":
+		return table.TimePartitioning.Field
+	case table.TimePartitioning != nil:
+		// _PARTITIONDATE has it as well.
+		return "_PARTITION"
+	case table.RangePartitioning != nil:
+		return table.RangePartitioning.Field
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package bqwrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Load each file of dir.Dir not loaded yet to the table in conf, one load
+// per file in order of name. Files loaded successfully are kept in
+// dir.StateFile with their size and MD5, so a file is loaded again only if
+// it changed.
+//
+// Only files matching dir.Pattern (e.g. "events-*.json") are loaded, by
+// default those of a supported format. The first failing load stops the
+// rest; files loaded before it stay recorded.
+func (c *Client) LoadDirectory(conf LoadConfig, dir DirectoryConfig) error {
+	// Required params check.
+	if dir.Dir == "" || dir.StateFile == "" {
+		return errors.New("missing params")
+	}
+
+	if _, err := filepath.Match(dir.Pattern, ""); err != nil {
+		return fmt.Errorf("Invalid pattern %s - %s", dir.Pattern, err)
+	}
+	defer shareRejects(&conf)()
+
+	state, err := readDirectoryState(dir.StateFile)
+	if err != nil {
+		return err
+	}
+	// The state file may be in the directory itself.
+	stateFile, err := filepath.Abs(dir.StateFile)
+	if err != nil {
+		return err
+	}
+
+	entries, err := ioutil.ReadDir(dir.Dir)
+	if err != nil {
+		return fmt.Errorf("Error reading directory - %s", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+		var name = entry.Name()
+		var path = filepath.Join(dir.Dir, name)
+		if abs, _ := filepath.Abs(path); abs == stateFile || abs == stateFile+".tmp" {
+			continue
+		}
+		if dir.Pattern != "" {
+			if ok, _ := filepath.Match(dir.Pattern, name); !ok {
+				continue
+			}
+		} else if loadFormat(conf, name) == "" {
+			continue
+		}
+
+		sum, err := fileChecksum(path)
+		if err != nil {
+			return err
+		}
+		if prev, ok := state.Files[name]; ok && prev.Size == sum.size && prev.MD5 == sum.md5 {
+			continue
+		}
+
+		var fconf = conf
+		fconf.SourceFile = path
+		if err = c.Load(fconf); err != nil {
+			return fmt.Errorf("Error loading %s - %s", name, err)
+		}
+		state.Files[name] = loadedFile{Size: sum.size, MD5: sum.md5, Loaded: time.Now()}
+		if err = writeDirectoryState(dir.StateFile, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Size and MD5 of a file.
+func fileChecksum(path string) (checksum, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return checksum{}, err
+	}
+	defer f.Close()
+	var sum = newChecksumWriter()
+	if _, err = io.Copy(sum, f); err != nil {
+		return checksum{}, fmt.Errorf("Error reading %s - %s", path, err)
+	}
+	return sum.checksum(), nil
+}
+
+// Read files loaded by LoadDirectory so far, none if the file doesn't exist yet.
+func readDirectoryState(path string) (directoryState, error) {
+	var state directoryState
+	by, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(by, &state)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("Error reading state file - %s", err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]loadedFile)
+	}
+	return state, nil
+}
+
+// Save files loaded by LoadDirectory.
+func writeDirectoryState(path string, state directoryState) error {
+	by, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(path, by, 0666); err != nil {
+		return fmt.Errorf("Error writing state file - %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package bqwrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Suffix of the manifest written next to dump output with DumpConfig.Manifest.
+const manifestSuffix = ".manifest.json"
+
+// Write output.manifest.json listing the files of the dump.
+func (w *dumpWriter) writeManifest() error {
+	var m = dumpManifest{Output: w.conf.Output, Format: w.conf.Format, Rows: w.total, Created: time.Now(), Files: w.manifest}
+	by, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	out, err := w.c.createOutput(w.conf.Output+manifestSuffix, w.conf)
+	if err != nil {
+		return fmt.Errorf("Error creating manifest - %s", err)
+	}
+	if _, err = out.Write(append(by, '\n')); err != nil {
+		out.Abort()
+		return fmt.Errorf("Error writing manifest - %s", err)
+	}
+	if err = out.Commit(); err != nil {
+		return fmt.Errorf("Error writing manifest - %s", err)
+	}
+	return nil
+}
+
+// Load the files listed in a manifest written by a dump with
+// DumpConfig.Manifest to the table in conf, one load per file.
+// Every file is checked against its size and MD5 in the manifest before
+// anything is loaded, so a missing or partly transferred file fails the
+// whole load. Files are looked for next to the manifest.
+func (c *Client) LoadManifest(conf LoadConfig, manifest string) error {
+	// Required params check.
+	if manifest == "" {
+		return errors.New("missing params")
+	}
+	if err := expandFields(conf.Vars, &manifest); err != nil {
+		return err
+	}
+	defer shareRejects(&conf)()
+
+	m, err := c.readManifest(manifest)
+	if err != nil {
+		return err
+	}
+	for _, f := range m.Files {
+		if err = c.checkManifestFile(siblingName(manifest, f.Name), f); err != nil {
+			return fmt.Errorf("Error checking %s - %s", f.Name, err)
+		}
+	}
+
+	for _, f := range m.Files {
+		var fconf = conf
+		fconf.SourceFile = siblingName(manifest, f.Name)
+		if err = c.Load(fconf); err != nil {
+			return fmt.Errorf("Error loading %s - %s", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// Read a dump manifest.
+func (c *Client) readManifest(name string) (dumpManifest, error) {
+	var m dumpManifest
+	r, _, err := c.openSource(name)
+	if err != nil {
+		return m, err
+	}
+	defer r.Close()
+	if err = json.NewDecoder(r).Decode(&m); err != nil {
+		return m, fmt.Errorf("Error reading manifest - %s", err)
+	}
+	return m, nil
+}
+
+// Check a file is complete, i.e. has the size and MD5 of the manifest.
+func (c *Client) checkManifestFile(name string, f manifestFile) error {
+	r, _, err := c.openSource(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	var sum = newChecksumWriter()
+	if _, err = io.Copy(sum, r); err != nil {
+		return err
+	}
+	var got = sum.checksum()
+	if got.size != f.Size {
+		return fmt.Errorf("size is %d bytes, manifest has %d", got.size, f.Size)
+	}
+	if got.md5 != f.MD5 {
+		return errors.New("MD5 doesn't match the manifest")
+	}
+	return nil
+}
+
+// Location of a file in the same directory (or bucket prefix) as another.
+func siblingName(of, name string) string {
+	return of[:strings.LastIndex(of, "/")+1] + name
+}
@@ -0,0 +1,140 @@
+package bqwrapper
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"math/rand"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Kept characters of MaskTruncate without a number.
+const defaultMaskKeep = 4
+
+// Masks columns as set in DumpConfig.Mask before rows reach the writer.
+type maskWriter struct {
+	outputWriter
+	mask map[string]string
+	salt string
+
+	// Schema with masked columns retyped, and the masking of each column
+	// ("" if it's kept) with the characters kept by MaskTruncate.
+	fields []*bigquery.TableFieldSchema
+	policy []string
+	keep   []int
+}
+
+func (w *maskWriter) page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+	if w.fields == nil {
+		if err := w.init(fields); err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		for i, cell := range row.F {
+			if i >= len(w.policy) || w.policy[i] == "" {
+				continue
+			}
+			cell.V = w.maskValue(i, fields[i], cell.V)
+		}
+	}
+	return w.outputWriter.page(w.fields, rows)
+}
+
+// Check the masked columns and work out the schema rows are written with.
+func (w *maskWriter) init(fields []*bigquery.TableFieldSchema) error {
+	var pos = make(map[string]int, len(fields))
+	for i, field := range fields {
+		pos[field.Name] = i
+	}
+	w.policy = make([]string, len(fields))
+	w.keep = make([]int, len(fields))
+	for name, mask := range w.mask {
+		i, ok := pos[name]
+		if !ok {
+			return fmt.Errorf("No such column %s to mask", name)
+		}
+		var policy, keep = mask, defaultMaskKeep
+		if j := strings.Index(mask, ":"); j >= 0 && mask[:j] == MaskTruncate {
+			var err error
+			if keep, err = strconv.Atoi(mask[j+1:]); err != nil || keep < 0 {
+				return fmt.Errorf("Invalid mask %s of column %s", mask, name)
+			}
+			policy = MaskTruncate
+		}
+		switch policy {
+		case MaskRedact:
+		case MaskHash, MaskTruncate, MaskFake:
+			if isRecord(fields[i].Type) || fields[i].Mode == "REPEATED" {
+				return fmt.Errorf("Column %s can only be redacted", name)
+			}
+			if policy == MaskFake && fields[i].Type == "JSON" {
+				return fmt.Errorf("Column %s can't be faked", name)
+			}
+		default:
+			return fmt.Errorf("Invalid mask %s of column %s", mask, name)
+		}
+		w.policy[i], w.keep[i] = policy, keep
+	}
+
+	// Hashed and truncated values are strings whatever the type was.
+	for i, field := range fields {
+		if w.policy[i] == MaskHash || w.policy[i] == MaskTruncate {
+			var f = *field
+			f.Type = "STRING"
+			field = &f
+		}
+		w.fields = append(w.fields, field)
+	}
+	return nil
+}
+
+// Masked value of the i'th column. Nulls stay null.
+func (w *maskWriter) maskValue(i int, field *bigquery.TableFieldSchema, v interface{}) interface{} {
+	if w.policy[i] == MaskRedact {
+		return nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	switch w.policy[i] {
+	case MaskHash:
+		var sum = sha256.Sum256([]byte(w.salt + s))
+		return hex.EncodeToString(sum[:])
+	case MaskTruncate:
+		if r := []rune(s); len(r) > w.keep[i] {
+			return string(r[:w.keep[i]])
+		}
+		return s
+	case MaskFake:
+		return fakeValue(w.salt, s, field.Type == "STRING")
+	}
+	return s
+}
+
+// Value of the same shape as s: each digit replaced with a digit, and each
+// letter with a letter of the same case if letters is set. The same value
+// always gets the same replacement, so masked columns still join.
+func fakeValue(salt, s string, letters bool) string {
+	var sum = sha256.Sum256([]byte(salt + s))
+	var rnd = rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsDigit(r):
+			b.WriteByte(byte('0' + rnd.Intn(10)))
+		case letters && unicode.IsUpper(r):
+			b.WriteByte(byte('A' + rnd.Intn(26)))
+		case letters && unicode.IsLetter(r):
+			b.WriteByte(byte('a' + rnd.Intn(26)))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
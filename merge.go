@@ -0,0 +1,247 @@
+package bqwrapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How long a staging table of MergeLoad is kept if it can't be deleted.
+const mergeStagingExpiration = 24 * time.Hour
+
+// Upsert the data of conf.SourceFile into the table: rows with the same
+// values of the key columns are updated, others are inserted.
+//
+// The data is loaded to a staging table next to the table first, then merged
+// with a MERGE statement, and the staging table is deleted. The table is
+// created if it doesn't exist. Rows with NULL in a key column never match,
+// and the data must not have more than one row with the same keys.
+// RejectFile, DedupKeys, ShardField, ShardDate and HivePartitioning can't be
+// used.
+func (c *Client) MergeLoad(conf LoadConfig, keys []string) error {
+	c.Defaults.load(&conf)
+
+	// Required params check.
+	if conf.DatasetID == "" || conf.TableID == "" || conf.SchemaFile == "" || conf.SourceFile == "" || len(keys) == 0 {
+		return errors.New("missing params")
+	}
+	if err := checkMerge(conf); err != nil {
+		return err
+	}
+	if err := expandFields(conf.Vars, &conf.TableID, &conf.SourceFile); err != nil {
+		return err
+	}
+	ctx, end, err := c.begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	var started = time.Now()
+	fields, err := readSchema(conf.SchemaFile)
+	if err != nil {
+		return c.notifyLoad(conf, started, nil, err)
+	}
+	job, err := c.mergeLoad(ctx, conf, fields, func(target, staging string) (string, error) {
+		return mergeStatement(target, staging, fields, keys, "")
+	})
+	return c.notifyLoad(conf, started, job, err)
+}
+
+// Check conf has none of the options a merge can't do.
+func checkMerge(conf LoadConfig) error {
+	if conf.RejectFile != "" || len(conf.DedupKeys) != 0 || conf.ShardField != "" || !conf.ShardDate.IsZero() || conf.HivePartitioning != nil {
+		return errors.New("RejectFile, DedupKeys, ShardField, ShardDate and HivePartitioning can't be used with a merge")
+	}
+	return checkAfterLoad(conf)
+}
+
+// Apply a change stream in conf.SourceFile (newline delimited json) to the
+// table. Each row has the columns of conf.SchemaFile and cdc.OpColumn
+// telling whether it's an "insert", "update" or "delete" of the row with its
+// keys. Inserts and updates are both upserts. Only the last change of each
+// row by cdc.OrderColumn is applied; without it the data must have at most
+// one change of a row, or the MERGE fails.
+//
+// Changes are loaded to a staging table and merged as MergeLoad does, with
+// the same options.
+func (c *Client) ApplyCDC(conf LoadConfig, cdc CDCConfig) error {
+	c.Defaults.load(&conf)
+
+	// Required params check.
+	if conf.DatasetID == "" || conf.TableID == "" || conf.SchemaFile == "" || conf.SourceFile == "" || len(cdc.Keys) == 0 {
+		return errors.New("missing params")
+	}
+	if err := checkMerge(conf); err != nil {
+		return err
+	}
+	if err := expandFields(conf.Vars, &conf.TableID, &conf.SourceFile); err != nil {
+		return err
+	}
+	ctx, end, err := c.begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer end()
+	if cdc.OpColumn == "" {
+		cdc.OpColumn = "op"
+	}
+	conf.SourceFormat = "json"
+
+	var started = time.Now()
+	job, err := c.applyCDC(ctx, conf, cdc)
+	return c.notifyLoad(conf, started, job, err)
+}
+
+// Run the change stream apply, returning the job loading the staging table.
+func (c *Client) applyCDC(ctx context.Context, conf LoadConfig, cdc CDCConfig) (*bigquery.Job, error) {
+	fields, err := readSchema(conf.SchemaFile)
+	if err != nil {
+		return nil, err
+	}
+	var ordered = cdc.OrderColumn == ""
+	for _, f := range fields {
+		if f.Name == cdc.OpColumn {
+			return nil, fmt.Errorf("Op column %s is in the schema", cdc.OpColumn)
+		}
+		ordered = ordered || f.Name == cdc.OrderColumn
+	}
+	if !ordered {
+		return nil, fmt.Errorf("Order column %s is not in the schema", cdc.OrderColumn)
+	}
+
+	// Staging table has the op column as well.
+	dir, err := ioutil.TempDir("", "bqwrapper")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	by, err := json.Marshal(append(fields[:len(fields):len(fields)], TableField{Name: cdc.OpColumn, Type: "STRING", Mode: "REQUIRED"}))
+	if err != nil {
+		return nil, err
+	}
+	conf.SchemaFile = filepath.Join(dir, "schema.json")
+	if err = ioutil.WriteFile(conf.SchemaFile, by, 0600); err != nil {
+		return nil, fmt.Errorf("Error writing schema - %s", err)
+	}
+
+	return c.mergeLoad(ctx, conf, fields, func(target, staging string) (string, error) {
+		if cdc.OrderColumn != "" {
+			staging = "(SELECT * FROM " + staging + " WHERE TRUE QUALIFY ROW_NUMBER() OVER (PARTITION BY " +
+				quoteColumns(cdc.Keys) + " ORDER BY `" + cdc.OrderColumn + "` DESC) = 1)"
+		}
+		return mergeStatement(target, staging, fields, cdc.Keys, cdc.OpColumn)
+	})
+}
+
+// Load conf.SourceFile to a staging table and merge it into the table with
+// the statement made by merge, creating the table with fields if it doesn't
+// exist. The source gets defaults and validation as in Load. Returns the job
+// loading the staging table.
+func (c *Client) mergeLoad(ctx context.Context, conf LoadConfig, fields []TableField, merge func(target, staging string) (string, error)) (*bigquery.Job, error) {
+	var staging = conf
+	staging.TableID = fmt.Sprintf("%s_merge_%d", conf.TableID, time.Now().UnixNano())
+	staging.Partitioning = ""
+	staging.TableExpiration = mergeStagingExpiration
+	staging.AfterLoad = ""
+	stmt, err := merge(
+		tableName(c.ProjectID, conf.DatasetID, conf.TableID),
+		tableName(c.ProjectID, conf.DatasetID, staging.TableID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Load to the staging table.
+	r, size, err := c.openSource(conf.SourceFile)
+	if err != nil {
+		return nil, err
+	}
+	if r, size, err = applyDefaults(conf, r, size); err != nil {
+		return nil, err
+	}
+	if r, err = c.validateLoad(conf, r); err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	ctx, cancel := loadContext(ctx, conf)
+	defer cancel()
+	job, err := c.load(ctx, staging, conf.SourceFile, r, size)
+	defer c.bq.Tables.Delete(c.ProjectID, conf.DatasetID, staging.TableID).Do()
+	if err != nil {
+		return job, err
+	}
+
+	// Then merge it into the table.
+	var expires time.Time
+	if conf.TableExpiration > 0 {
+		expires = time.Now().Add(conf.TableExpiration)
+	}
+	if err = c.createTable(c.ProjectID, conf.DatasetID, conf.TableID, fields, loadPartitioning(conf), expires); err != nil {
+		return job, err
+	}
+	if err = c.runStatementIn(ctx, stmt); err != nil {
+		return job, fmt.Errorf("Error merging - %s", err)
+	}
+	if conf.AfterLoad != "" {
+		r.Close()
+		return job, afterLoad(conf)
+	}
+	return job, nil
+}
+
+// Generate a MERGE statement upserting rows of source into target on keys.
+// If op is set, it's the column of source telling the change, and rows
+// whose op is "delete" are deleted instead.
+func mergeStatement(target, source string, fields []TableField, keys []string, op string) (string, error) {
+	var names = make(map[string]bool, len(fields))
+	for _, f := range fields {
+		names[f.Name] = true
+	}
+	var on = make([]string, len(keys))
+	var isKey = make(map[string]bool, len(keys))
+	for i, k := range keys {
+		if !names[k] {
+			return "", fmt.Errorf("Key column %s is not in the schema", k)
+		}
+		on[i] = "T.`" + k + "` = S.`" + k + "`"
+		isKey[k] = true
+	}
+
+	var set, cols, vals []string
+	for _, f := range fields {
+		cols = append(cols, "`"+f.Name+"`")
+		vals = append(vals, "S.`"+f.Name+"`")
+		if !isKey[f.Name] {
+			set = append(set, "`"+f.Name+"` = S.`"+f.Name+"`")
+		}
+	}
+
+	var stmt = "MERGE " + target + " T USING " + source + " S ON " + strings.Join(on, " AND ")
+	var insert = " WHEN NOT MATCHED"
+	if op != "" {
+		var deleted = "LOWER(S.`" + op + "`) = 'delete'"
+		stmt += " WHEN MATCHED AND " + deleted + " THEN DELETE"
+		insert += " AND NOT " + deleted
+	}
+	if len(set) != 0 {
+		stmt += " WHEN MATCHED THEN UPDATE SET " + strings.Join(set, ", ")
+	}
+	stmt += insert + " THEN INSERT (" + strings.Join(cols, ", ") + ") VALUES (" + strings.Join(vals, ", ") + ")"
+	return stmt, nil
+}
+
+// Comma separated list of quoted columns.
+func quoteColumns(cols []string) string {
+	var quoted = make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = "`" + col + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
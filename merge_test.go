@@ -0,0 +1,63 @@
+package bqwrapper
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMergeUnsupported(t *testing.T) {
+	// Nothing is sent for a merge it can't do.
+	var c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}))
+	var conf = LoadConfig{DatasetID: "ds", TableID: "t", SchemaFile: "schema.json", SourceFile: "data.json"}
+	for _, set := range []func(*LoadConfig){
+		func(conf *LoadConfig) { conf.RejectFile = "rejects.json" },
+		func(conf *LoadConfig) { conf.DedupKeys = []string{"id"} },
+		func(conf *LoadConfig) { conf.ShardField = "created" },
+		func(conf *LoadConfig) { conf.ShardDate = time.Now() },
+		func(conf *LoadConfig) { conf.HivePartitioning = &HivePartitioning{} },
+		func(conf *LoadConfig) { conf.AfterLoad = "unknown" },
+	} {
+		var conf = conf
+		set(&conf)
+		if err := c.MergeLoad(conf, []string{"id"}); err == nil {
+			t.Errorf("MergeLoad with %+v succeeded", conf)
+		}
+		if err := c.ApplyCDC(conf, CDCConfig{Keys: []string{"id"}}); err == nil {
+			t.Errorf("ApplyCDC with %+v succeeded", conf)
+		}
+	}
+
+	// Nor after Shutdown.
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MergeLoad(conf, []string{"id"}); err != ErrClientClosed {
+		t.Errorf("got %v, want %v", err, ErrClientClosed)
+	}
+	if err := c.ApplyCDC(conf, CDCConfig{Keys: []string{"id"}}); err != ErrClientClosed {
+		t.Errorf("got %v, want %v", err, ErrClientClosed)
+	}
+}
+
+func TestApplyCDCOrderColumn(t *testing.T) {
+	var c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		http.NotFound(w, r)
+	}))
+	var schema = filepath.Join(t.TempDir(), "schema.json")
+	if err := ioutil.WriteFile(schema, []byte(`[{"name": "id", "type": "INTEGER"}, {"name": "name", "type": "STRING"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var conf = LoadConfig{DatasetID: "ds", TableID: "t", SchemaFile: schema, SourceFile: "data.json"}
+	var err = c.ApplyCDC(conf, CDCConfig{Keys: []string{"id"}, OrderColumn: "updated"})
+	if err == nil || err.Error() != "Order column updated is not in the schema" {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package bqwrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Check if the dataset exists in the client's project.
+func (c *Client) DatasetExists(datasetID string) (bool, error) {
+	if datasetID == "" {
+		return false, errors.New("missing params")
+	}
+	_, err := c.bq.Datasets.Get(c.ProjectID, datasetID).Do()
+	if isHTTPError(err, http.StatusNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Error getting dataset - %s", err)
+	}
+	return true, nil
+}
+
+// Check if the table exists in the dataset.
+func (c *Client) TableExists(datasetID, tableID string) (bool, error) {
+	if datasetID == "" || tableID == "" {
+		return false, errors.New("missing params")
+	}
+	_, err := c.bq.Tables.Get(c.ProjectID, datasetID, tableID).Do()
+	if isHTTPError(err, http.StatusNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Error getting table - %s", err)
+	}
+	return true, nil
+}
+
+// Get row count, size, timestamps and schema of the table.
+func (c *Client) GetTableMetadata(datasetID, tableID string) (*TableMetadata, error) {
+	if datasetID == "" || tableID == "" {
+		return nil, errors.New("missing params")
+	}
+	table, err := c.bq.Tables.Get(c.ProjectID, datasetID, tableID).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting table - %s", err)
+	}
+
+	var meta = &TableMetadata{
+		Type:         table.Type,
+		Location:     table.Location,
+		Description:  table.Description,
+		NumRows:      table.NumRows,
+		NumBytes:     table.NumBytes,
+		Created:      msTime(table.CreationTime),
+		LastModified: msTime(int64(table.LastModifiedTime)),
+		Expires:      msTime(table.ExpirationTime),
+	}
+	if table.Schema != nil {
+		meta.Schema = toTableFields(table.Schema.Fields)
+	}
+	return meta, nil
+}
+
+// Write the schema of the table to path as a schema file Load takes.
+// projectID defaults to the client's project.
+func (c *Client) DumpSchema(projectID, datasetID, tableID, path string) error {
+	if datasetID == "" || tableID == "" || path == "" {
+		return errors.New("missing params")
+	}
+	if projectID == "" {
+		projectID = c.ProjectID
+	}
+	table, err := c.bq.Tables.Get(projectID, datasetID, tableID).Do()
+	if err != nil {
+		return fmt.Errorf("Error getting table - %s", err)
+	}
+
+	var fields []TableField
+	if table.Schema != nil {
+		fields = toTableFields(table.Schema.Fields)
+	}
+	by, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(path, append(by, '\n'), 0666); err != nil {
+		return fmt.Errorf("Error writing schema - %s", err)
+	}
+	return nil
+}
+
+// List all tables (and views etc.) of the dataset.
+func (c *Client) listTables(projectID, datasetID string) ([]*bigquery.TableListTables, error) {
+	var tables []*bigquery.TableListTables
+	var token string
+	for {
+		list, err := c.bq.Tables.List(projectID, datasetID).PageToken(token).Do()
+		if err != nil {
+			return nil, fmt.Errorf("Error listing tables - %s", err)
+		}
+		tables = append(tables, list.Tables...)
+		if token = list.NextPageToken; token == "" {
+			return tables, nil
+		}
+	}
+}
+
+// Convert schema returned from BigQuery into the schema format Load takes.
+func toTableFields(fields []*bigquery.TableFieldSchema) []TableField {
+	if len(fields) == 0 {
+		return nil
+	}
+	var result = make([]TableField, 0, len(fields))
+	for _, field := range fields {
+		result = append(result, TableField{
+			Name:   field.Name,
+			Type:   field.Type,
+			Mode:   field.Mode,
+			Fields: toTableFields(field.Fields),
+		})
+	}
+	return result
+}
+
+// Convert partitioning returned from BigQuery into what Load takes.
+func toTimePartitioning(p *bigquery.TimePartitioning) *TimePartitioning {
+	if p == nil {
+		return nil
+	}
+	return &TimePartitioning{Type: p.Type, Field: p.Field, ExpirationMs: p.ExpirationMs}
+}
+
+// Convert schema in Load format into what BigQuery takes.
+func fromTableFields(fields []TableField) []*bigquery.TableFieldSchema {
+	var result = make([]*bigquery.TableFieldSchema, 0, len(fields))
+	for _, field := range fields {
+		result = append(result, &bigquery.TableFieldSchema{
+			Name:   field.Name,
+			Type:   field.Type,
+			Mode:   field.Mode,
+			Fields: fromTableFields(field.Fields),
+		})
+	}
+	return result
+}
+
+// Convert milliseconds since epoch to time. 0 is returned as zero time.
+func msTime(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
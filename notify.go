@@ -0,0 +1,104 @@
+package bqwrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OAuth scope for publishing notifications to Pub/Sub.
+const pubsubScope = "https://www.googleapis.com/auth/pubsub"
+
+// Client posting notifications. It doesn't carry the BigQuery credentials,
+// so they're never sent to a webhook.
+var notifyClient = &http.Client{Timeout: 30 * time.Second}
+
+// Report the outcome of a load or dump as configured, then return err as is.
+// Failing to report doesn't fail the operation.
+func (c *Client) notify(conf NotifyConfig, done Completion, err error) error {
+	if conf.URL == "" && conf.Callback == nil && conf.Topic == "" {
+		return err
+	}
+
+	done.Finished = time.Now()
+	done.Status = "SUCCESS"
+	if err != nil {
+		done.Status = "FAILURE"
+		done.Error = err.Error()
+		var jerr *JobError
+		if done.JobID == "" && errors.As(err, &jerr) {
+			done.JobID = jerr.JobID
+		}
+	}
+
+	if conf.Callback != nil {
+		conf.Callback(done)
+	}
+	if conf.URL == "" && conf.Topic == "" {
+		return err
+	}
+	by, jerr := json.Marshal(done)
+	if jerr != nil {
+		return err
+	}
+	if conf.URL != "" {
+		if res, perr := notifyClient.Post(conf.URL, "application/json", bytes.NewReader(by)); perr == nil {
+			res.Body.Close()
+		}
+	}
+	if conf.Topic != "" {
+		c.publish(conf.Topic, by, map[string]string{
+			"operation": done.Operation,
+			"status":    done.Status,
+		})
+	}
+	return err
+}
+
+// Publish a message to the Pub/Sub topic, either a full name
+// (projects/.../topics/...) or a topic of the client's project.
+func (c *Client) publish(topic string, data []byte, attrs map[string]string) error {
+	if !strings.HasPrefix(topic, "projects/") {
+		topic = "projects/" + c.ProjectID + "/topics/" + topic
+	}
+	by, err := json.Marshal(publishRequest{
+		Messages: []pubsubMessage{{Data: data, Attributes: attrs}},
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.Post("https://pubsub.googleapis.com/v1/"+topic+":publish", "application/json", bytes.NewReader(by))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Did not get OK, got %s", res.Status)
+	}
+	return nil
+}
+
+// Report the outcome of a load job.
+func (c *Client) notifyLoad(conf LoadConfig, started time.Time, job *bigquery.Job, err error) error {
+	var done = Completion{
+		Operation: "load",
+		Table:     c.ProjectID + "." + conf.DatasetID + "." + conf.TableID,
+		Started:   started,
+	}
+	if job != nil {
+		if job.JobReference != nil {
+			done.JobID, done.Location = job.JobReference.JobId, job.JobReference.Location
+		}
+		if job.Statistics != nil && job.Statistics.Load != nil {
+			done.Rows = uint64(job.Statistics.Load.OutputRows)
+			done.Bytes = job.Statistics.Load.InputFileBytes
+		}
+	}
+	return c.notify(conf.Notify, done, err)
+}
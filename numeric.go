@@ -0,0 +1,42 @@
+package bqwrapper
+
+import (
+	"math/big"
+	"regexp"
+)
+
+// NUMERIC and BIGNUMERIC values in decimal notation, as loads take them.
+var decimalSyntax = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// Most digits after the decimal point, those of BIGNUMERIC.
+const maxDecimalScale = 38
+
+// Parse a NUMERIC or BIGNUMERIC value exactly.
+func parseDecimal(s string) (*Decimal, bool) {
+	if !decimalSyntax.MatchString(s) {
+		return nil, false
+	}
+	var d = &Decimal{}
+	if _, ok := d.SetString(s); !ok {
+		return nil, false
+	}
+	return d, true
+}
+
+// Value in decimal notation with as few digits after the decimal point as
+// keep it exact.
+func (d *Decimal) String() string {
+	var back big.Rat
+	for prec := 0; prec < maxDecimalScale; prec++ {
+		var s = d.FloatString(prec)
+		if _, ok := back.SetString(s); ok && back.Cmp(&d.Rat) == 0 {
+			return s
+		}
+	}
+	return d.FloatString(maxDecimalScale)
+}
+
+// Write the value as a json number, so it's not rounded like a float.
+func (d *Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
@@ -0,0 +1,172 @@
+package bqwrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"strings"
+)
+
+// Run steps described in a pipeline file (yaml, or json if the name ends
+// with .json) in order of their dependencies.
+//
+// {{name}} in the file is replaced with the variable as Expand does, with
+// vars in the file. Setting run_date in vars runs the pipeline for that
+// date instead of today.
+//
+// Steps run one at a time. If one fails, the pipeline stops and its error
+// is returned.
+func (c *Client) RunPipeline(path string) error {
+	by, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Error reading pipeline - %s", err)
+	}
+
+	// Variables first, then the whole file with variables replaced.
+	var p Pipeline
+	if err = parsePipeline(path, templateVar.ReplaceAll(by, nil), &p); err != nil {
+		return err
+	}
+	vars, err := templateVars(p.Vars)
+	if err != nil {
+		return err
+	}
+	if by, err = expandVars(vars, by); err != nil {
+		return fmt.Errorf("Error reading pipeline - %s", err)
+	}
+	p = Pipeline{}
+	if err = parsePipeline(path, by, &p); err != nil {
+		return err
+	}
+
+	steps, err := orderSteps(p.Steps)
+	if err != nil {
+		return err
+	}
+	for _, step := range steps {
+		if err = c.runStep(step); err != nil {
+			return fmt.Errorf("Error in step %s - %s", step.Name, err)
+		}
+	}
+	return nil
+}
+
+// Parse a pipeline file.
+func parsePipeline(path string, by []byte, p *Pipeline) error {
+	var err error
+	if strings.HasSuffix(path, ".json") {
+		err = json.Unmarshal(by, p)
+	} else {
+		err = yaml.Unmarshal(by, p)
+	}
+	if err != nil {
+		return fmt.Errorf("Error reading pipeline - %s", err)
+	}
+	return nil
+}
+
+// Order steps so each comes after the ones it needs, otherwise keeping the
+// order of the file.
+func orderSteps(steps []PipelineStep) ([]PipelineStep, error) {
+	var names = make(map[string]bool, len(steps))
+	for _, step := range steps {
+		if step.Name == "" {
+			return nil, errors.New("pipeline step without name")
+		}
+		if names[step.Name] {
+			return nil, fmt.Errorf("Duplicate pipeline step %s", step.Name)
+		}
+		names[step.Name] = true
+	}
+	for _, step := range steps {
+		for _, need := range step.Needs {
+			if !names[need] {
+				return nil, fmt.Errorf("Step %s needs unknown step %s", step.Name, need)
+			}
+		}
+	}
+
+	var result = make([]PipelineStep, 0, len(steps))
+	var done = make(map[string]bool, len(steps))
+	for len(result) < len(steps) {
+		var progress bool
+		for _, step := range steps {
+			if done[step.Name] {
+				continue
+			}
+			var ready = true
+			for _, need := range step.Needs {
+				if !done[need] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				result = append(result, step)
+				done[step.Name] = true
+				progress = true
+			}
+		}
+		if !progress {
+			return nil, errors.New("Pipeline steps depend on each other in a cycle")
+		}
+	}
+	return result, nil
+}
+
+// Run a step of a pipeline.
+func (c *Client) runStep(step PipelineStep) error {
+	switch {
+	case step.Load != nil:
+		var l = step.Load
+		return c.Load(LoadConfig{
+			DatasetID:      l.Dataset,
+			TableID:        l.Table,
+			SchemaFile:     l.Schema,
+			SourceFile:     l.Source,
+			SourceFormat:   l.Format,
+			Partitioning:   l.Partitioning,
+			PartitionField: l.PartitionField,
+			StagingBucket:  l.StagingBucket,
+		})
+	case step.Query != nil:
+		var q = step.Query
+		if q.Table == "" {
+			return c.runStatement(q.SQL)
+		}
+		return c.MaterializeQuery(MaterializeConfig{
+			Query:            q.SQL,
+			Destination:      Destination{ProjectID: c.ProjectID, DatasetID: q.Dataset, TableID: q.Table},
+			WriteDisposition: q.Write,
+			Partition:        q.Partition,
+		})
+	case step.Extract != nil:
+		var e = step.Extract
+		if e.Dataset == "" || e.Table == "" || len(e.URIs) == 0 {
+			return errors.New("missing params")
+		}
+		_, err := c.runJob(&bigquery.JobConfiguration{
+			Extract: &bigquery.JobConfigurationExtract{
+				SourceTable:       &bigquery.TableReference{ProjectId: c.ProjectID, DatasetId: e.Dataset, TableId: e.Table},
+				DestinationUris:   e.URIs,
+				DestinationFormat: e.Format,
+				Compression:       e.Compression,
+			},
+		})
+		return err
+	case step.Dump != nil:
+		var d = step.Dump
+		return c.Dump(DumpConfig{
+			Query:       d.Query,
+			Table:       d.Table,
+			Output:      d.Output,
+			Format:      d.Format,
+			Delimiter:   d.Delimiter,
+			PrintFields: d.PrintFields,
+		})
+	}
+	return errors.New("step has nothing to run")
+}
@@ -0,0 +1,64 @@
+package bqwrapper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Get the execution plan and statistics of a query job, such as the job ID and
+// location a dump reports, to see where a slow query spends its time.
+// The job is looked up in the client's location if location is empty.
+func (c *Client) GetQueryPlan(location, jobID string) (*QueryPlan, error) {
+	if jobID == "" {
+		return nil, errors.New("missing params")
+	}
+	if location == "" {
+		location = c.Location
+	}
+	job, err := c.bq.Jobs.Get(c.ProjectID, jobID).Location(location).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting job - %s", err)
+	}
+	var st = job.Statistics
+	if st == nil || st.Query == nil {
+		return nil, fmt.Errorf("Job %s is not a query", jobID)
+	}
+
+	var plan = &QueryPlan{
+		JobID:          jobID,
+		Started:        msTime(st.StartTime),
+		Finished:       msTime(st.EndTime),
+		BytesProcessed: st.Query.TotalBytesProcessed,
+		BytesBilled:    st.Query.TotalBytesBilled,
+		CacheHit:       st.Query.CacheHit,
+		SlotMs:         st.Query.TotalSlotMs,
+	}
+	if ms := st.EndTime - st.StartTime; st.EndTime != 0 && ms > 0 {
+		plan.AvgSlots = float64(plan.SlotMs) / float64(ms)
+	}
+	for _, s := range st.Query.QueryPlan {
+		var stage = QueryStage{
+			ID:                        s.Id,
+			Name:                      s.Name,
+			Status:                    s.Status,
+			Started:                   msTime(s.StartMs),
+			Finished:                  msTime(s.EndMs),
+			RecordsRead:               s.RecordsRead,
+			RecordsWritten:            s.RecordsWritten,
+			ShuffleOutputBytes:        s.ShuffleOutputBytes,
+			ShuffleOutputBytesSpilled: s.ShuffleOutputBytesSpilled,
+			SlotMs:                    s.SlotMs,
+			WaitMsMax:                 s.WaitMsMax,
+			ReadMsMax:                 s.ReadMsMax,
+			ComputeMsMax:              s.ComputeMsMax,
+			WriteMsMax:                s.WriteMsMax,
+		}
+		for _, step := range s.Steps {
+			stage.Steps = append(stage.Steps, step.Kind+": "+strings.Join(step.Substeps, "; "))
+		}
+		plan.ShuffleOutputBytes += s.ShuffleOutputBytes
+		plan.Stages = append(plan.Stages, stage)
+	}
+	return plan, nil
+}
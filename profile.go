@@ -0,0 +1,120 @@
+package bqwrapper
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Profile file in the home directory, and the profile used if none is named.
+const (
+	profileFile    = ".bqwrapper.yaml"
+	defaultProfile = "default"
+)
+
+// Environment variables with defaults for client settings.
+const (
+	envProject     = "BQWRAPPER_PROJECT"
+	envCredentials = "BQWRAPPER_CREDENTIALS"
+	envLocation    = "BQWRAPPER_LOCATION"
+	envProxy       = "BQWRAPPER_PROXY"
+)
+
+// Create a client from a named profile of ~/.bqwrapper.yaml, "default" if
+// name is empty.
+func NewClientFromProfile(name string) (*Client, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewClientFromProfileFile(filepath.Join(home, profileFile), name)
+}
+
+// Create a client from a named profile of the file, "default" if name is
+// empty.
+func NewClientFromProfileFile(path, name string) (*Client, error) {
+	p, err := readProfile(path, name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := NewClientWithTransport(p.Project, expandHome(p.Credentials), TransportConfig{
+		Proxy:        p.Proxy,
+		UserAgent:    p.UserAgent,
+		QuotaProject: p.QuotaProject,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p.Location != "" {
+		c.Location = p.Location
+	}
+	c.KMSKeyName = p.KMSKeyName
+	c.CancelJobs = p.CancelJobs
+	c.Defaults = p.Defaults
+	return c, nil
+}
+
+// Read a profile from the file.
+func readProfile(path, name string) (Profile, error) {
+	if name == "" {
+		name = defaultProfile
+	}
+	by, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Profile{}, fmt.Errorf("Error reading profiles - %s", err)
+	}
+	var f ProfileFile
+	if err = yaml.Unmarshal(by, &f); err != nil {
+		return Profile{}, fmt.Errorf("Error reading profiles - %s", err)
+	}
+	p, ok := f.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("No such profile %s", name)
+	}
+	return p, nil
+}
+
+// Path with a leading ~/ replaced with the home directory.
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
+
+// Fill in the load's options left empty.
+func (d ClientDefaults) load(conf *LoadConfig) {
+	if conf.DatasetID == "" {
+		conf.DatasetID = d.DatasetID
+	}
+}
+
+// Fill in the dump's options left empty.
+func (d ClientDefaults) dump(conf *DumpConfig) {
+	if conf.Format == "" {
+		conf.Format = d.Format
+	}
+	if conf.Delimiter == "" {
+		conf.Delimiter = d.Delimiter
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = d.Timeout
+	}
+	if conf.PageSize == 0 {
+		conf.PageSize = d.PageSize
+	}
+}
+
+// Set an empty value from the environment variable.
+func envDefault(val *string, name string) {
+	if *val == "" {
+		*val = os.Getenv(name)
+	}
+}
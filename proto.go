@@ -0,0 +1,359 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// Message TIMESTAMP values can be written to besides integer and string
+// fields.
+const timestampMessage = "google.protobuf.Timestamp"
+
+// Writes dump output as length-delimited protobuf messages: each row is a
+// message of conf.ProtoMessage preceded by its size as a varint, the way
+// protodelim and Java's parseDelimitedFrom read them.
+// RECORDs go to message fields and REPEATED fields to repeated ones.
+type protoWriter struct {
+	rowTracker
+	c    *Client
+	conf DumpConfig
+
+	// Message of rows, and the field of each column.
+	md     protoreflect.MessageDescriptor
+	cols   []fieldType
+	fields []protoField
+
+	// BYTES are written raw to bytes fields, and TIMESTAMPs converted with
+	// their fraction of a second for protoValue.
+	mapping map[string]string
+	conv    converters
+
+	out  SinkWriter
+	w    *bufio.Writer
+	size [binary.MaxVarintLen64]byte
+
+	// Rows written.
+	total uint64
+}
+
+// Field of the message a column, or a field of a RECORD, is written to.
+type protoField struct {
+	name string
+	fd   protoreflect.FieldDescriptor
+
+	// Whether the column is a TIMESTAMP.
+	timestamp bool
+
+	// Fields of the RECORD by name, if it is one.
+	sub map[string]protoField
+}
+
+func newProtoWriter(c *Client, conf DumpConfig) *protoWriter {
+	var w = &protoWriter{c: c, conf: conf, mapping: map[string]string{}, conv: dumpConverters(conf)}
+	w.skip = conf.SkipBadRows
+	for k, v := range conf.TypeMapping {
+		w.mapping[k] = v
+	}
+	w.mapping["BYTES"] = MapRaw
+	w.mapping["TIMESTAMP"] = MapRFC3339
+	return w
+}
+
+// Write a page of rows, a message each.
+func (w *protoWriter) page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+	if w.out == nil {
+		if err := w.open(fields); err != nil {
+			return err
+		}
+	}
+
+	var val interface{}
+	var err error
+	for n, row := range rows {
+		var msg = dynamicpb.NewMessage(w.md)
+		for i, col := range w.cols {
+			if val, err = convertValue(col, col.value(row), w.mapping, w.conv); err != nil {
+				break
+			}
+			if err = setProto(msg, w.fields[i], val); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			if err = w.badRow(row, n, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = w.write(msg); err != nil {
+			return fmt.Errorf("Error writing output - %s", err)
+		}
+		w.total++
+	}
+	w.pageDone(len(rows))
+	return nil
+}
+
+// Write a message with its size.
+func (w *protoWriter) write(msg proto.Message) error {
+	by, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var n = binary.PutUvarint(w.size[:], uint64(len(by)))
+	if _, err = w.w.Write(w.size[:n]); err != nil {
+		return err
+	}
+	_, err = w.w.Write(by)
+	return err
+}
+
+// Find the message and the field of each column, and create the output.
+func (w *protoWriter) open(fields []*bigquery.TableFieldSchema) error {
+	var err error
+	if w.md, err = loadProtoMessage(w.conf.ProtoDescriptor, w.conf.ProtoMessage); err != nil {
+		return err
+	}
+	w.cols = resultColumns(fields, false)
+	w.fields = make([]protoField, len(w.cols))
+	for i, col := range w.cols {
+		if w.fields[i], err = w.protoField(w.md, col.field, col.name); err != nil {
+			return err
+		}
+	}
+
+	if w.out, err = w.c.createOutput(w.conf.Output, w.conf); err != nil {
+		return fmt.Errorf("Error creating output - %s", err)
+	}
+	w.w = bufio.NewWriter(w.out)
+	return nil
+}
+
+// Field of the message the column (path is its name, e.g. "addr.city") is
+// written to, by its name or as set in ProtoFields.
+func (w *protoWriter) protoField(md protoreflect.MessageDescriptor, field *bigquery.TableFieldSchema, path string) (protoField, error) {
+	var name = field.Name
+	if n, ok := w.conf.ProtoFields[path]; ok {
+		name = n
+	}
+	var fd = md.Fields().ByName(protoreflect.Name(name))
+	if fd == nil {
+		return protoField{}, fmt.Errorf("No field %s in %s for %s", name, md.FullName(), path)
+	}
+	if fd.IsMap() {
+		return protoField{}, fmt.Errorf("Unsupported map field %s for %s", fd.FullName(), path)
+	}
+	var pf = protoField{name: path, fd: fd, timestamp: field.Type == "TIMESTAMP"}
+	if !isRecord(field.Type) {
+		return pf, nil
+	}
+	if fd.Kind() != protoreflect.MessageKind {
+		return protoField{}, fmt.Errorf("Field %s for RECORD %s isn't a message", fd.FullName(), path)
+	}
+	pf.sub = make(map[string]protoField, len(field.Fields))
+	for _, sub := range field.Fields {
+		var err error
+		if pf.sub[sub.Name], err = w.protoField(fd.Message(), sub, path+"."+sub.Name); err != nil {
+			return protoField{}, err
+		}
+	}
+	return pf, nil
+}
+
+// Flush and commit the output.
+func (w *protoWriter) close() error {
+	if w.out == nil {
+		return nil
+	}
+	if err := w.w.Flush(); err != nil {
+		w.out.Abort()
+		return fmt.Errorf("Error writing output - %s", err)
+	}
+	return w.out.Commit()
+}
+
+// Number of rows written.
+func (w *protoWriter) count() uint64 {
+	return w.total
+}
+
+// Give up on the output.
+func (w *protoWriter) abort() {
+	if w.out != nil {
+		w.out.Abort()
+	}
+}
+
+// Descriptor of the message in a descriptor set file, as written by protoc
+// --descriptor_set_out with --include_imports.
+func loadProtoMessage(file, name string) (protoreflect.MessageDescriptor, error) {
+	by, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading descriptor - %s", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err = proto.Unmarshal(by, &set); err != nil {
+		return nil, fmt.Errorf("Error reading descriptor - %s", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading descriptor - %s", err)
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("No message %s in %s", name, file)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s in %s isn't a message", name, file)
+	}
+	return md, nil
+}
+
+// Set the field of the message to a converted value, appending each item
+// of REPEATED ones. Nulls are left unset.
+func setProto(msg protoreflect.Message, pf protoField, val interface{}) error {
+	if val == nil {
+		return nil
+	}
+	if !pf.fd.IsList() {
+		v, err := protoValue(pf, val, func() protoreflect.Message { return msg.NewField(pf.fd).Message() })
+		if err != nil {
+			return err
+		}
+		msg.Set(pf.fd, v)
+		return nil
+	}
+
+	list, ok := val.([]interface{})
+	if !ok {
+		list = []interface{}{val}
+	}
+	var l = msg.Mutable(pf.fd).List()
+	for _, item := range list {
+		if item == nil {
+			continue
+		}
+		v, err := protoValue(pf, item, func() protoreflect.Message { return l.NewElement().Message() })
+		if err != nil {
+			return err
+		}
+		l.Append(v)
+	}
+	return nil
+}
+
+// Value of the field for a single converted value. Messages are made with
+// newMsg.
+func protoValue(pf protoField, val interface{}, newMsg func() protoreflect.Message) (protoreflect.Value, error) {
+	var fd = pf.fd
+	if fd.Kind() == protoreflect.MessageKind {
+		var m = newMsg()
+		if rec, ok := val.(map[string]interface{}); ok && pf.sub != nil {
+			for name, sub := range pf.sub {
+				if err := setProto(m, sub, rec[name]); err != nil {
+					return protoreflect.Value{}, err
+				}
+			}
+			return protoreflect.ValueOfMessage(m), nil
+		}
+		if fd.Message().FullName() != timestampMessage {
+			return protoreflect.Value{}, fmt.Errorf("Invalid %s value (%v) - can't be written to %s", pf.name, val, fd.FullName())
+		}
+		t, err := protoTime(val)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("Invalid %s value (%v) - %s", pf.name, val, err)
+		}
+		var tf = fd.Message().Fields()
+		m.Set(tf.ByName("seconds"), protoreflect.ValueOfInt64(t.Unix()))
+		m.Set(tf.ByName("nanos"), protoreflect.ValueOfInt32(int32(t.Nanosecond())))
+		return protoreflect.ValueOfMessage(m), nil
+	}
+
+	// TIMESTAMPs go to integer fields as microseconds since epoch, as the
+	// Storage Write API takes them.
+	if pf.timestamp {
+		switch fd.Kind() {
+		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+			t, err := protoTime(val)
+			if err != nil {
+				return protoreflect.Value{}, fmt.Errorf("Invalid %s value (%v) - %s", pf.name, val, err)
+			}
+			return protoreflect.ValueOfInt64(t.UnixNano() / int64(time.Microsecond)), nil
+		}
+	}
+
+	// Scalars are parsed from their csv text.
+	var s = csvString(val)
+	var v protoreflect.Value
+	var err error
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(s)
+	case protoreflect.BytesKind:
+		v = protoreflect.ValueOfBytes([]byte(s))
+	case protoreflect.BoolKind:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var i int64
+		i, err = strconv.ParseInt(s, 10, 32)
+		v = protoreflect.ValueOfInt32(int32(i))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var i int64
+		i, err = strconv.ParseInt(s, 10, 64)
+		v = protoreflect.ValueOfInt64(i)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var u uint64
+		u, err = strconv.ParseUint(s, 10, 32)
+		v = protoreflect.ValueOfUint32(uint32(u))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var u uint64
+		u, err = strconv.ParseUint(s, 10, 64)
+		v = protoreflect.ValueOfUint64(u)
+	case protoreflect.FloatKind:
+		var f float64
+		f, err = strconv.ParseFloat(s, 32)
+		v = protoreflect.ValueOfFloat32(float32(f))
+	case protoreflect.DoubleKind:
+		var f float64
+		f, err = strconv.ParseFloat(s, 64)
+		v = protoreflect.ValueOfFloat64(f)
+	case protoreflect.EnumKind:
+		// By the name of the value, or its number.
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			v = protoreflect.ValueOfEnum(ev.Number())
+		} else {
+			var i int64
+			i, err = strconv.ParseInt(s, 10, 32)
+			v = protoreflect.ValueOfEnum(protoreflect.EnumNumber(i))
+		}
+	default:
+		err = fmt.Errorf("unsupported field kind %s", fd.Kind())
+	}
+	if err != nil {
+		return protoreflect.Value{}, fmt.Errorf("Invalid %s value (%s) - %s", pf.name, s, err)
+	}
+	return v, nil
+}
+
+// Time of a TIMESTAMP value, converted to RFC3339 with its fraction of a
+// second.
+func protoTime(val interface{}) (time.Time, error) {
+	if v, ok := val.(string); ok {
+		return time.Parse(time.RFC3339Nano, v)
+	}
+	return time.Time{}, errors.New("not a timestamp")
+}
@@ -0,0 +1,81 @@
+package bqwrapper
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+)
+
+// Message with a field of each kind TIMESTAMPs can be written to.
+func timestampMessageDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	var field = func(name string, n int32, typ descriptorpb.FieldDescriptorProto_Type, msg string) *descriptorpb.FieldDescriptorProto {
+		var f = &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(n),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   typ.Enum(),
+		}
+		if msg != "" {
+			f.TypeName = proto.String(msg)
+		}
+		return f
+	}
+	var fd = &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("row.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Row"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("micros", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+				field("ts", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Timestamp"),
+				field("text", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+			},
+		}},
+	}
+	files, err := protodesc.NewFiles(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(timestamppb.File_google_protobuf_timestamp_proto), fd,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := files.FindDescriptorByName("test.Row")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.(protoreflect.MessageDescriptor)
+}
+
+func TestProtoTimestampFraction(t *testing.T) {
+	var md = timestampMessageDescriptor(t)
+	var w = newProtoWriter(&Client{}, DumpConfig{})
+	var col = fieldType{name: "created", ftype: "TIMESTAMP"}
+	val, err := convertValue(col, "1.408452095123456E9", w.mapping, converters{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg = dynamicpb.NewMessage(md)
+	for _, name := range []string{"micros", "ts", "text"} {
+		var pf = protoField{name: "created", fd: md.Fields().ByName(protoreflect.Name(name)), timestamp: true}
+		if err = setProto(msg, pf, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := msg.Get(md.Fields().ByName("micros")).Int(); got != 1408452095123456 {
+		t.Errorf("got %d microseconds", got)
+	}
+	var ts = msg.Get(md.Fields().ByName("ts")).Message()
+	var tf = ts.Descriptor().Fields()
+	if s, n := ts.Get(tf.ByName("seconds")).Int(), ts.Get(tf.ByName("nanos")).Int(); s != 1408452095 || n != 123456000 {
+		t.Errorf("got timestamp %d.%09d", s, n)
+	}
+	if got := msg.Get(md.Fields().ByName("text")).String(); got != "2014-08-19T12:41:35.123456Z" {
+		t.Errorf("got text %s", got)
+	}
+}
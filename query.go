@@ -0,0 +1,177 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Column name, or path of a nested field, allowed in DumpConfig.Columns.
+var columnName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// How far back time travel can go.
+const timeTravelWindow = 7 * 24 * time.Hour
+
+// Run a query and write its results straight into a table, without going
+// through local disk.
+//
+// If conf.Partition is set (e.g. "20240101"), only that partition of the
+// destination table is written.
+func (c *Client) MaterializeQuery(conf MaterializeConfig) error {
+	// Required params check.
+	if conf.Query == "" || conf.Destination.DatasetID == "" || conf.Destination.TableID == "" {
+		return errors.New("missing params")
+	}
+	if err := expandFields(conf.Vars, &conf.Query, &conf.Destination.TableID, &conf.Partition); err != nil {
+		return err
+	}
+	if err := conf.Destination.Validate(); err != nil {
+		return err
+	}
+
+	// Destination defaults to the client's project.
+	var dest = conf.Destination
+	if dest.ProjectID == "" {
+		dest.ProjectID = c.ProjectID
+	}
+
+	// Check the dataset before running the query, same as Load.
+	if err := c.checkDataset(dest.ProjectID, dest.DatasetID, !conf.NoCreateDataset); err != nil {
+		return fmt.Errorf("Error checking/creating dataset - %s", err)
+	}
+
+	// Partition decorator goes after the table name.
+	var table = dest.TableID
+	if conf.Partition != "" {
+		table += "$" + conf.Partition
+	}
+
+	var disposition = conf.WriteDisposition
+	if disposition == "" {
+		disposition = WriteEmpty
+	}
+
+	// Generate job configuration.
+	var query = &bigquery.JobConfigurationQuery{
+		Query: conf.Query,
+		DestinationTable: &bigquery.TableReference{
+			ProjectId: dest.ProjectID,
+			DatasetId: dest.DatasetID,
+			TableId:   table,
+		},
+		CreateDisposition:                  "CREATE_IF_NEEDED",
+		WriteDisposition:                   disposition,
+		AllowLargeResults:                  true,
+		DestinationEncryptionConfiguration: c.encryption(),
+	}
+	if conf.NoCache {
+		query.UseQueryCache = new(bool)
+	}
+
+	// Send it and wait until it's done.
+	_, err := c.runJob(&bigquery.JobConfiguration{Query: query})
+	return err
+}
+
+// Run a single standard SQL statement (DDL, DML) and wait until it's done.
+func (c *Client) runStatement(sql string) error {
+	return c.runStatementIn(context.Background(), sql)
+}
+
+// Run a statement until it's done or ctx is.
+func (c *Client) runStatementIn(ctx context.Context, sql string) error {
+	_, err := c.runJobIn(ctx, c.Location, &bigquery.JobConfiguration{
+		Query: &bigquery.JobConfigurationQuery{
+			Query:        sql,
+			UseLegacySql: new(bool),
+		},
+	})
+	return err
+}
+
+// Fully qualified table name for standard SQL.
+func tableName(projectID, datasetID, tableID string) string {
+	return "`" + projectID + "." + datasetID + "." + tableID + "`"
+}
+
+// Quote a string literal for standard SQL.
+func sqlString(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
+
+// Generate a standard SQL query selecting the whole table.
+// Table is "dataset.table" or "project.dataset.table". If asOf is set, the
+// table is read as it was at that time, which has to be within the time travel window.
+func tableQuery(projectID, table string, asOf time.Time) (string, error) {
+	ref, err := splitTable(projectID, table)
+	if err != nil {
+		return "", err
+	}
+
+	var query = "SELECT * FROM " + tableName(ref.ProjectId, ref.DatasetId, ref.TableId)
+	if asOf.IsZero() {
+		return query, nil
+	}
+	if time.Since(asOf) > timeTravelWindow {
+		return "", fmt.Errorf("%s is outside of the time travel window", asOf.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s FOR SYSTEM_TIME AS OF TIMESTAMP_MILLIS(%d)",
+		query, asOf.UnixNano()/int64(time.Millisecond)), nil
+}
+
+// Select about percent of rows of the query's results.
+// If table is set, the query selects a whole table which is sampled with
+// TABLESAMPLE instead.
+func sampleQuery(query string, percent float64, table bool) string {
+	if table {
+		return fmt.Sprintf("%s TABLESAMPLE SYSTEM (%g PERCENT)", query, percent)
+	}
+	return fmt.Sprintf("SELECT * FROM (%s) WHERE RAND() < %g", query, percent/100)
+}
+
+// Select only the columns ("addr.city" for nested ones) of the query's
+// results, checking they're names of columns. Names are quoted for standard
+// SQL, legacy SQL takes them as they are.
+func columnsQuery(query string, columns []string, standard bool) (string, error) {
+	var seen = make(map[string]bool, len(columns))
+	var list = make([]string, len(columns))
+	for i, col := range columns {
+		if !columnName.MatchString(col) {
+			return "", fmt.Errorf("Invalid column %s", col)
+		}
+		if seen[col] {
+			return "", fmt.Errorf("Duplicate column %s", col)
+		}
+		seen[col] = true
+		list[i] = col
+		if standard {
+			list[i] = "`" + strings.Replace(col, ".", "`.`", -1) + "`"
+		}
+	}
+	return "SELECT " + strings.Join(list, ", ") + " FROM (" + query + ")", nil
+}
+
+// Reference to table "dataset.table" or "project.dataset.table", where
+// project defaults to projectID.
+// Wildcard tables ("events_*") can be read as well.
+func splitTable(projectID, table string) (*bigquery.TableReference, error) {
+	var name = strings.Trim(table, "`")
+	var wildcard = strings.HasSuffix(name, "*")
+	d, err := ParseDestination(strings.TrimSuffix(name, "*"))
+	if err != nil {
+		return nil, err
+	}
+	if wildcard {
+		d.TableID += "*"
+	}
+	if d.ProjectID == "" {
+		d.ProjectID = projectID
+	}
+	return &bigquery.TableReference{ProjectId: d.ProjectID, DatasetId: d.DatasetID, TableId: d.TableID}, nil
+}
@@ -0,0 +1,193 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Default number of times a load is retried without bad records.
+const defaultRejectRetries = 3
+
+// Byte position of a bad record in BigQuery's error messages, e.g. "JSON
+// parsing error in row starting at position 1234" or "... starting at
+// location 1234 with message ...".
+var rejectPosition = regexp.MustCompile(`(?:row starting at position|starting at location) (\d+)`)
+
+// Retry a load that failed on bad records without them, writing the lines of
+// the bad records to conf.RejectFile, shared with the other loads of the
+// call. Each retry reads the source of the
+// previous one, since positions in the errors are relative to it.
+func (c *Client) loadWithoutRejects(ctx context.Context, conf LoadConfig, jerr *JobError) (*bigquery.Job, error) {
+	if conf.SourceFile == "-" {
+		return nil, jerr
+	}
+	var retries = conf.RejectRetries
+	if retries == 0 {
+		retries = defaultRejectRetries
+	}
+	if conf.SourceFormat == "" {
+		conf.SourceFormat = "json"
+		if loadFormat(conf, conf.SourceFile) == "" {
+			conf.SourceFormat = "csv"
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "bqwrapper")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var source = conf.SourceFile
+	for i := 0; i < retries; i++ {
+		var positions = rejectPositions(jerr)
+		if len(positions) == 0 {
+			return nil, jerr
+		}
+
+		// Copy the source without the bad records.
+		var next = filepath.Join(dir, "source-"+strconv.Itoa(i))
+		n, err := c.splitRejects(source, next, positions, conf.rejects)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, jerr
+		}
+		source = next
+
+		r, size, err := c.openSource(source)
+		if err != nil {
+			return nil, err
+		}
+		job, err := c.load(ctx, conf, source, r, size)
+		r.Close()
+		var ok bool
+		if jerr, ok = err.(*JobError); !ok {
+			return job, err
+		}
+	}
+	return nil, jerr
+}
+
+// Reject file shared by the loads of a call, e.g. the files of LoadDirectory
+// or shards of a ShardField load, created on the first bad record so it's
+// truncated once per call. Loads write whole lines, one at a time.
+type rejectFile struct {
+	name string
+	mu   sync.Mutex
+	f    *os.File
+}
+
+// Share a reject file between the loads of conf, unless they already do.
+// Returns a func closing it once they're done.
+func shareRejects(conf *LoadConfig) func() {
+	if conf.RejectFile == "" || conf.rejects != nil {
+		return func() {}
+	}
+	var r = &rejectFile{name: conf.RejectFile}
+	conf.rejects = r
+	return func() { r.Close() }
+}
+
+func (r *rejectFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		f, err := os.Create(r.name)
+		if err != nil {
+			return 0, fmt.Errorf("Error creating reject file - %s", err)
+		}
+		r.f = f
+	}
+	return r.f.Write(p)
+}
+
+func (r *rejectFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	var err = r.f.Close()
+	r.f = nil
+	return err
+}
+
+// Byte positions of bad records reported in the job's errors, in order.
+func rejectPositions(jerr *JobError) []int64 {
+	var positions []int64
+	for _, item := range append([]JobErrorItem{jerr.Result}, jerr.Errors...) {
+		for _, m := range rejectPosition.FindAllStringSubmatch(item.Message, -1) {
+			if pos, err := strconv.ParseInt(m[1], 10, 64); err == nil {
+				positions = append(positions, pos)
+			}
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+	return positions
+}
+
+// Copy lines of source to dst, except the ones at the positions, which are
+// written to rejects. Returns the number of lines rejected.
+// Records are taken to be lines, so this doesn't work for CSV with
+// newlines in quoted fields.
+func (c *Client) splitRejects(source, dst string, positions []int64, rejects io.Writer) (int, error) {
+	r, _, err := c.openSource(source)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var br = bufio.NewReader(r)
+	var w = bufio.NewWriter(f)
+	var pos int64
+	var n int
+	for {
+		line, rerr := br.ReadBytes('\n')
+		var end = pos + int64(len(line))
+		var rejected bool
+		for len(positions) != 0 && positions[0] < end {
+			rejected = rejected || positions[0] >= pos
+			positions = positions[1:]
+		}
+		if rejected {
+			n++
+			if len(line) != 0 && line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			_, err = rejects.Write(line)
+		} else {
+			_, err = w.Write(line)
+		}
+		if err != nil {
+			return 0, err
+		}
+		pos = end
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return 0, fmt.Errorf("Error reading source - %s", rerr)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return 0, err
+	}
+	return n, f.Close()
+}
@@ -0,0 +1,61 @@
+package bqwrapper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSharedRejects(t *testing.T) {
+	var name = filepath.Join(t.TempDir(), "rejects")
+	if err := ioutil.WriteFile(name, []byte("previous run\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var conf = LoadConfig{RejectFile: name}
+	var done = shareRejects(&conf)
+
+	// Loads of the call, e.g. shards, write at once and share it again.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(sconf LoadConfig, i int) {
+			defer wg.Done()
+			defer shareRejects(&sconf)()
+			for j := 0; j < 100; j++ {
+				if _, err := sconf.rejects.Write([]byte(fmt.Sprintf("%d-%d\n", i, j))); err != nil {
+					t.Error(err)
+				}
+			}
+		}(conf, i)
+	}
+	wg.Wait()
+	done()
+
+	by, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines = strings.Split(strings.TrimSuffix(string(by), "\n"), "\n")
+	if len(lines) != 800 {
+		t.Fatalf("got %d lines, want 800", len(lines))
+	}
+	sort.Strings(lines)
+	for i := 1; i < len(lines); i++ {
+		if lines[i] == lines[i-1] || strings.Count(lines[i], "-") != 1 {
+			t.Fatalf("bad line %q", lines[i])
+		}
+	}
+
+	// Nothing rejected, nothing written.
+	os.Remove(name)
+	conf = LoadConfig{RejectFile: name}
+	shareRejects(&conf)()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("reject file created without rejects: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Check the dump can be resumed with conf.ResumeFile.
+func checkResume(conf DumpConfig) error {
+	if conf.ResumeFile == "" {
+		return nil
+	}
+	if conf.Format != "json" && conf.Format != "csv" {
+		return errors.New("ResumeFile needs json or csv output")
+	}
+	u, err := parseLocation(conf.Output, "stdout")
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "file" {
+		return errors.New("ResumeFile needs a local output file")
+	}
+	if len(conf.Fields) != 0 || conf.CacheDir != "" || len(conf.Failover) != 0 {
+		return errors.New("ResumeFile can't be used with Fields, CacheDir or Failover")
+	}
+	return nil
+}
+
+// Run the dump's query as a job and write out its results page by page,
+// saving progress to conf.ResumeFile after each page. If the file has
+// progress of the same query, the job's results are read on from the page
+// after the last one saved, appending to the output written so far.
+// The file is removed once the dump succeeds.
+func (c *Client) resumeDump(ctx context.Context, conf DumpConfig, req *bigquery.QueryRequest, w outputWriter, done *Completion) error {
+	var dw = innerDumpWriter(w)
+	state, err := readProgress(conf.ResumeFile)
+	if err != nil {
+		return err
+	}
+	// Output is kept as it is when the dump fails, see checkResume.
+	var ok bool
+	defer func() {
+		if !ok {
+			w.abort()
+		}
+	}()
+
+	ctx, end, err := c.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+	release, err := c.acquireJob(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var jobID, location, token string
+	if state.JobID != "" && state.Query == req.Query {
+		if err = dw.restore(state); err != nil {
+			return fmt.Errorf("Error resuming dump - %s", err)
+		}
+		jobID, location, token = state.JobID, state.Location, state.PageToken
+	} else {
+		location = req.Location
+		if jobID, err = c.insertJob(ctx, location, &bigquery.JobConfiguration{
+			Query: &bigquery.JobConfigurationQuery{
+				Query:                req.Query,
+				UseLegacySql:         req.UseLegacySql,
+				UseQueryCache:        req.UseQueryCache,
+				ConnectionProperties: req.ConnectionProperties,
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	done.JobID, done.Location = jobID, location
+	defer func() {
+		if ctx.Err() != nil {
+			c.cancelJob(location, jobID)
+		}
+	}()
+
+	for {
+		call := c.bq.Jobs.GetQueryResults(c.ProjectID, jobID)
+		call.Location(location).Context(ctx)
+		if token != "" {
+			call.PageToken(token)
+		}
+		if conf.PageSize > 0 {
+			call.MaxResults(conf.PageSize)
+		}
+		res, err := call.Do()
+		if err != nil {
+			return fmt.Errorf("Error getting query results - %s", err)
+		}
+		if len(res.Errors) != 0 {
+			c.auditJobID(location, jobID, res.Errors)
+			return newJobError(jobID, nil, res.Errors)
+		}
+		if !res.JobComplete {
+			// Ask again in a while, as waitJob does.
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("Stopped waiting for job %s - %s", jobID, ctx.Err())
+			case <-time.After(3 * time.Second):
+			}
+			continue
+		}
+		if res.Schema == nil {
+			return errors.New("Error getting reply, no schema data returned")
+		}
+		if err = w.page(res.Schema.Fields, res.Rows); err != nil {
+			return err
+		}
+		if token = res.PageToken; token == "" {
+			break
+		}
+
+		state, err = dw.progress()
+		if err != nil {
+			return err
+		}
+		state.Query, state.JobID, state.Location, state.PageToken = req.Query, jobID, location, token
+		if err = writeProgress(conf.ResumeFile, state); err != nil {
+			return err
+		}
+	}
+	c.auditJobID(location, jobID, nil)
+	release()
+
+	ok = true
+	if err = c.closeOutput(w, conf, location, done); err != nil {
+		return err
+	}
+	if err = os.Remove(conf.ResumeFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error removing resume file - %s", err)
+	}
+	return nil
+}
+
+// The dumpWriter under writers wrapping it.
+func innerDumpWriter(w outputWriter) *dumpWriter {
+	for w != nil {
+		if dw, ok := w.(*dumpWriter); ok {
+			return dw
+		}
+		w = wrappedOutput(w)
+	}
+	return nil
+}
+
+// Flush rows written so far to the output and tell how far it got.
+func (w *dumpWriter) progress() (dumpProgress, error) {
+	var p = dumpProgress{
+		Files:    w.files,
+		Open:     w.out != nil,
+		Rows:     w.rows,
+		Size:     w.size,
+		Total:    w.total,
+		Read:     w.read,
+		Skipped:  w.skipped,
+		Manifest: w.manifest,
+		Updated:  time.Now(),
+	}
+	if w.out != nil {
+		if err := w.w.Flush(); err != nil {
+			return p, fmt.Errorf("Error writing output - %s", err)
+		}
+	}
+	return p, nil
+}
+
+// Continue the output of an earlier run as saved by progress. The file being
+// written is opened again and cut back to where its last saved page ended.
+func (w *dumpWriter) restore(p dumpProgress) error {
+	w.files, w.rows, w.size, w.total = p.Files, p.Rows, p.Size, p.Total
+	w.read, w.skipped, w.manifest = p.Read, p.Skipped, p.Manifest
+	if !p.Open || len(p.Files) == 0 {
+		return nil
+	}
+
+	u, err := parseLocation(p.Files[len(p.Files)-1], "stdout")
+	if err != nil {
+		return err
+	}
+	out, err := reopenFile(u.Path, p.Size, w.conf)
+	if err != nil {
+		return err
+	}
+	w.out = out
+	if !w.conf.Manifest {
+		w.w = bufio.NewWriter(out)
+		return nil
+	}
+	// The checksums cover the whole file.
+	w.sum = newChecksumWriter()
+	if _, err = io.Copy(w.sum, io.NewSectionReader(out.f, 0, p.Size)); err != nil {
+		out.Abort()
+		w.out = nil
+		return err
+	}
+	w.w = bufio.NewWriter(io.MultiWriter(out, w.sum))
+	return nil
+}
+
+// Read progress of a dump, empty if the file doesn't exist yet.
+func readProgress(path string) (dumpProgress, error) {
+	var p dumpProgress
+	by, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(by, &p)
+	}
+	if err != nil {
+		return p, fmt.Errorf("Error reading resume file - %s", err)
+	}
+	return p, nil
+}
+
+// Save progress of a dump.
+func writeProgress(path string, p dumpProgress) error {
+	by, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(path, by, 0666); err != nil {
+		return fmt.Errorf("Error writing resume file - %s", err)
+	}
+	return nil
+}
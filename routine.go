@@ -0,0 +1,117 @@
+package bqwrapper
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"net/http"
+)
+
+// Create a UDF or stored procedure.
+// If the routine already exists it's replaced when replace is set, otherwise
+// an error is returned.
+func (c *Client) CreateRoutine(r Routine, replace bool) error {
+	if r.DatasetID == "" || r.RoutineID == "" || r.Body == "" {
+		return errors.New("missing params")
+	}
+	if r.ProjectID == "" {
+		r.ProjectID = c.ProjectID
+	}
+
+	var routine = &bigquery.Routine{
+		RoutineReference: &bigquery.RoutineReference{
+			ProjectId: r.ProjectID,
+			DatasetId: r.DatasetID,
+			RoutineId: r.RoutineID,
+		},
+		RoutineType:       r.Type,
+		Language:          r.Language,
+		DefinitionBody:    r.Body,
+		Description:       r.Description,
+		ImportedLibraries: r.Libraries,
+	}
+	if routine.RoutineType == "" {
+		routine.RoutineType = RoutineFunction
+	}
+	if r.ReturnType != "" {
+		routine.ReturnType = &bigquery.StandardSqlDataType{TypeKind: r.ReturnType}
+	}
+	for _, arg := range r.Arguments {
+		routine.Arguments = append(routine.Arguments, &bigquery.Argument{
+			Name:     arg.Name,
+			DataType: &bigquery.StandardSqlDataType{TypeKind: arg.Type},
+		})
+	}
+
+	_, err := c.bq.Routines.Insert(r.ProjectID, r.DatasetID, routine).Do()
+	if err != nil && replace && isHTTPError(err, http.StatusConflict) {
+		_, err = c.bq.Routines.Update(r.ProjectID, r.DatasetID, r.RoutineID, routine).Do()
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating routine %s - %s", r.RoutineID, err)
+	}
+	return nil
+}
+
+// Delete a routine from the dataset.
+func (c *Client) DeleteRoutine(datasetID, routineID string) error {
+	if datasetID == "" || routineID == "" {
+		return errors.New("missing params")
+	}
+	if err := c.bq.Routines.Delete(c.ProjectID, datasetID, routineID).Do(); err != nil {
+		return fmt.Errorf("Error deleting routine %s - %s", routineID, err)
+	}
+	return nil
+}
+
+// List routines in the dataset.
+func (c *Client) ListRoutines(datasetID string) ([]Routine, error) {
+	if datasetID == "" {
+		return nil, errors.New("missing params")
+	}
+
+	var routines []Routine
+	req := c.bq.Routines.List(c.ProjectID, datasetID)
+	for {
+		res, err := req.Do()
+		if err != nil {
+			return nil, fmt.Errorf("Error listing routines - %s", err)
+		}
+		for _, r := range res.Routines {
+			routines = append(routines, toRoutine(r))
+		}
+		if res.NextPageToken == "" {
+			break
+		}
+		req.PageToken(res.NextPageToken)
+	}
+	return routines, nil
+}
+
+// Convert a routine returned from BigQuery.
+// Note the list call doesn't return definition body or arguments.
+func toRoutine(r *bigquery.Routine) Routine {
+	var routine = Routine{
+		Type:        r.RoutineType,
+		Language:    r.Language,
+		Body:        r.DefinitionBody,
+		Description: r.Description,
+		Libraries:   r.ImportedLibraries,
+	}
+	if r.RoutineReference != nil {
+		routine.ProjectID = r.RoutineReference.ProjectId
+		routine.DatasetID = r.RoutineReference.DatasetId
+		routine.RoutineID = r.RoutineReference.RoutineId
+	}
+	if r.ReturnType != nil {
+		routine.ReturnType = r.ReturnType.TypeKind
+	}
+	for _, arg := range r.Arguments {
+		var a = RoutineArgument{Name: arg.Name}
+		if arg.DataType != nil {
+			a.Type = arg.DataType.TypeKind
+		}
+		routine.Arguments = append(routine.Arguments, a)
+	}
+	return routine
+}
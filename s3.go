@@ -0,0 +1,74 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"time"
+)
+
+// Default S3 endpoint, used if S3Source.Endpoint isn't set.
+const defaultS3Endpoint = "s3.amazonaws.com"
+
+// Load an object of S3 compatible storage (S3, MinIO, etc.) to BigQuery.
+// The object is streamed straight into the upload without going through
+// local disk. Its key tells the format (.json or .csv), conf.SourceFile is
+// not used.
+func (c *Client) LoadFromS3(src S3Source, conf LoadConfig) error {
+	c.Defaults.load(&conf)
+
+	// Required params check.
+	if src.Bucket == "" || src.Key == "" || conf.DatasetID == "" || conf.TableID == "" || conf.SchemaFile == "" {
+		return errors.New("missing params")
+	}
+	if err := expandFields(conf.Vars, &conf.TableID); err != nil {
+		return err
+	}
+
+	var started = time.Now()
+	obj, size, err := openS3(src)
+	if err != nil {
+		return c.notifyLoad(conf, started, nil, err)
+	}
+	defer obj.Close()
+
+	var ctx, cancel = loadContext(context.Background(), conf)
+	defer cancel()
+	job, err := c.load(ctx, conf, "s3://"+src.Bucket+"/"+src.Key, obj, size)
+	return c.notifyLoad(conf, started, job, timeoutError(ctx, conf, err))
+}
+
+// Open the object for reading, returning its size as well.
+// If no access key is given, credentials are taken from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func openS3(src S3Source) (*minio.Object, int64, error) {
+	var endpoint = src.Endpoint
+	if endpoint == "" {
+		endpoint = defaultS3Endpoint
+	}
+	var creds = credentials.NewEnvAWS()
+	if src.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(src.AccessKeyID, src.SecretAccessKey, src.SessionToken)
+	}
+	s3, err := minio.New(endpoint, &minio.Options{
+		Creds:  creds,
+		Secure: !src.Insecure,
+		Region: src.Region,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error creating S3 client - %s", err)
+	}
+
+	obj, err := s3.GetObject(context.Background(), src.Bucket, src.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, 0, fmt.Errorf("Error getting object - %s", err)
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, 0, fmt.Errorf("Error getting object - %s", err)
+	}
+	return obj, info.Size, nil
+}
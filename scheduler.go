@@ -0,0 +1,139 @@
+package bqwrapper
+
+import (
+	"errors"
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"time"
+)
+
+// Create a scheduler running jobs with the client.
+func (c *Client) NewScheduler() *Scheduler {
+	return &Scheduler{c: c}
+}
+
+// Run conf as a load on the cron schedule (e.g. "0 3 * * *").
+func (s *Scheduler) AddLoad(name, spec string, conf LoadConfig) error {
+	return s.Add(name, spec, func(c *Client) error {
+		return c.Load(conf)
+	})
+}
+
+// Run conf as a dump on the cron schedule (e.g. "*/15 * * * *").
+func (s *Scheduler) AddDump(name, spec string, conf DumpConfig) error {
+	return s.Add(name, spec, func(c *Client) error {
+		return c.Dump(conf)
+	})
+}
+
+// Run fn on the cron schedule.
+// Names must be unique. Jobs can be added before or after Start.
+func (s *Scheduler) Add(name, spec string, fn func(c *Client) error) error {
+	if name == "" || fn == nil {
+		return errors.New("missing params")
+	}
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return fmt.Errorf("Invalid schedule %s - %s", spec, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.status.Name == name {
+			return fmt.Errorf("Job %s already exists", name)
+		}
+	}
+	var job = &scheduledJob{schedule: sched, fn: fn}
+	job.status.Name = name
+	job.status.Schedule = spec
+	s.jobs = append(s.jobs, job)
+	if s.stop != nil {
+		s.start(job)
+	}
+	return nil
+}
+
+// Start running jobs on their schedules.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	for _, job := range s.jobs {
+		s.start(job)
+	}
+}
+
+// Stop scheduling jobs, and wait for the ones running to finish.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Status of each job, in the order they were added.
+func (s *Scheduler) Status() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result = make([]ScheduleStatus, len(s.jobs))
+	for i, job := range s.jobs {
+		result[i] = job.status
+	}
+	return result
+}
+
+// Run the job on its schedule until stop is closed.
+// A run that comes while the previous one is still going is skipped.
+func (s *Scheduler) start(job *scheduledJob) {
+	var stop = s.stop
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			var next = job.schedule.Next(time.Now())
+			s.mu.Lock()
+			job.status.Next = next
+			s.mu.Unlock()
+
+			var timer = time.NewTimer(time.Until(next))
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			s.mu.Lock()
+			if job.status.Running {
+				job.status.Skipped++
+				s.mu.Unlock()
+				continue
+			}
+			job.status.Running = true
+			job.status.LastStart = time.Now()
+			s.mu.Unlock()
+
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				var err = job.fn(s.c)
+				s.mu.Lock()
+				job.status.Running = false
+				job.status.LastEnd = time.Now()
+				job.status.LastError = err
+				job.status.Runs++
+				if err != nil {
+					job.status.Failures++
+				}
+				s.mu.Unlock()
+			}()
+		}
+	}()
+}
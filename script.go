@@ -0,0 +1,149 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"sort"
+)
+
+// Run a multi-statement SQL script (DECLARE, BEGIN...END, temp tables, etc.)
+// and return results of each statement it ran.
+//
+// Scripts run as standard SQL. If conf.SessionID is set the script runs in
+// that session, and if conf.CreateSession is set a new session is created;
+// its ID is returned in the result so later scripts and dumps can use it.
+func (c *Client) RunScript(conf ScriptConfig) (*ScriptResult, error) {
+	if conf.Script == "" {
+		return nil, errors.New("missing params")
+	}
+	if err := checkTypeMapping(conf.TypeMapping); err != nil {
+		return nil, err
+	}
+
+	// Generate job configuration.
+	var query = &bigquery.JobConfigurationQuery{
+		Query:         conf.Script,
+		UseLegacySql:  new(bool),
+		CreateSession: conf.CreateSession,
+	}
+	if conf.SessionID != "" {
+		query.ConnectionProperties = []*bigquery.ConnectionProperty{
+			{Key: "session_id", Value: conf.SessionID},
+		}
+	}
+
+	// Send it.
+	ctx, end, err := c.begin(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	release, err := c.acquireJob(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	parent, err := c.insertJob(ctx, c.Location, &bigquery.JobConfiguration{Query: query})
+	if err != nil {
+		return nil, err
+	}
+
+	// Now wait until the whole script is done.
+	job, err := c.waitJob(ctx, c.Location, parent)
+	if err != nil {
+		return nil, err
+	}
+	release()
+
+	var result = &ScriptResult{JobID: parent, SessionID: conf.SessionID}
+	if job.Statistics != nil && job.Statistics.SessionInfo != nil {
+		result.SessionID = job.Statistics.SessionInfo.SessionId
+	}
+
+	// Each statement ran as a child job of the script.
+	children, err := childJobs(c.bq, c.ProjectID, parent)
+	if err != nil {
+		return nil, err
+	}
+	var stmt StatementResult
+	for _, child := range children {
+		stmt = StatementResult{JobID: child.JobReference.JobId}
+		if child.Statistics != nil {
+			if child.Statistics.ScriptStatistics != nil && len(child.Statistics.ScriptStatistics.StackFrames) != 0 {
+				stmt.Text = child.Statistics.ScriptStatistics.StackFrames[0].Text
+			}
+			if q := child.Statistics.Query; q != nil {
+				stmt.StatementType = q.StatementType
+				stmt.AffectedRows = q.NumDmlAffectedRows
+				stmt.BytesProcessed = q.TotalBytesProcessed
+			}
+		}
+
+		// Only SELECTs have rows worth returning.
+		if stmt.StatementType == "SELECT" {
+			fields, rows, err := c.queryResults(stmt.JobID)
+			if err != nil {
+				return nil, err
+			}
+			if stmt.Rows, err = toRows(fields, rows, conf.TypeMapping, converters{}, false, nil); err != nil {
+				return nil, err
+			}
+		}
+		result.Statements = append(result.Statements, stmt)
+	}
+
+	return result, nil
+}
+
+// List child jobs of the parent job, in the order they were created.
+func childJobs(bq *bigquery.Service, pid, parent string) ([]*bigquery.JobListJobs, error) {
+	var jobs []*bigquery.JobListJobs
+	req := bq.Jobs.List(pid).ParentJobId(parent).Projection("full")
+	for {
+		res, err := req.Do()
+		if err != nil {
+			return nil, fmt.Errorf("Error listing child jobs - %s", err)
+		}
+		jobs = append(jobs, res.Jobs...)
+		if res.NextPageToken == "" {
+			break
+		}
+		req.PageToken(res.NextPageToken)
+	}
+
+	// Jobs are listed newest first.
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Statistics == nil || jobs[j].Statistics == nil {
+			return false
+		}
+		return jobs[i].Statistics.CreationTime < jobs[j].Statistics.CreationTime
+	})
+	return jobs, nil
+}
+
+// Fetch all result rows of a finished query job, following page tokens.
+func (c *Client) queryResults(jid string) ([]*bigquery.TableFieldSchema, []*bigquery.TableRow, error) {
+	var fields []*bigquery.TableFieldSchema
+	var rows []*bigquery.TableRow
+	req := c.bq.Jobs.GetQueryResults(c.ProjectID, jid).Location(c.Location)
+	for {
+		res, err := req.Do()
+		if err != nil {
+			return nil, nil, fmt.Errorf("Error getting query results - %s", err)
+		}
+		if len(res.Errors) != 0 {
+			return nil, nil, newJobError(jid, nil, res.Errors)
+		}
+		if res.Schema != nil {
+			fields = res.Schema.Fields
+		}
+		rows = append(rows, res.Rows...)
+		if res.PageToken == "" {
+			break
+		}
+		req.PageToken(res.PageToken)
+	}
+	return fields, rows, nil
+}
@@ -0,0 +1,114 @@
+package bqwrapper
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"strings"
+)
+
+// Create (or replace) a row access policy on the table.
+// Only rows matching the filter are visible to the grantees.
+func (c *Client) CreateRowAccessPolicy(p RowAccessPolicy) error {
+	if p.DatasetID == "" || p.TableID == "" || p.PolicyID == "" ||
+		p.Filter == "" || len(p.Grantees) == 0 {
+		return errors.New("missing params")
+	}
+
+	var grantees = make([]string, len(p.Grantees))
+	for i, g := range p.Grantees {
+		grantees[i] = sqlString(g)
+	}
+	return c.runStatement(fmt.Sprintf(
+		"CREATE OR REPLACE ROW ACCESS POLICY `%s` ON %s GRANT TO (%s) FILTER USING (%s)",
+		p.PolicyID, tableName(c.ProjectID, p.DatasetID, p.TableID),
+		strings.Join(grantees, ", "), p.Filter,
+	))
+}
+
+// Delete a row access policy from the table.
+func (c *Client) DeleteRowAccessPolicy(datasetID, tableID, policyID string) error {
+	if datasetID == "" || tableID == "" || policyID == "" {
+		return errors.New("missing params")
+	}
+	return c.runStatement(fmt.Sprintf("DROP ROW ACCESS POLICY `%s` ON %s",
+		policyID, tableName(c.ProjectID, datasetID, tableID)))
+}
+
+// List row access policies on the table.
+// BigQuery doesn't return grantees here, only the policy and its filter.
+func (c *Client) ListRowAccessPolicies(datasetID, tableID string) ([]RowAccessPolicy, error) {
+	if datasetID == "" || tableID == "" {
+		return nil, errors.New("missing params")
+	}
+
+	var policies []RowAccessPolicy
+	req := c.bq.RowAccessPolicies.List(c.ProjectID, datasetID, tableID)
+	for {
+		res, err := req.Do()
+		if err != nil {
+			return nil, fmt.Errorf("Error listing row access policies - %s", err)
+		}
+		for _, p := range res.RowAccessPolicies {
+			var policy = RowAccessPolicy{DatasetID: datasetID, TableID: tableID, Filter: p.FilterPredicate}
+			if p.RowAccessPolicyReference != nil {
+				policy.PolicyID = p.RowAccessPolicyReference.PolicyId
+			}
+			policies = append(policies, policy)
+		}
+		if res.NextPageToken == "" {
+			break
+		}
+		req.PageToken(res.NextPageToken)
+	}
+	return policies, nil
+}
+
+// Set policy tags on columns of the table for column-level security.
+// tags maps column names ("addr.city" for nested ones) to policy tag resource
+// names. An empty list removes the tags from the column.
+func (c *Client) SetPolicyTags(datasetID, tableID string, tags map[string][]string) error {
+	if datasetID == "" || tableID == "" || len(tags) == 0 {
+		return errors.New("missing params")
+	}
+
+	// Schema has to be sent as a whole, so get the current one first.
+	table, err := c.bq.Tables.Get(c.ProjectID, datasetID, tableID).Do()
+	if err != nil {
+		return fmt.Errorf("Error getting table - %s", err)
+	}
+	if table.Schema == nil {
+		return errors.New("Error getting table, no schema returned")
+	}
+
+	for name, names := range tags {
+		field := findField(table.Schema.Fields, name)
+		if field == nil {
+			return fmt.Errorf("No such column %s", name)
+		}
+		field.PolicyTags = &bigquery.TableFieldSchemaPolicyTags{Names: names}
+	}
+
+	_, err = c.bq.Tables.Patch(c.ProjectID, datasetID, tableID, &bigquery.Table{
+		Schema: table.Schema,
+	}).Do()
+	if err != nil {
+		return fmt.Errorf("Error updating schema - %s", err)
+	}
+	return nil
+}
+
+// Find a field in the schema by its (dotted, for nested fields) name.
+func findField(fields []*bigquery.TableFieldSchema, name string) *bigquery.TableFieldSchema {
+	var parts = strings.SplitN(name, ".", 2)
+	for _, field := range fields {
+		if field.Name != parts[0] {
+			continue
+		}
+		if len(parts) == 1 {
+			return field
+		}
+		return findField(field.Fields, parts[1])
+	}
+	return nil
+}
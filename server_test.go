@@ -0,0 +1,87 @@
+package bqwrapper
+
+import (
+	"context"
+	"encoding/json"
+	"google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/option"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// Client whose requests, to BigQuery, GCS or any other host, are served by
+// h instead.
+func newTestClient(t testing.TB, h http.Handler) *Client {
+	t.Helper()
+	var srv = httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var client = &http.Client{Transport: &testTransport{host: u.Host, base: srv.Client().Transport}}
+	bq, err := bigquery.NewService(context.Background(), option.WithHTTPClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Client{ProjectID: "test", client: client, bq: bq}
+}
+
+// Sends requests to the test server whatever their host is.
+type testTransport struct {
+	host string
+	base http.RoundTripper
+}
+
+func (t *testTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = "http", t.host
+	return t.base.RoundTrip(req)
+}
+
+// Write v as a json response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Schema of synthetic results, with a column of each common type and a
+// RECORD.
+func testSchema() []*bigquery.TableFieldSchema {
+	return []*bigquery.TableFieldSchema{
+		{Name: "id", Type: "INTEGER"},
+		{Name: "name", Type: "STRING"},
+		{Name: "score", Type: "FLOAT"},
+		{Name: "active", Type: "BOOLEAN"},
+		{Name: "created", Type: "TIMESTAMP"},
+		{Name: "price", Type: "NUMERIC"},
+		{Name: "addr", Type: "RECORD", Fields: []*bigquery.TableFieldSchema{
+			{Name: "city", Type: "STRING"},
+			{Name: "zip", Type: "STRING"},
+		}},
+	}
+}
+
+// n rows of testSchema, with ids from first on.
+func testRows(first, n int) []*bigquery.TableRow {
+	var rows = make([]*bigquery.TableRow, n)
+	for i := range rows {
+		var id = strconv.Itoa(first + i)
+		rows[i] = &bigquery.TableRow{F: []*bigquery.TableCell{
+			{V: id},
+			{V: "name, \"quoted\" " + id},
+			{V: "1234.5678"},
+			{V: "true"},
+			{V: "1.4084520952E9"},
+			{V: "99.990000001"},
+			{V: map[string]interface{}{"f": []interface{}{
+				map[string]interface{}{"v": "Tokyo"},
+				map[string]interface{}{"v": "100-0001"},
+			}}},
+		}}
+	}
+	return rows
+}
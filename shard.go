@@ -0,0 +1,239 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Timestamp layouts accepted for ShardField, as BigQuery loads them.
+var shardTimestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 MST",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// Table of the shard of the date, e.g. events_20240101.
+func shardTable(table string, date time.Time) string {
+	return table + "_" + date.Format("20060102")
+}
+
+// Split the source of the load into one file per date of conf.ShardField,
+// then load each to its shard table in order of date. The source is read
+// as a whole before anything is loaded, so a row without a valid date
+// fails the load before any shard is written.
+func (c *Client) loadShards(ctx context.Context, conf LoadConfig) error {
+	fields, err := readSchema(conf.SchemaFile)
+	if err != nil {
+		return err
+	}
+	var index = -1
+	for i, field := range fields {
+		if field.Name == conf.ShardField {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("No such field %s to shard by", conf.ShardField)
+	}
+	var field = fields[index]
+	switch field.Type {
+	case "TIMESTAMP", "DATE", "DATETIME":
+	default:
+		return fmt.Errorf("ShardField %s is %s, not a date", field.Name, field.Type)
+	}
+
+	r, _, err := c.openSource(conf.SourceFile)
+	if err != nil {
+		return err
+	}
+	var shards = make(map[string]*shardFile)
+	defer func() {
+		for _, s := range shards {
+			s.f.Close()
+			os.Remove(s.f.Name())
+		}
+	}()
+	var format = loadFormat(conf, conf.SourceFile)
+	switch format {
+	case "NEWLINE_DELIMITED_JSON":
+		err = splitJSONShards(r, field, shards)
+	case "CSV":
+		err = splitCSVShards(r, field, index, shards)
+	default:
+		err = errors.New("Unsupported source file format")
+	}
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	var dates = make([]string, 0, len(shards))
+	for date, s := range shards {
+		if err = s.flush(); err != nil {
+			return fmt.Errorf("Error writing shard - %s", err)
+		}
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		var sconf = conf
+		sconf.ShardField, sconf.AfterLoad, sconf.Vars = "", "", nil
+		sconf.TableID = conf.TableID + "_" + date
+		sconf.SourceFile = shards[date].f.Name()
+		sconf.SourceFormat = "json"
+		if format == "CSV" {
+			sconf.SourceFormat = "csv"
+		}
+		if err = c.LoadContext(ctx, sconf); err != nil {
+			return fmt.Errorf("Error loading shard %s - %s", sconf.TableID, err)
+		}
+	}
+	if conf.AfterLoad != "" {
+		return afterLoad(conf)
+	}
+	return nil
+}
+
+// Temporary file of a shard's rows.
+type shardFile struct {
+	f   *os.File
+	w   *bufio.Writer
+	csv *csv.Writer
+}
+
+// The shard of the date, created on first use.
+func shardFor(shards map[string]*shardFile, date string) (*shardFile, error) {
+	if s, ok := shards[date]; ok {
+		return s, nil
+	}
+	f, err := ioutil.TempFile("", "bqwrapper")
+	if err != nil {
+		return nil, fmt.Errorf("Error creating shard - %s", err)
+	}
+	var s = &shardFile{f: f, w: bufio.NewWriter(f)}
+	s.csv = csv.NewWriter(s.w)
+	shards[date] = s
+	return s, nil
+}
+
+func (s *shardFile) flush() error {
+	s.csv.Flush()
+	if err := s.csv.Error(); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// Copy each line of newline delimited json to the shard of its date.
+func splitJSONShards(r io.Reader, field TableField, shards map[string]*shardFile) error {
+	var br = bufio.NewReader(r)
+	for line := int64(1); ; line++ {
+		by, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(by)) != 0 {
+			var row map[string]interface{}
+			var dec = json.NewDecoder(bytes.NewReader(by))
+			dec.UseNumber()
+			if derr := dec.Decode(&row); derr != nil {
+				return fmt.Errorf("Malformed json at line %d - %s", line, derr)
+			}
+			var val string
+			switch v := row[field.Name].(type) {
+			case string:
+				val = v
+			case json.Number:
+				val = string(v)
+			}
+			date, derr := shardDate(field.Type, val)
+			if derr != nil {
+				return fmt.Errorf("Invalid %s at line %d - %s", field.Name, line, derr)
+			}
+			s, serr := shardFor(shards, date)
+			if serr != nil {
+				return serr
+			}
+			if !bytes.HasSuffix(by, []byte("\n")) {
+				by = append(by, '\n')
+			}
+			if _, werr := s.w.Write(by); werr != nil {
+				return fmt.Errorf("Error writing shard - %s", werr)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading source - %s", err)
+		}
+	}
+}
+
+// Copy each csv record to the shard of the date in its column index.
+func splitCSVShards(r io.Reader, field TableField, index int, shards map[string]*shardFile) error {
+	var cr = csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading source - %s", err)
+		}
+		line, _ := cr.FieldPos(0)
+		var val string
+		if index < len(record) {
+			val = record[index]
+		}
+		date, err := shardDate(field.Type, val)
+		if err != nil {
+			return fmt.Errorf("Invalid %s at line %d - %s", field.Name, line, err)
+		}
+		s, err := shardFor(shards, date)
+		if err != nil {
+			return err
+		}
+		if err = s.csv.Write(record); err != nil {
+			return fmt.Errorf("Error writing shard - %s", err)
+		}
+	}
+}
+
+// Shard suffix (yyyymmdd) of a value of the field. Timestamps are sharded
+// by their date in UTC, dates and datetimes by the date as it's written.
+func shardDate(ftype, val string) (string, error) {
+	if val == "" {
+		return "", errors.New("no value")
+	}
+	if ftype != "TIMESTAMP" {
+		if len(val) >= 10 {
+			if t, err := time.Parse("2006-01-02", val[:10]); err == nil {
+				return t.Format("20060102"), nil
+			}
+		}
+		return "", fmt.Errorf("invalid %s value %s", strings.ToLower(ftype), val)
+	}
+	for _, layout := range shardTimestampLayouts {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t.UTC().Format("20060102"), nil
+		}
+	}
+	// Seconds since the epoch.
+	if t, err := parseTimestamp(val); err == nil {
+		return t.UTC().Format("20060102"), nil
+	}
+	return "", fmt.Errorf("invalid timestamp value %s", val)
+}
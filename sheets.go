@@ -0,0 +1,186 @@
+package bqwrapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"google.golang.org/api/bigquery/v2"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const sheetsScope = "https://www.googleapis.com/auth/spreadsheets"
+
+const sheetsURL = "https://sheets.googleapis.com/v4/spreadsheets/"
+
+// Default tab rows are written to.
+const defaultSheetTab = "Sheet1"
+
+// Number of rows sent by a single append request.
+const sheetsBatchRows = 5000
+
+// Spreadsheet ID in a spreadsheet URL.
+var sheetsID = regexp.MustCompile(`/spreadsheets/d/([\w-]+)`)
+
+// Writes dump output into a tab of a Google Sheet.
+// Rows are kept in memory and written once the dump completes, so a failed
+// dump leaves the tab as it was. The tab is created if it doesn't exist,
+// otherwise it's emptied first.
+type sheetsWriter struct {
+	rowTracker
+	c    *Client
+	conf DumpConfig
+	conv converters
+	id   string
+	tab  string
+
+	// Columns, sorted the same way as csv output, and rows including the
+	// header.
+	names  []string
+	values [][]interface{}
+
+	// Rows written.
+	total uint64
+}
+
+func newSheetsWriter(c *Client, conf DumpConfig) *sheetsWriter {
+	var w = &sheetsWriter{c: c, conf: conf, conv: dumpConverters(conf), id: conf.Output, tab: conf.SheetTab}
+	if m := sheetsID.FindStringSubmatch(conf.Output); m != nil {
+		w.id = m[1]
+	}
+	if w.tab == "" {
+		w.tab = defaultSheetTab
+	}
+	w.skip = conf.SkipBadRows
+	return w
+}
+
+// Convert a page of rows and keep them.
+func (w *sheetsWriter) page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+	if w.names == nil {
+		for _, col := range resultColumns(fields, w.conf.Flatten) {
+			w.names = append(w.names, col.name)
+		}
+		sort.Strings(w.names)
+		if w.conf.PrintFields {
+			var header = make([]interface{}, len(w.names))
+			for i, name := range w.names {
+				header[i] = name
+			}
+			w.values = append(w.values, header)
+		}
+	}
+
+	result, err := toRows(fields, rows, w.conf.TypeMapping, w.conv, w.conf.Flatten, &w.rowTracker)
+	if err != nil {
+		return err
+	}
+	for _, row := range result {
+		var values = make([]interface{}, len(w.names))
+		for i, name := range w.names {
+			values[i] = scalarValue(row[name])
+			if values[i] == nil {
+				values[i] = ""
+			}
+		}
+		w.values = append(w.values, values)
+		w.total++
+	}
+	if w.conf.ReuseRows {
+		releaseRows(result)
+	}
+	return nil
+}
+
+// Write the rows to the tab.
+func (w *sheetsWriter) close() error {
+	if w.names == nil {
+		return nil
+	}
+	if err := w.prepareTab(); err != nil {
+		return err
+	}
+
+	var rng = url.PathEscape(sheetsRange(w.tab))
+	for start := 0; start < len(w.values); start += sheetsBatchRows {
+		var end = start + sheetsBatchRows
+		if end > len(w.values) {
+			end = len(w.values)
+		}
+		var body = sheetsValues{Values: w.values[start:end]}
+		if err := w.c.sheetsCall(w.id+"/values/"+rng+":append?valueInputOption=RAW&insertDataOption=INSERT_ROWS", body); err != nil {
+			return err
+		}
+	}
+	w.values = nil
+	return nil
+}
+
+// Create the tab, or empty it if it exists.
+func (w *sheetsWriter) prepareTab() error {
+	var sheet sheetsSpreadsheet
+	if err := w.c.sheetsGet(w.id+"?fields=sheets.properties.title", &sheet); err != nil {
+		return err
+	}
+	for _, s := range sheet.Sheets {
+		if s.Properties.Title == w.tab {
+			return w.c.sheetsCall(w.id+"/values/"+url.PathEscape(sheetsRange(w.tab))+":clear", struct{}{})
+		}
+	}
+
+	var add = map[string]interface{}{
+		"requests": []interface{}{
+			map[string]interface{}{"addSheet": map[string]interface{}{
+				"properties": map[string]string{"title": w.tab},
+			}},
+		},
+	}
+	return w.c.sheetsCall(w.id+":batchUpdate", add)
+}
+
+// Number of rows written.
+func (w *sheetsWriter) count() uint64 {
+	return w.total
+}
+
+// Give up on the output. Nothing has been written yet.
+func (w *sheetsWriter) abort() {
+	w.values = nil
+}
+
+// A1 notation of a whole tab.
+func sheetsRange(tab string) string {
+	return "'" + strings.Replace(tab, "'", "''", -1) + "'"
+}
+
+// Get a resource of the Sheets API into result.
+func (c *Client) sheetsGet(path string, result interface{}) error {
+	res, err := c.client.Get(sheetsURL + path)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return newUploadError(res)
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// Post body to the Sheets API.
+func (c *Client) sheetsCall(path string, body interface{}) error {
+	by, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	res, err := c.client.Post(sheetsURL+path, "application/json", bytes.NewReader(by))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return newUploadError(res)
+	}
+	res.Body.Close()
+	return nil
+}
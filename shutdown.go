@@ -0,0 +1,111 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Returned by operations started after the client was shut down.
+var ErrClientClosed = errors.New("Client is shut down")
+
+// Context key marking a context as that of an operation of a client.
+type operationKey struct{}
+
+// Operations of a client in flight, see Shutdown.
+type lifecycle struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+
+	// Whether the client stopped using its transport.
+	released bool
+
+	// Closed when Shutdown stops waiting, cancelling operations in flight.
+	stop chan struct{}
+}
+
+// Stop taking new operations and wait for those in flight (uploads, job
+// polls, dumps being written) to finish. If ctx is done first, they are
+// cancelled, along with their BigQuery jobs if CancelJobs is set, and
+// ctx's error is returned once they stopped.
+// The client stops using its transport at the end, whose idle connections
+// are closed unless other clients share it.
+// Calling it again waits the same way.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.life.mu.Lock()
+	c.life.closed = true
+	if c.life.stop == nil {
+		c.life.stop = make(chan struct{})
+	}
+	var stop = c.life.stop
+	c.life.mu.Unlock()
+
+	var done = make(chan struct{})
+	go func() {
+		c.life.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		c.life.mu.Lock()
+		select {
+		case <-stop:
+		default:
+			close(stop)
+		}
+		c.life.mu.Unlock()
+		<-done
+		err = ctx.Err()
+	}
+	c.life.mu.Lock()
+	var release = c.transport != nil && !c.life.released
+	c.life.released = true
+	c.life.mu.Unlock()
+	if release {
+		releaseTransport(c.transport)
+	}
+	return err
+}
+
+// Shut the client down, waiting for everything in flight to finish.
+func (c *Client) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// Register an operation so Shutdown waits for it. The returned context is
+// cancelled if Shutdown stops waiting, and the func ends the operation.
+// Operations started within another one, i.e. with its context, are taken
+// even after Shutdown was called, so the outer one can finish.
+func (c *Client) begin(ctx context.Context) (context.Context, func(), error) {
+	c.life.mu.Lock()
+	if c.life.closed && ctx.Value(operationKey{}) != c {
+		c.life.mu.Unlock()
+		return nil, nil, ErrClientClosed
+	}
+	if c.life.stop == nil {
+		c.life.stop = make(chan struct{})
+	}
+	var stop = c.life.stop
+	c.life.wg.Add(1)
+	c.life.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.WithValue(ctx, operationKey{}, c))
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			cancel()
+			c.life.wg.Done()
+		})
+	}, nil
+}
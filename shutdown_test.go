@@ -0,0 +1,110 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/api/bigquery/v2"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownSharedTransport(t *testing.T) {
+	var tc = TransportConfig{Proxy: "http://proxy.example.com:3128", MaxConnsPerHost: 7}
+	var clients = make([]*Client, 2)
+	for i := range clients {
+		transport, err := sharedTransport(tc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients[i] = &Client{transport: transport}
+	}
+	if clients[0].transport != clients[1].transport {
+		t.Fatal("clients with the same settings don't share the transport")
+	}
+
+	// Shutting down twice releases it once, and the other client keeps it.
+	for i := 0; i < 2; i++ {
+		if err := clients[0].Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	transport, err := sharedTransport(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport != clients[1].transport {
+		t.Error("transport released while a client still uses it")
+	}
+	releaseTransport(transport)
+
+	// Once nobody uses it, new clients get a new one.
+	if err = clients[1].Close(); err != nil {
+		t.Fatal(err)
+	}
+	if transport, err = sharedTransport(tc); err != nil {
+		t.Fatal(err)
+	}
+	defer releaseTransport(transport)
+	if transport == clients[1].transport {
+		t.Error("released transport still shared")
+	}
+}
+
+func TestShutdownWaitsForTableDump(t *testing.T) {
+	var reading, release = make(chan struct{}), make(chan struct{})
+	var c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/data") {
+			close(reading)
+			<-release
+			writeJSON(w, &bigquery.TableDataList{Rows: testRows(0, 1)})
+			return
+		}
+		writeJSON(w, &bigquery.Table{Schema: &bigquery.TableSchema{Fields: testSchema()}})
+	}))
+	var dir = t.TempDir()
+	var conf = DumpConfig{Format: "csv", Output: filepath.Join(dir, "out.csv")}
+	var dumped = make(chan error)
+	go func() {
+		dumped <- c.DumpTable("", "ds", "t", conf)
+	}()
+	<-reading
+
+	var closed = make(chan error)
+	go func() {
+		closed <- c.Close()
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Shutdown didn't wait for the dump")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if err := <-dumped; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.DumpDataset("", "ds", DumpConfig{Format: "csv", Output: filepath.Join(dir, "{{table}}.csv")}, DatasetDumpConfig{}); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("got %v after Shutdown, want ErrClientClosed", err)
+	}
+}
+
+func TestDumpTableContextCancelled(t *testing.T) {
+	var c = newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	var ctx, cancel = context.WithCancel(context.Background())
+	var dumped = make(chan error)
+	go func() {
+		dumped <- c.DumpTableContext(ctx, "", "ds", "t", DumpConfig{Format: "csv", Output: filepath.Join(t.TempDir(), "out.csv")})
+	}()
+	cancel()
+	if err := <-dumped; err == nil {
+		t.Error("cancelled dump succeeded")
+	}
+}
@@ -0,0 +1,97 @@
+package bqwrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"time"
+)
+
+// Suffix of the metadata file written next to dump output with
+// DumpConfig.Metadata.
+const metadataSuffix = ".meta.json"
+
+// Keeps the schema of the rows written, for the metadata file.
+type metadataWriter struct {
+	outputWriter
+	fields []*bigquery.TableFieldSchema
+}
+
+func (w *metadataWriter) page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+	w.fields = fields
+	return w.outputWriter.page(fields, rows)
+}
+
+// Check the dump's output can have a metadata file and a manifest.
+func checkMetadata(conf DumpConfig) error {
+	if conf.Metadata && (conf.Format == "sql" || conf.Format == "sheets" || conf.Output == "-") {
+		return errors.New("Metadata needs file output")
+	}
+	if conf.Manifest && (conf.Format != "json" && conf.Format != "csv" || conf.Output == "-") {
+		return errors.New("Manifest needs json or csv file output")
+	}
+	return checkResume(conf)
+}
+
+// Finish the output, setting number of rows in done, then write its metadata
+// file if conf.Metadata is set. The query job, if any, ran in location.
+func (c *Client) closeOutput(w outputWriter, conf DumpConfig, location string, done *Completion) error {
+	var err = w.close()
+	done.Rows, done.Skipped = w.count(), w.skippedRows()
+	if err != nil {
+		return err
+	}
+	for ; w != nil; w = wrappedOutput(w) {
+		if mw, ok := w.(*metadataWriter); ok {
+			return c.writeMetadata(conf, location, mw.fields, done)
+		}
+	}
+	return nil
+}
+
+// Write output.meta.json describing a finished dump. Bytes processed are
+// read from the query job's statistics, if the dump ran one.
+func (c *Client) writeMetadata(conf DumpConfig, location string, fields []*bigquery.TableFieldSchema, done *Completion) error {
+	var meta = dumpMetadata{
+		Output:   conf.Output,
+		Format:   conf.Format,
+		Query:    conf.Query,
+		Table:    conf.Table,
+		JobID:    done.JobID,
+		Schema:   fields,
+		Rows:     done.Rows,
+		Skipped:  done.Skipped,
+		Started:  done.Started,
+		Finished: time.Now(),
+	}
+	if done.JobID != "" {
+		job, err := c.bq.Jobs.Get(c.ProjectID, done.JobID).Location(location).Do()
+		if err != nil {
+			return fmt.Errorf("Error getting job - %s", err)
+		}
+		if job.Statistics != nil {
+			meta.BytesProcessed = job.Statistics.TotalBytesProcessed
+			if job.Statistics.Query != nil {
+				meta.CacheHit = job.Statistics.Query.CacheHit
+			}
+		}
+	}
+
+	by, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	out, err := c.createOutput(conf.Output+metadataSuffix, conf)
+	if err != nil {
+		return fmt.Errorf("Error creating metadata file - %s", err)
+	}
+	if _, err = out.Write(append(by, '\n')); err != nil {
+		out.Abort()
+		return fmt.Errorf("Error writing metadata file - %s", err)
+	}
+	if err = out.Commit(); err != nil {
+		return fmt.Errorf("Error writing metadata file - %s", err)
+	}
+	return nil
+}
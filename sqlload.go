@@ -0,0 +1,167 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Run the query on a database and load its rows to BigQuery.
+// driver is the database/sql driver name (e.g. "postgres" or "mysql"),
+// which has to be imported by the caller, and dsn its data source name.
+//
+// Rows are converted to newline delimited json as they are read, into a
+// temporary file which is then loaded as conf.SourceFile. If conf.SchemaFile
+// isn't set, the schema is made from the column types of the query.
+func (c *Client) LoadFromSQL(driver, dsn, query string, conf LoadConfig) error {
+	// Required params check.
+	if driver == "" || dsn == "" || query == "" || conf.DatasetID == "" || conf.TableID == "" {
+		return errors.New("missing params")
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return fmt.Errorf("Error opening database - %s", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return fmt.Errorf("Error running query - %s", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return fmt.Errorf("Error reading columns - %s", err)
+	}
+	var fields = make([]TableField, len(cols))
+	for i, col := range cols {
+		fields[i] = TableField{Name: col.Name(), Type: columnType(col.DatabaseTypeName()), Mode: "NULLABLE"}
+	}
+
+	dir, err := ioutil.TempDir("", "bqwrapper")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Write the schema unless there's one already.
+	if conf.SchemaFile == "" {
+		by, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		conf.SchemaFile = filepath.Join(dir, "schema.json")
+		if err = ioutil.WriteFile(conf.SchemaFile, by, 0600); err != nil {
+			return fmt.Errorf("Error writing schema - %s", err)
+		}
+	}
+
+	// Convert rows.
+	conf.SourceFile = filepath.Join(dir, "rows.json")
+	f, err := os.Create(conf.SourceFile)
+	if err != nil {
+		return err
+	}
+	var w = bufio.NewWriter(f)
+	var enc = json.NewEncoder(w)
+	var values = make([]interface{}, len(cols))
+	var ptrs = make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	var row = make(map[string]interface{}, len(cols))
+	for rows.Next() {
+		if err = rows.Scan(ptrs...); err != nil {
+			f.Close()
+			return fmt.Errorf("Error reading row - %s", err)
+		}
+		for i, field := range fields {
+			row[field.Name] = sqlValue(values[i], field.Type)
+		}
+		if err = enc.Encode(row); err != nil {
+			f.Close()
+			return fmt.Errorf("Error writing row - %s", err)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		f.Close()
+		return fmt.Errorf("Error reading rows - %s", err)
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return c.Load(conf)
+}
+
+// BigQuery type of a database column type.
+func columnType(name string) string {
+	name = strings.TrimPrefix(strings.ToUpper(name), "UNSIGNED ")
+	switch name {
+	case "INT", "INT2", "INT4", "INT8", "INTEGER", "SMALLINT", "MEDIUMINT", "BIGINT", "TINYINT", "YEAR":
+		return "INTEGER"
+	case "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "REAL", "DOUBLE PRECISION":
+		return "FLOAT"
+	case "NUMERIC", "DECIMAL":
+		return "NUMERIC"
+	case "BOOL", "BOOLEAN":
+		return "BOOLEAN"
+	case "DATE":
+		return "DATE"
+	case "TIME":
+		return "TIME"
+	case "DATETIME":
+		return "DATETIME"
+	case "TIMESTAMP", "TIMESTAMPTZ":
+		return "TIMESTAMP"
+	case "BYTEA", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BINARY", "VARBINARY":
+		return "BYTES"
+	case "JSON", "JSONB":
+		return "JSON"
+	}
+	return "STRING"
+}
+
+// Json value of a value read from a database, for a field of the given type.
+func sqlValue(v interface{}, ftype string) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		switch {
+		case ftype == "BYTES":
+			return base64.StdEncoding.EncodeToString(v)
+		case ftype == "JSON" && json.Valid(v):
+			// Objects are passed through as they are.
+			return json.RawMessage(v)
+		}
+		return string(v)
+	case string:
+		if ftype == "JSON" && json.Valid([]byte(v)) {
+			return json.RawMessage(v)
+		}
+	case time.Time:
+		switch ftype {
+		case "DATE":
+			return v.Format("2006-01-02")
+		case "TIME":
+			return v.Format("15:04:05.999999")
+		case "DATETIME":
+			return v.Format("2006-01-02 15:04:05.999999")
+		}
+		return v.Format("2006-01-02 15:04:05.999999Z07:00")
+	}
+	return v
+}
@@ -0,0 +1,407 @@
+package bqwrapper
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// database/sql driver used for sqlite output (github.com/mattn/go-sqlite3),
+// which has to be imported by the caller.
+const sqliteDriver = "sqlite3"
+
+// Default name of the table sql output is written to.
+const defaultSQLTable = "results"
+
+// Default number of rows inserted by a single INSERT statement.
+const defaultSQLBatchSize = 500
+
+// Writes dump output into a table of a database.
+// All rows are written in a single transaction, so the table is never left
+// half written. For postgres (github.com/lib/pq) rows are sent with COPY,
+// otherwise with INSERTs of SQLBatchSize rows.
+type sqlWriter struct {
+	rowTracker
+	conf   DumpConfig
+	conv   converters
+	driver string
+	dsn    string
+	table  string
+
+	db   *sql.DB
+	tx   *sql.Tx
+	copy *sql.Stmt
+
+	// Columns, sorted the same way as csv output, and whether each of them
+	// holds raw bytes.
+	names []string
+	bytes []bool
+
+	// Rows waiting to be inserted, flattened, and the statement inserting a
+	// full batch of them.
+	batch     []interface{}
+	batchSize int
+	insert    *sql.Stmt
+
+	// Rows written.
+	total uint64
+}
+
+func newSQLWriter(conf DumpConfig) *sqlWriter {
+	var w = &sqlWriter{conf: conf, conv: dumpConverters(conf), driver: conf.SQLDriver, dsn: conf.Output, table: conf.SQLTable}
+	if conf.Format == "sqlite" {
+		w.driver = sqliteDriver
+	}
+	if w.table == "" {
+		w.table = defaultSQLTable
+	}
+	w.skip = conf.SkipBadRows
+	return w
+}
+
+// Convert a page of rows and insert them.
+func (w *sqlWriter) page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+	if w.tx == nil {
+		if err := w.open(fields); err != nil {
+			return err
+		}
+	}
+
+	result, err := toRows(fields, rows, w.conf.TypeMapping, w.conv, w.conf.Flatten, &w.rowTracker)
+	if err != nil {
+		return err
+	}
+
+	var args = make([]interface{}, len(w.names))
+	for _, row := range result {
+		for i, name := range w.names {
+			args[i] = scalarValue(row[name])
+			if s, ok := args[i].(string); ok && w.bytes[i] {
+				args[i] = []byte(s)
+			}
+		}
+
+		w.total++
+		if w.copy != nil {
+			if _, err = w.copy.Exec(args...); err != nil {
+				return fmt.Errorf("Error copying row - %s", err)
+			}
+			continue
+		}
+		w.batch = append(w.batch, args...)
+		if len(w.batch) == w.batchSize*len(w.names) {
+			if err = w.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if w.conf.ReuseRows {
+		releaseRows(result)
+	}
+	return nil
+}
+
+// Insert rows waiting in the batch.
+func (w *sqlWriter) flush() error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+
+	var err error
+	var rows = len(w.batch) / len(w.names)
+	if rows == w.batchSize {
+		if w.insert == nil {
+			if w.insert, err = w.tx.Prepare(w.insertQuery(rows)); err != nil {
+				return fmt.Errorf("Error preparing insert - %s", err)
+			}
+		}
+		_, err = w.insert.Exec(w.batch...)
+	} else {
+		_, err = w.tx.Exec(w.insertQuery(rows), w.batch...)
+	}
+	if err != nil {
+		return fmt.Errorf("Error inserting rows - %s", err)
+	}
+	w.batch = w.batch[:0]
+	return nil
+}
+
+// INSERT statement for the given number of rows.
+func (w *sqlWriter) insertQuery(rows int) string {
+	var cols = make([]string, len(w.names))
+	for i, name := range w.names {
+		cols[i] = w.quote(name)
+	}
+
+	var q = make([]byte, 0, 64+rows*len(w.names)*4)
+	q = append(q, "INSERT INTO "+w.quote(w.table)+" ("+strings.Join(cols, ", ")+") VALUES "...)
+	var n int
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			q = append(q, ", "...)
+		}
+		q = append(q, '(')
+		for j := range w.names {
+			if j > 0 {
+				q = append(q, ", "...)
+			}
+			n++
+			if w.driver == "postgres" || w.driver == "pgx" {
+				q = append(q, '$')
+				q = strconv.AppendInt(q, int64(n), 10)
+			} else {
+				q = append(q, '?')
+			}
+		}
+		q = append(q, ')')
+	}
+	return string(q)
+}
+
+// Open the database and create the table.
+// The sqlite table is created again each time, while tables of other
+// databases are created only if they don't exist, and emptied if SQLTruncate
+// is set.
+func (w *sqlWriter) open(fields []*bigquery.TableFieldSchema) error {
+	if w.driver == "" {
+		return errors.New("missing SQLDriver")
+	}
+	if w.driver == sqliteDriver {
+		if err := os.MkdirAll(filepath.Dir(w.dsn), 0777); err != nil {
+			return fmt.Errorf("Error creating output directory - %s", err)
+		}
+	}
+
+	var err error
+	if w.db, err = sql.Open(w.driver, w.dsn); err != nil {
+		return fmt.Errorf("Error opening database - %s", err)
+	}
+	if w.tx, err = w.db.Begin(); err != nil {
+		return fmt.Errorf("Error starting transaction - %s", err)
+	}
+
+	// Column names and types.
+	// RECORD and REPEATED values are written as json text, and those of
+	// converters of the dump as text.
+	var columns = resultColumns(fields, w.conf.Flatten)
+	var types = make(map[string]string, len(columns))
+	var ftype string
+	for _, col := range columns {
+		w.names = append(w.names, col.name)
+		ftype = col.ftype
+		if isRecord(ftype) || col.field.Mode == "REPEATED" || w.conv.lookup(col.name, ftype) != nil {
+			ftype = "STRING"
+		}
+		types[col.name] = sqlType(w.driver, ftype, w.conf.TypeMapping)
+	}
+	sort.Strings(w.names)
+
+	var cols = make([]string, len(w.names))
+	w.bytes = make([]bool, len(w.names))
+	for i, name := range w.names {
+		cols[i] = w.quote(name) + " " + types[name]
+		switch types[name] {
+		case "BLOB", "BYTEA", "LONGBLOB":
+			w.bytes[i] = true
+		}
+	}
+
+	var table = w.quote(w.table)
+	var create = "CREATE TABLE IF NOT EXISTS "
+	if w.driver == sqliteDriver {
+		if _, err = w.tx.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+			return fmt.Errorf("Error dropping table - %s", err)
+		}
+		create = "CREATE TABLE "
+	}
+	if _, err = w.tx.Exec(create + table + " (" + strings.Join(cols, ", ") + ")"); err != nil {
+		return fmt.Errorf("Error creating table - %s", err)
+	}
+	if w.conf.SQLTruncate && w.driver != sqliteDriver {
+		if _, err = w.tx.Exec("DELETE FROM " + table); err != nil {
+			return fmt.Errorf("Error emptying table - %s", err)
+		}
+	}
+
+	// lib/pq takes COPY FROM STDIN as a statement executed once per row.
+	if w.driver == "postgres" {
+		for i, name := range w.names {
+			cols[i] = w.quote(name)
+		}
+		if w.copy, err = w.tx.Prepare("COPY " + table + " (" + strings.Join(cols, ", ") + ") FROM STDIN"); err != nil {
+			return fmt.Errorf("Error starting copy - %s", err)
+		}
+		return nil
+	}
+
+	// Keep the number of placeholders in a statement within limits of
+	// the database.
+	var limit = 65535
+	if w.driver == sqliteDriver {
+		limit = 999
+	}
+	w.batchSize = w.conf.SQLBatchSize
+	if w.batchSize <= 0 {
+		w.batchSize = defaultSQLBatchSize
+	}
+	if len(w.names) > 0 && w.batchSize*len(w.names) > limit {
+		w.batchSize = limit / len(w.names)
+	}
+	if w.batchSize == 0 {
+		w.batchSize = 1
+	}
+	return nil
+}
+
+// Insert the rest of rows and commit them.
+func (w *sqlWriter) close() error {
+	if w.tx == nil {
+		return nil
+	}
+
+	var err error
+	if w.copy != nil {
+		if _, err = w.copy.Exec(); err == nil {
+			err = w.copy.Close()
+		}
+	} else {
+		err = w.flush()
+		if w.insert != nil {
+			w.insert.Close()
+		}
+	}
+	if err != nil {
+		w.abort()
+		return err
+	}
+
+	err = w.tx.Commit()
+	w.db.Close()
+	if err != nil {
+		return fmt.Errorf("Error committing rows - %s", err)
+	}
+	return nil
+}
+
+// Number of rows written.
+func (w *sqlWriter) count() uint64 {
+	return w.total
+}
+
+// Give up on the output, rolling back whatever was written.
+func (w *sqlWriter) abort() {
+	if w.tx == nil {
+		return
+	}
+	if w.copy != nil {
+		w.copy.Close()
+	}
+	if w.insert != nil {
+		w.insert.Close()
+	}
+	w.tx.Rollback()
+	w.db.Close()
+}
+
+// Quote an identifier for the database.
+func (w *sqlWriter) quote(name string) string {
+	if w.driver == "mysql" {
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// Column type of a BigQuery field type in the database, depending on how
+// the values are converted.
+func sqlType(driver, ftype string, mapping map[string]string) string {
+	switch driver {
+	case "postgres", "pgx":
+		switch ftype {
+		case "INTEGER":
+			return "BIGINT"
+		case "BOOLEAN", "DATE", "TIME":
+			return ftype
+		case "FLOAT":
+			return "DOUBLE PRECISION"
+		case "DATETIME":
+			return "TIMESTAMP"
+		case "TIMESTAMP":
+			if mapping["TIMESTAMP"] == MapRFC3339 {
+				return "TIMESTAMPTZ"
+			}
+			return "BIGINT"
+		case "NUMERIC", "BIGNUMERIC":
+			if mapping[ftype] == MapFloat {
+				return "DOUBLE PRECISION"
+			}
+			return "NUMERIC"
+		case "BYTES":
+			if mapping["BYTES"] == MapRaw {
+				return "BYTEA"
+			}
+		case "JSON":
+			return "JSONB"
+		case "INTERVAL":
+			// Either representation is valid input.
+			return "INTERVAL"
+		}
+		return "TEXT"
+	case "mysql":
+		switch ftype {
+		case "INTEGER":
+			return "BIGINT"
+		case "BOOLEAN", "DATE", "TIME":
+			return ftype
+		case "FLOAT":
+			return "DOUBLE"
+		case "DATETIME":
+			return "DATETIME(6)"
+		case "TIMESTAMP":
+			if mapping["TIMESTAMP"] != MapRFC3339 {
+				return "BIGINT"
+			}
+		case "NUMERIC":
+			if mapping[ftype] == MapFloat {
+				return "DOUBLE"
+			}
+			return "DECIMAL(38,9)"
+		case "BIGNUMERIC":
+			if mapping[ftype] == MapFloat {
+				return "DOUBLE"
+			}
+		case "BYTES":
+			if mapping["BYTES"] == MapRaw {
+				return "LONGBLOB"
+			}
+		case "JSON":
+			return "JSON"
+		}
+		return "LONGTEXT"
+	}
+
+	switch ftype {
+	case "INTEGER", "BOOLEAN":
+		return "INTEGER"
+	case "FLOAT":
+		return "REAL"
+	case "TIMESTAMP":
+		if mapping["TIMESTAMP"] != MapRFC3339 {
+			return "INTEGER"
+		}
+	case "NUMERIC", "BIGNUMERIC":
+		if mapping[ftype] == MapFloat {
+			return "REAL"
+		}
+	case "BYTES":
+		if mapping["BYTES"] == MapRaw {
+			return "BLOB"
+		}
+	}
+	return "TEXT"
+}
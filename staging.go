@@ -0,0 +1,264 @@
+package bqwrapper
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuth scope for uploading to GCS staging buckets.
+const storageScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// Size of chunks of resumable uploads. It has to be a multiple of 256KiB.
+const uploadChunkSize = 16 << 20
+
+// Number of times a chunk is retried before giving up.
+const uploadRetries = 5
+
+// Upload the data to the staging bucket and load it from there.
+// Checksums GCS computed are compared with ours before loading.
+func (c *Client) stagedLoad(ctx context.Context, conf LoadConfig, load jobLoadConf, source string, body io.Reader, size int64) (*bigquery.Job, error) {
+	var name = conf.StagingPrefix + conf.TableID + "-" +
+		strconv.FormatInt(time.Now().UnixNano(), 10) + path.Ext(source)
+
+	var sum = newChecksumWriter()
+	obj, err := c.uploadGCS(ctx, conf.StagingBucket, name, io.TeeReader(body, sum), size)
+	if err != nil {
+		return nil, fmt.Errorf("Error uploading to staging bucket - %s", err)
+	}
+	if !conf.KeepStaged {
+		defer c.deleteGCS(conf.StagingBucket, name)
+	}
+
+	var checksum = sum.checksum()
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], checksum.crc32c)
+	if obj.CRC32C != base64.StdEncoding.EncodeToString(crc[:]) || obj.MD5Hash != checksum.md5 {
+		return nil, &IntegrityError{
+			Source:        source,
+			Reason:        "staged object checksum mismatch",
+			SentBytes:     checksum.size,
+			ReceivedBytes: obj.Size,
+			CRC32C:        checksum.crc32c,
+			MD5:           checksum.md5,
+		}
+	}
+
+	// Same configuration as the direct upload, reading from the object.
+	by, err := json.Marshal(load)
+	if err != nil {
+		return nil, err
+	}
+	var jobConf = &bigquery.JobConfiguration{Load: &bigquery.JobConfigurationLoad{}}
+	if err = json.Unmarshal(by, jobConf.Load); err != nil {
+		return nil, err
+	}
+	jobConf.Load.SourceUris = []string{"gs://" + conf.StagingBucket + "/" + name}
+
+	status, err := c.runJobIn(ctx, c.Location, jobConf)
+	if err != nil {
+		return nil, err
+	}
+	return status, verifyLoad(source, checksum.size, status)
+}
+
+// Upload size bytes read from body to the bucket with a resumable upload.
+func (c *Client) uploadGCS(ctx context.Context, bucket, name string, body io.Reader, size int64) (*gcsObject, error) {
+	req, err := http.NewRequest("POST",
+		"https://storage.googleapis.com/upload/storage/v1/b/"+url.PathEscape(bucket)+
+			"/o?uploadType=resumable&name="+url.QueryEscape(name), nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating initial request - %s", err)
+	}
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("Error in initial request - %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Did not get OK, got %s", res.Status)
+	}
+	loc, err := res.Location()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting Location header - %s", err)
+	}
+
+	by, err := c.resumeUpload(ctx, loc.String(), body, size)
+	if err != nil {
+		return nil, err
+	}
+	var obj gcsObject
+	if err = json.Unmarshal(by, &obj); err != nil {
+		return nil, fmt.Errorf("Error decoding response - %s", err)
+	}
+	return &obj, nil
+}
+
+// Send size bytes read from body to the upload session at loc (of GCS or
+// BigQuery) in chunks. A chunk that fails with a 5xx or 429 is resumed from
+// wherever the upload got to. Returns body of the final response.
+func (c *Client) resumeUpload(ctx context.Context, loc string, body io.Reader, size int64) ([]byte, error) {
+	var buf = make([]byte, uploadChunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(body, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("Error reading source - %s", err)
+		}
+		if n == 0 && offset < size {
+			return nil, errors.New("source ended before its size")
+		}
+
+		var chunk = buf[:n]
+		var retries int
+		for {
+			next, done, err := c.putChunk(ctx, loc, chunk, offset, size)
+			if err != nil {
+				var uerr *UploadError
+				if errors.As(err, &uerr) && uerr.StatusCode < 500 && uerr.StatusCode != http.StatusTooManyRequests {
+					return nil, err
+				}
+				if retries == uploadRetries || ctx.Err() != nil {
+					return nil, err
+				}
+				retries++
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(time.Duration(retries) * time.Second):
+				}
+
+				// Ask how much got through, or send the chunk again if we can't tell.
+				if next, done, err = c.putChunk(ctx, loc, nil, offset, size); err != nil {
+					continue
+				}
+			}
+			if done != nil {
+				return done, nil
+			}
+			if next < offset || next > offset+int64(len(chunk)) {
+				return nil, fmt.Errorf("Unexpected upload offset %d", next)
+			}
+			chunk = chunk[next-offset:]
+			offset = next
+			if len(chunk) == 0 {
+				break
+			}
+		}
+		if offset >= size {
+			return nil, errors.New("upload did not complete")
+		}
+	}
+}
+
+// Send a chunk starting at offset, or ask for the upload status if chunk is
+// empty and there's more to send.
+// Returns offset of the first byte the server doesn't have yet, or body of
+// the response once the upload is complete.
+func (c *Client) putChunk(ctx context.Context, loc string, chunk []byte, offset, size int64) (int64, []byte, error) {
+	req, err := http.NewRequest("PUT", loc, bytes.NewReader(chunk))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(chunk) == 0 {
+		if offset < size {
+			req.Header.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		} else {
+			req.Header.Set("Content-Range", "bytes */"+strconv.FormatInt(offset, 10))
+		}
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(len(chunk))-1, size))
+	}
+
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		by, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("Error reading response - %s", err)
+		}
+		return size, by, nil
+	case http.StatusPermanentRedirect:
+		// "Resume incomplete", Range tells what the server has so far (bytes=0-N).
+		var r = res.Header.Get("Range")
+		if r == "" {
+			return 0, nil, nil
+		}
+		end, err := strconv.ParseInt(r[strings.LastIndex(r, "-")+1:], 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("Invalid Range header %s", r)
+		}
+		return end + 1, nil, nil
+	}
+
+	return 0, nil, newUploadError(res)
+}
+
+// List names of objects starting with prefix.
+func (c *Client) listGCS(bucket, prefix string) ([]string, error) {
+	var names []string
+	var token string
+	for {
+		var q = url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+		if token != "" {
+			q.Set("pageToken", token)
+		}
+		res, err := c.client.Get("https://storage.googleapis.com/storage/v1/b/" + url.PathEscape(bucket) + "/o?" + q.Encode())
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("Did not get OK, got %s", res.Status)
+		}
+		var list gcsList
+		err = json.NewDecoder(res.Body).Decode(&list)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding response - %s", err)
+		}
+		for _, obj := range list.Items {
+			names = append(names, obj.Name)
+		}
+		if token = list.NextPageToken; token == "" {
+			return names, nil
+		}
+	}
+}
+
+// Delete an object.
+func (c *Client) deleteGCS(bucket, name string) error {
+	req, err := http.NewRequest("DELETE",
+		"https://storage.googleapis.com/storage/v1/b/"+url.PathEscape(bucket)+"/o/"+url.PathEscape(name), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Did not get OK, got %s", res.Status)
+	}
+	return nil
+}
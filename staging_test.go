@@ -0,0 +1,55 @@
+package bqwrapper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Upload session taking chunks in order, as GCS and BigQuery do.
+func uploadHandler(t testing.TB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var n, err = io.Copy(ioutil.Discard, r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		// Content-Range is "bytes first-last/size", or "bytes */size".
+		var cr = strings.TrimPrefix(r.Header.Get("Content-Range"), "bytes ")
+		var slash = strings.Index(cr, "/")
+		size, _ := strconv.ParseInt(cr[slash+1:], 10, 64)
+		var last int64 = -1
+		if n > 0 {
+			last, _ = strconv.ParseInt(cr[strings.Index(cr, "-")+1:slash], 10, 64)
+		}
+		if last+1 == size {
+			writeJSON(w, map[string]string{"name": "done"})
+			return
+		}
+		if last >= 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", last))
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+	}
+}
+
+func BenchmarkResumeUpload(b *testing.B) {
+	var c = newTestClient(b, uploadHandler(b))
+	var data = bytes.Repeat([]byte("0123456789abcdef"), 4*uploadChunkSize/16)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		by, err := c.resumeUpload(context.Background(), "https://storage.googleapis.com/upload/session", bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !bytes.Contains(by, []byte("done")) {
+			b.Fatalf("unexpected response %s", by)
+		}
+	}
+}
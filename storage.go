@@ -0,0 +1,400 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Sources and sinks by URL scheme.
+var storage = struct {
+	sync.RWMutex
+	sources map[string]Source
+	sinks   map[string]Sink
+}{
+	sources: map[string]Source{
+		"file":  fileSource{},
+		"stdin": stdinSource{},
+		"http":  httpSource{},
+		"https": httpSource{},
+		"gs":    gcsSource{},
+		"s3":    s3Source{},
+	},
+	sinks: map[string]Sink{
+		"file":   fileSink{},
+		"stdout": stdoutSink{},
+		"gs":     gcsSink{},
+	},
+}
+
+// Register a source for locations with the URL scheme, replacing the one
+// already registered if any.
+func RegisterSource(scheme string, s Source) {
+	storage.Lock()
+	storage.sources[strings.ToLower(scheme)] = s
+	storage.Unlock()
+}
+
+// Register a sink for locations with the URL scheme, replacing the one
+// already registered if any.
+func RegisterSink(scheme string, s Sink) {
+	storage.Lock()
+	storage.sinks[strings.ToLower(scheme)] = s
+	storage.Unlock()
+}
+
+// Parse a location, which is either a URL (scheme://...) or a local file path.
+// "-" is std, i.e. stdin for sources and stdout for sinks.
+func parseLocation(name, std string) (*url.URL, error) {
+	if name == "-" {
+		return &url.URL{Scheme: std}, nil
+	}
+	if !strings.Contains(name, "://") {
+		return &url.URL{Scheme: "file", Path: name}, nil
+	}
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid location %s - %s", name, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	return u, nil
+}
+
+// Open data to load from the location.
+// If the source can't tell the size, the data is spooled to a temporary file
+// first, since the upload needs to know it.
+func (c *Client) openSource(name string) (io.ReadCloser, int64, error) {
+	u, err := parseLocation(name, "stdin")
+	if err != nil {
+		return nil, 0, err
+	}
+	storage.RLock()
+	var src, ok = storage.sources[u.Scheme]
+	storage.RUnlock()
+	if !ok {
+		return nil, 0, fmt.Errorf("Unsupported source %s", name)
+	}
+
+	r, size, err := src.Open(c, u)
+	if err != nil || size >= 0 {
+		return r, size, err
+	}
+	defer r.Close()
+
+	f, err := ioutil.TempFile("", "bqwrapper")
+	if err != nil {
+		return nil, 0, err
+	}
+	if size, err = io.Copy(f, r); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, 0, fmt.Errorf("Error reading source - %s", err)
+	}
+	return &tempFile{f}, size, nil
+}
+
+// Create dump output at the location.
+func (c *Client) createOutput(name string, conf DumpConfig) (SinkWriter, error) {
+	u, sink, err := findSink(name)
+	if err != nil {
+		return nil, err
+	}
+	return sink.Create(c, u, conf)
+}
+
+// Remove dump output created earlier.
+func (c *Client) removeOutput(name string) error {
+	u, sink, err := findSink(name)
+	if err != nil {
+		return err
+	}
+	return sink.Remove(c, u)
+}
+
+// Sink for the location.
+func findSink(name string) (*url.URL, Sink, error) {
+	u, err := parseLocation(name, "stdout")
+	if err != nil {
+		return nil, nil, err
+	}
+	storage.RLock()
+	var sink, ok = storage.sinks[u.Scheme]
+	storage.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("Unsupported output %s", name)
+	}
+	return u, sink, nil
+}
+
+// Temporary file removed when it's closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	var err = f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// Local files.
+type fileSource struct{}
+
+func (fileSource) Open(c *Client, u *url.URL) (io.ReadCloser, int64, error) {
+	f, err := os.Open(u.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// Stdin, which can be read only once.
+type stdinSource struct{}
+
+func (stdinSource) Open(c *Client, u *url.URL) (io.ReadCloser, int64, error) {
+	return ioutil.NopCloser(os.Stdin), -1, nil
+}
+
+// Files over http(s). Requests are sent without the client's credentials,
+// through its transport so they take its proxy.
+type httpSource struct{}
+
+func (httpSource) Open(c *Client, u *url.URL) (io.ReadCloser, int64, error) {
+	var client = http.DefaultClient
+	if c.transport != nil {
+		client = &http.Client{Transport: c.transport}
+	}
+	res, err := client.Get(u.String())
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, 0, fmt.Errorf("Did not get OK, got %s", res.Status)
+	}
+	return res.Body, res.ContentLength, nil
+}
+
+// GCS objects (gs://bucket/object).
+type gcsSource struct{}
+
+func (gcsSource) Open(c *Client, u *url.URL) (io.ReadCloser, int64, error) {
+	res, err := c.client.Get("https://storage.googleapis.com/storage/v1/b/" + url.PathEscape(u.Host) +
+		"/o/" + url.PathEscape(strings.TrimPrefix(u.Path, "/")) + "?alt=media")
+	if err != nil {
+		return nil, 0, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, 0, fmt.Errorf("Did not get OK, got %s", res.Status)
+	}
+	return res.Body, res.ContentLength, nil
+}
+
+// S3 objects (s3://bucket/key), with credentials from environment variables.
+type s3Source struct{}
+
+func (s3Source) Open(c *Client, u *url.URL) (io.ReadCloser, int64, error) {
+	return openS3(S3Source{Bucket: u.Host, Key: strings.TrimPrefix(u.Path, "/"), Region: os.Getenv("AWS_REGION")})
+}
+
+// Local files.
+// Unless NoAtomic is set, the file is written to name.tmp first and renamed
+// once it's complete.
+type fileSink struct{}
+
+type fileWriter struct {
+	f    *os.File
+	name string
+	tmp  string
+	conf DumpConfig
+}
+
+func (fileSink) Create(c *Client, u *url.URL, conf DumpConfig) (SinkWriter, error) {
+	var dirMode, fileMode = conf.DirMode, conf.FileMode
+	if dirMode == 0 {
+		dirMode = 0777
+	}
+	if fileMode == 0 {
+		fileMode = 0666
+	}
+	if err := os.MkdirAll(filepath.Dir(u.Path), dirMode); err != nil {
+		return nil, fmt.Errorf("Error creating output directory - %s", err)
+	}
+
+	var w = &fileWriter{name: u.Path, tmp: u.Path, conf: conf}
+	if !conf.NoAtomic {
+		w.tmp += ".tmp"
+	}
+	var err error
+	if w.f, err = os.OpenFile(w.tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fileMode); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Open a file written partly by an earlier dump again, cut to size bytes.
+func reopenFile(name string, size int64, conf DumpConfig) (*fileWriter, error) {
+	var w = &fileWriter{name: name, tmp: name, conf: conf}
+	if !conf.NoAtomic {
+		w.tmp += ".tmp"
+	}
+	var err error
+	if w.f, err = os.OpenFile(w.tmp, os.O_RDWR, 0); err != nil {
+		return nil, err
+	}
+	if err = w.f.Truncate(size); err == nil {
+		_, err = w.f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		w.f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (fileSink) Remove(c *Client, u *url.URL) error {
+	return os.Remove(u.Path)
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
+
+func (w *fileWriter) Commit() error {
+	var err error
+	if !w.conf.NoAtomic {
+		// Make sure it's on disk before it shows up under the final name.
+		err = w.f.Sync()
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && w.tmp != w.name {
+		err = os.Rename(w.tmp, w.name)
+	}
+	if err != nil && !w.conf.KeepPartial {
+		os.Remove(w.tmp)
+	}
+	return err
+}
+
+// The file is left under its temporary name if KeepPartial is set.
+func (w *fileWriter) Abort() error {
+	var err = w.f.Close()
+	if !w.conf.KeepPartial {
+		os.Remove(w.tmp)
+	}
+	return err
+}
+
+// Write data to the file through name.tmp, which is synced and renamed over
+// it, so a crash leaves either the old or the new data and never half of it.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(name+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(name+".tmp", name)
+	}
+	if err != nil {
+		os.Remove(name + ".tmp")
+	}
+	return err
+}
+
+// Stdout. Each output file is written one after another.
+type stdoutSink struct{}
+
+type stdoutWriter struct {
+	io.Writer
+}
+
+func (stdoutSink) Create(c *Client, u *url.URL, conf DumpConfig) (SinkWriter, error) {
+	return stdoutWriter{os.Stdout}, nil
+}
+
+func (stdoutSink) Remove(c *Client, u *url.URL) error {
+	return nil
+}
+
+func (stdoutWriter) Commit() error {
+	return nil
+}
+
+func (stdoutWriter) Abort() error {
+	return nil
+}
+
+// GCS objects (gs://bucket/object).
+// Output is kept in a temporary file and uploaded when it's complete.
+type gcsSink struct{}
+
+type gcsWriter struct {
+	c    *Client
+	u    *url.URL
+	f    *os.File
+	w    *bufio.Writer
+	size int64
+}
+
+func (gcsSink) Create(c *Client, u *url.URL, conf DumpConfig) (SinkWriter, error) {
+	f, err := ioutil.TempFile("", "bqwrapper")
+	if err != nil {
+		return nil, err
+	}
+	return &gcsWriter{c: c, u: u, f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (gcsSink) Remove(c *Client, u *url.URL) error {
+	return c.deleteGCS(u.Host, strings.TrimPrefix(u.Path, "/"))
+}
+
+func (w *gcsWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *gcsWriter) Commit() error {
+	defer w.Abort()
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.c.uploadGCS(context.Background(), w.u.Host, strings.TrimPrefix(w.u.Path, "/"), w.f, w.size); err != nil {
+		return fmt.Errorf("Error uploading output - %s", err)
+	}
+	return nil
+}
+
+func (w *gcsWriter) Abort() error {
+	var err = w.f.Close()
+	os.Remove(w.f.Name())
+	return err
+}
@@ -0,0 +1,59 @@
+package bqwrapper
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	var name = filepath.Join(t.TempDir(), "state.json")
+	for _, data := range []string{"first", "second"} {
+		if err := writeFileAtomic(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		by, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(by) != data {
+			t.Errorf("got %q, want %q", by, data)
+		}
+	}
+	if _, err := os.Stat(name + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left: %v", err)
+	}
+
+	// A failed write leaves the file as it was.
+	if err := writeFileAtomic(filepath.Join(name, "sub"), []byte("third"), 0600); err == nil {
+		t.Error("writing under a file succeeded")
+	}
+	if by, _ := ioutil.ReadFile(name); string(by) != "second" {
+		t.Errorf("got %q after a failed write", by)
+	}
+}
+
+func TestHTTPSourceProxy(t *testing.T) {
+	var proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() != "http://data.example.com/rows.json" || r.Header.Get("Authorization") != "" {
+			t.Errorf("proxied %s with Authorization %q", r.URL, r.Header.Get("Authorization"))
+		}
+		w.Write([]byte("{}\n"))
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	var c = &Client{transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	r, _, err := httpSource{}.Open(c, &url.URL{Scheme: "http", Host: "data.example.com", Path: "/rows.json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if by, _ := ioutil.ReadAll(r); string(by) != "{}\n" {
+		t.Errorf("got %q", by)
+	}
+}
@@ -0,0 +1,98 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Copy schema and data of table src to dst, replacing dst if it exists, e.g.
+// to promote a table from a staging project to production. Both are
+// "dataset.table" or "project.dataset.table", the project defaulting to the
+// client's. dst's dataset is created if it doesn't exist.
+//
+// Tables in the same location are copied with a copy job. Otherwise src is
+// extracted to stagingBucket as Avro and loaded from there, so the bucket
+// has to be readable in both locations (e.g. a multi-region bucket). The
+// staged files are deleted afterwards.
+func (c *Client) SyncTable(src, dst, stagingBucket string) error {
+	if src == "" || dst == "" {
+		return errors.New("missing params")
+	}
+	srcRef, err := splitTable(c.ProjectID, src)
+	if err != nil {
+		return err
+	}
+	dstRef, err := splitTable(c.ProjectID, dst)
+	if err != nil {
+		return err
+	}
+
+	if err = c.checkDataset(dstRef.ProjectId, dstRef.DatasetId, true); err != nil {
+		return fmt.Errorf("Error checking/creating dataset - %s", err)
+	}
+	srcSet, err := c.bq.Datasets.Get(srcRef.ProjectId, srcRef.DatasetId).Do()
+	if err != nil {
+		return fmt.Errorf("Error getting dataset - %s", err)
+	}
+	dstSet, err := c.bq.Datasets.Get(dstRef.ProjectId, dstRef.DatasetId).Do()
+	if err != nil {
+		return fmt.Errorf("Error getting dataset - %s", err)
+	}
+
+	// Same location, a copy job does it all.
+	if strings.EqualFold(srcSet.Location, dstSet.Location) {
+		_, err = c.runJobIn(context.Background(), srcSet.Location, &bigquery.JobConfiguration{
+			Copy: &bigquery.JobConfigurationTableCopy{
+				SourceTable:                        srcRef,
+				DestinationTable:                   dstRef,
+				CreateDisposition:                  "CREATE_IF_NEEDED",
+				WriteDisposition:                   WriteTruncate,
+				DestinationEncryptionConfiguration: c.encryption(),
+			},
+		})
+		return err
+	}
+
+	if stagingBucket == "" {
+		return fmt.Errorf("Tables are in different locations (%s, %s), a staging bucket is needed",
+			srcSet.Location, dstSet.Location)
+	}
+	table, err := c.bq.Tables.Get(srcRef.ProjectId, srcRef.DatasetId, srcRef.TableId).Do()
+	if err != nil {
+		return fmt.Errorf("Error getting table - %s", err)
+	}
+	var fields []TableField
+	if table.Schema != nil {
+		fields = toTableFields(table.Schema.Fields)
+	}
+
+	var prefix = "bqwrapper-sync-" + strconv.FormatInt(time.Now().UnixNano(), 10) + "/"
+	defer func() {
+		names, _ := c.listGCS(stagingBucket, prefix)
+		for _, name := range names {
+			c.deleteGCS(stagingBucket, name)
+		}
+	}()
+
+	var uri = "gs://" + stagingBucket + "/" + prefix + "data-*.avro"
+	_, err = c.runJobIn(context.Background(), srcSet.Location, &bigquery.JobConfiguration{
+		Extract: &bigquery.JobConfigurationExtract{
+			SourceTable:         srcRef,
+			DestinationUris:     []string{uri},
+			DestinationFormat:   "AVRO",
+			UseAvroLogicalTypes: true,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Error extracting - %s", err)
+	}
+	if err = c.restoreTable(dstSet.Location, dstRef, fields, toTimePartitioning(table.TimePartitioning), uri); err != nil {
+		return fmt.Errorf("Error loading - %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package bqwrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"strings"
+)
+
+// Copy a table to another table, which is created if it doesn't exist.
+// ProjectID of src and dst default to the client's project.
+func (c *Client) CopyTable(src, dst Destination, writeDisposition string) error {
+	if src.DatasetID == "" || src.TableID == "" || dst.DatasetID == "" || dst.TableID == "" {
+		return errors.New("missing params")
+	}
+	if err := src.Validate(); err != nil {
+		return err
+	}
+	if err := dst.Validate(); err != nil {
+		return err
+	}
+	if writeDisposition == "" {
+		writeDisposition = WriteEmpty
+	}
+
+	// Send it and wait until it's done.
+	_, err := c.runJob(&bigquery.JobConfiguration{
+		Copy: &bigquery.JobConfigurationTableCopy{
+			SourceTable:                        c.tableRef(src),
+			DestinationTable:                   c.tableRef(dst),
+			CreateDisposition:                  "CREATE_IF_NEEDED",
+			WriteDisposition:                   writeDisposition,
+			DestinationEncryptionConfiguration: c.encryption(),
+		},
+	})
+	return err
+}
+
+// Table reference for the table, in the client's project unless set.
+func (c *Client) tableRef(t Destination) *bigquery.TableReference {
+	var ref = &bigquery.TableReference{
+		ProjectId: t.ProjectID,
+		DatasetId: t.DatasetID,
+		TableId:   t.TableID,
+	}
+	if ref.ProjectId == "" {
+		ref.ProjectId = c.ProjectID
+	}
+	return ref
+}
+
+// Read rows of the table with tabledata.list, which doesn't cost a query, and
+// pass each page of rows with their schema to fn, at least once even if there are no rows.
+// If selected is set, only those fields ("addr.city" for nested ones) are read.
+// If pageSize is set, at most that many rows are requested at a time.
+func (c *Client) tableData(ctx context.Context, ref *bigquery.TableReference, selected []string, pageSize int64, fn pageFunc) error {
+	ctx, end, err := c.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	// Need the schema to make sense of the rows.
+	table, err := c.bq.Tables.Get(ref.ProjectId, ref.DatasetId, ref.TableId).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("Error getting table - %s", err)
+	}
+	if table.Schema == nil {
+		return errors.New("Error getting table, no schema returned")
+	}
+	var fields = table.Schema.Fields
+	if len(selected) != 0 {
+		if fields, err = selectFields(fields, selected, ""); err != nil {
+			return err
+		}
+	}
+
+	req := c.bq.Tabledata.List(ref.ProjectId, ref.DatasetId, ref.TableId).Context(ctx)
+	if len(selected) != 0 {
+		req.SelectedFields(strings.Join(selected, ","))
+	}
+	if pageSize > 0 {
+		req.MaxResults(pageSize)
+	}
+	for {
+		res, err := req.Do()
+		if err != nil {
+			return fmt.Errorf("Error getting table data - %s", err)
+		}
+		if err = fn(fields, res.Rows); err != nil {
+			return err
+		}
+		if res.PageToken == "" {
+			break
+		}
+		req.PageToken(res.PageToken)
+	}
+
+	return nil
+}
+
+// Filter the schema down to the selected fields, keeping the schema order
+// which is also the order BigQuery returns selected cells in.
+func selectFields(fields []*bigquery.TableFieldSchema, selected []string, prefix string) ([]*bigquery.TableFieldSchema, error) {
+	// Check all selected fields exist first.
+	if prefix == "" {
+		for _, name := range selected {
+			if findField(fields, name) == nil {
+				return nil, fmt.Errorf("No such field %s", name)
+			}
+		}
+	}
+
+	var result []*bigquery.TableFieldSchema
+	var name string
+	for _, field := range fields {
+		name = prefix + field.Name
+		for _, sel := range selected {
+			if sel == name {
+				// The whole field, including everything nested in it.
+				result = append(result, field)
+				break
+			}
+			if strings.HasPrefix(sel, name+".") {
+				// Only some of the nested fields.
+				var sub = *field
+				sub.Fields, _ = selectFields(field.Fields, selected, name+".")
+				result = append(result, &sub)
+				break
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package bqwrapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// {{name}} variables.
+var templateVar = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Date variables of the day: run_date and ds (2006-01-02), ds_nodash
+// (20060102), yesterday_ds and yesterday_ds_nodash.
+func DateVars(date time.Time) map[string]string {
+	var yesterday = date.AddDate(0, 0, -1)
+	return map[string]string{
+		"run_date":            date.Format("2006-01-02"),
+		"ds":                  date.Format("2006-01-02"),
+		"ds_nodash":           date.Format("20060102"),
+		"yesterday_ds":        yesterday.Format("2006-01-02"),
+		"yesterday_ds_nodash": yesterday.Format("20060102"),
+	}
+}
+
+// Replace {{name}} in s with the variable, which is one of vars or a date
+// variable (see DateVars) of today in UTC, or of run_date if it's in vars.
+// Unknown variables are an error.
+func Expand(s string, vars map[string]string) (string, error) {
+	all, err := templateVars(vars)
+	if err != nil {
+		return "", err
+	}
+	by, err := expandVars(all, []byte(s))
+	return string(by), err
+}
+
+// Date variables overridden by the ones set.
+func templateVars(set map[string]string) (map[string]string, error) {
+	var date = time.Now().UTC()
+	if v, ok := set["run_date"]; ok {
+		var err error
+		if date, err = time.Parse("2006-01-02", v); err != nil {
+			return nil, fmt.Errorf("Invalid run_date %s - %s", v, err)
+		}
+	}
+	var vars = DateVars(date)
+	for k, v := range set {
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// Replace {{name}} in by with vars.
+func expandVars(vars map[string]string, by []byte) ([]byte, error) {
+	var missing []string
+	by = templateVar.ReplaceAllFunc(by, func(m []byte) []byte {
+		var name = string(templateVar.FindSubmatch(m)[1])
+		val, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return []byte(val)
+	})
+	if len(missing) != 0 {
+		return nil, fmt.Errorf("Unknown variables %s", strings.Join(missing, ", "))
+	}
+	return by, nil
+}
+
+// Expand each of fields with set, as Expand does.
+// Nothing is done if set is nil.
+func expandFields(set map[string]string, fields ...*string) error {
+	if set == nil {
+		return nil
+	}
+	vars, err := templateVars(set)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		by, err := expandVars(vars, []byte(*f))
+		if err != nil {
+			return err
+		}
+		*f = string(by)
+	}
+	return nil
+}
@@ -1,38 +1,932 @@
 package bqwrapper
 
+import (
+	"fmt"
+	"github.com/robfig/cron/v3"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/api/bigquery/v2"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client for a BigQuery project
+//
+// A client is safe for concurrent use by multiple goroutines, so workers can
+// share one. Its exported fields must not be changed once it's in use.
+type Client struct {
+	ProjectID string
+
+	// Location of datasets and jobs, e.g. "asia-northeast1".
+	// Required for jobs outside of US and EU multi-regions.
+	Location string
+
+	// Cloud KMS key (projects/.../cryptoKeys/...) used to encrypt tables
+	// created by load, query and copy jobs of this client.
+	KMSKeyName string
+
+	client    *http.Client
+	transport *http.Transport
+	bq        *bigquery.Service
+
+	// If set, every job the client runs is recorded here once it's done.
+	Audit AuditSink
+
+	// If set, jobs the client submits are kept here with their state.
+	Journal *JobJournal
+
+	// Cancel jobs on BigQuery when the context of the operation running them
+	// (e.g. LoadContext, DumpContext, or OperationTimeout) is done, so slots
+	// aren't spent on results nobody reads.
+	CancelJobs bool
+
+	// Options used by loads and dumps that leave them empty.
+	Defaults ClientDefaults
+
+	// Limits on the client's jobs, set before running any.
+	Guardrails Guardrails
+
+	// Dataset checks in flight, see checkDataset.
+	datasets singleflight.Group
+
+	// Usage counted against Guardrails.
+	guard guardState
+
+	// Operations in flight, see Shutdown.
+	life lifecycle
+}
+
+// Limits a client enforces on its own jobs, so a misbehaving batch can't
+// run up costs. Jobs refused by them fail with a GuardrailError.
+type Guardrails struct {
+	// Bytes billed by the client's queries per UTC day, no limit if 0.
+	// Each query may be billed at most what's left of it. Bytes are counted
+	// when a query finishes, so queries running at once may go over together.
+	MaxBytesBilledPerDay int64
+
+	// Jobs running at once, others wait for a slot. No limit if 0.
+	MaxConcurrentJobs int
+
+	// Datasets no job may read or write, "project.dataset" or a dataset of
+	// the client's project. Queries are dry run first to find what they read.
+	DeniedDatasets []string
+}
+
+// Error returned when a job is refused by the client's guardrails
+type GuardrailError struct {
+	Message string
+}
+
+func (e *GuardrailError) Error() string {
+	return "Refused by guardrails - " + e.Message
+}
+
+// Defaults of a client for options left empty in LoadConfig and DumpConfig
+type ClientDefaults struct {
+	// Dataset of loads.
+	DatasetID string `yaml:"dataset"`
+
+	// Format, csv delimiter, query timeout (milliseconds) and page size of
+	// dumps.
+	Format    string `yaml:"format"`
+	Delimiter string `yaml:"delimiter"`
+	Timeout   int64  `yaml:"timeout"`
+	PageSize  int64  `yaml:"page_size"`
+}
+
+// File of named client profiles, ~/.bqwrapper.yaml by default
+type ProfileFile struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// Client settings of a profile. Project and credentials are required,
+// unless set in the environment (see NewClientWithTransport).
+type Profile struct {
+	Project string `yaml:"project"`
+	// JWT file, may start with ~/.
+	Credentials  string `yaml:"credentials"`
+	Location     string `yaml:"location"`
+	Proxy        string `yaml:"proxy"`
+	KMSKeyName   string `yaml:"kms_key_name"`
+	QuotaProject string `yaml:"quota_project"`
+	UserAgent    string `yaml:"user_agent"`
+	CancelJobs   bool   `yaml:"cancel_jobs"`
+
+	Defaults ClientDefaults `yaml:"defaults"`
+}
+
+// Record of a finished job in the audit log
+type AuditRecord struct {
+	JobID string `json:"jobId"`
+	// LOAD, QUERY, COPY or EXTRACT.
+	Type string `json:"type"`
+	// Destination table (project.dataset.table), or source table of extracts.
+	Target string `json:"target,omitempty"`
+	// Bytes loaded or processed.
+	Bytes    int64         `json:"bytes"`
+	User     string        `json:"user"`
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Duration time.Duration `json:"durationNs"`
+	// SUCCESS or FAILURE, and the error if it failed.
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Receives audit records of jobs.
+// It's called from any goroutine using the client.
+type AuditSink interface {
+	Record(r AuditRecord) error
+}
+
+// Audit sink appending records to a file as json lines
+type FileAuditSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// Audit sink posting records as json to a URL
+type WebhookAuditSink struct {
+	URL string
+	// Client to post with, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Local log of the jobs a client submitted, as json lines
+type JobJournal struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// Job in a journal
+type JournalEntry struct {
+	JobID    string `json:"jobId"`
+	Location string `json:"location,omitempty"`
+	// LOAD, QUERY, COPY or EXTRACT.
+	Type string `json:"type"`
+	// Destination table (project.dataset.table), or source table of extracts.
+	Target string `json:"target,omitempty"`
+	// PENDING or RUNNING until the job is seen done, then DONE, and the
+	// error if it failed.
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	Submitted time.Time `json:"submitted"`
+	Finished  time.Time `json:"finished"`
+}
+
+// Jobs JobJournal.List returns, empty fields match every job
+type JournalFilter struct {
+	Type   string
+	Target string
+	// Jobs submitted at or after this.
+	Since time.Time
+	// Only jobs not seen done, e.g. those running when the process stopped.
+	Incomplete bool
+	// Only jobs that failed.
+	Failed bool
+}
+
+// HTTP transport settings of a client
+type TransportConfig struct {
+	// Proxy URL for all requests.
+	Proxy string
+
+	// Idle connections kept for reuse, in total (100 by default) and per host
+	// (64 by default). Raise them if more goroutines share the client.
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+
+	// Limit of connections per host, no limit if 0.
+	MaxConnsPerHost int
+
+	// How long idle connections are kept (90 seconds by default).
+	IdleConnTimeout time.Duration
+
+	// Use HTTP/1.1 only. With HTTP/2 (default), requests to the same host
+	// share a connection.
+	DisableHTTP2 bool
+
+	// User-Agent of requests, "bqwrapper/" + Version by default.
+	UserAgent string
+
+	// Project billed for API quota (x-goog-user-project header) instead of
+	// the service account's. The account needs serviceusage.services.use
+	// permission on it.
+	QuotaProject string
+}
+
+// Sets headers on every request
+type headerTransport struct {
+	base         http.RoundTripper
+	userAgent    string
+	quotaProject string
+}
+
+// Csv quoting modes
+const (
+	QuoteMinimal = "minimal"
+	QuoteAlways  = "always"
+	QuoteNone    = "none"
+)
+
+// Float formats
+const (
+	FloatDecimal  = "decimal"
+	FloatExponent = "exponent"
+)
+
+// Type mappings for DumpConfig.TypeMapping
+const (
+	MapEpoch   = "epoch"
+	MapRFC3339 = "rfc3339"
+	MapString  = "string"
+	MapFloat   = "float"
+	MapBase64  = "base64"
+	MapRaw     = "raw"
+	MapISO8601 = "iso8601"
+	MapNumber  = "number"
+	MapBigRat  = "bigrat"
+)
+
+// What DumpConfig.OversizeAction does with a cell or row over the limits
+const (
+	OversizeTruncate = "truncate"
+	OversizeSkip     = "skip"
+	OversizeError    = "error"
+)
+
+// What DumpConfig.UnknownTypeMode does with columns of types dumps don't know
+const (
+	UnknownTypeError  = "error"
+	UnknownTypeString = "string"
+	UnknownTypeSkip   = "skip"
+)
+
+// Rules of query linting
+const (
+	LintSelectStar      = "select-star"
+	LintPartitionFilter = "partition-filter"
+	LintLegacySQL       = "legacy-sql"
+	LintCost            = "cost"
+)
+
+// Masking of a column in DumpConfig.Mask
+const (
+	MaskHash     = "hash"
+	MaskRedact   = "redact"
+	MaskTruncate = "truncate"
+	MaskFake     = "fake"
+)
+
+// Post-load actions for LoadConfig.AfterLoad
+const (
+	AfterLoadDelete = "delete"
+	AfterLoadMove   = "move"
+	AfterLoadGzip   = "gzip"
+)
+
+// Options for Client.Load
+type LoadConfig struct {
+	// Destination table in the client's project.
+	DatasetID string
+	TableID   string
+
+	// Schema (json) and data (json or csv) files.
+	// SourceFile may also be a URL (gs://, s3://, http(s)://, or any scheme
+	// registered with RegisterSource), or "-" for stdin.
+	SchemaFile string
+	SourceFile string
+
+	// Format of the source, "json" or "csv". By default it's told by the
+	// suffix of SourceFile.
+	SourceFormat string
+
+	// Do not create the dataset if it doesn't exist, fail instead.
+	NoCreateDataset bool
+
+	// If the table is created by this load, it expires after this long.
+	TableExpiration time.Duration
+
+	// Time partitioning of the table - "DAY", "HOUR", "MONTH" or "YEAR".
+	// Partitions are by load time unless PartitionField is set, and each
+	// partition expires after PartitionExpiration if it's set.
+	Partitioning        string
+	PartitionField      string
+	PartitionExpiration time.Duration
+
+	// If StagingBucket is set, data is uploaded to gs://StagingBucket/StagingPrefix...
+	// first and loaded from there, which is more reliable for large files
+	// than uploading directly to BigQuery. The object is deleted after the
+	// load unless KeepStaged is set.
+	StagingBucket string
+	StagingPrefix string
+	KeepStaged    bool
+
+	// Report completion of the load.
+	Notify NotifyConfig
+
+	// If set, {{name}} in TableID and SourceFile is replaced with the
+	// variable, see Expand. An empty map gives the date variables only.
+	Vars map[string]string
+
+	// If set, duplicate rows are removed from the table after the load,
+	// keeping one row of each set of DedupKeys values: the first by
+	// DedupOrderBy (e.g. "updated_at DESC") if it's set. The whole table is
+	// rewritten, so ingestion-time partitioned tables can't be deduplicated.
+	DedupKeys    []string
+	DedupOrderBy string
+
+	// If set, a load failing on bad records is retried without them, up to
+	// RejectRetries times (3 by default), and their lines are written to
+	// RejectFile. Bad records are found by the position BigQuery reports
+	// them at, which needs SourceFile to be read again, so it can't be stdin.
+	// CSV fields must not have newlines. Loads of one call (LoadDirectory,
+	// LoadDataset, shards etc.) write to the same RejectFile.
+	RejectFile    string
+	RejectRetries int
+	rejects       *rejectFile
+
+	// If set, the load fails with a timeout error if it takes longer than
+	// this, e.g. when an upload is stuck or the job never finishes. The job
+	// may still finish on BigQuery's side.
+	OperationTimeout time.Duration
+
+	// Check the source against the schema before uploading it, see
+	// Client.ValidateLoad, and fail without loading if any row is invalid.
+	// The source is read twice, so stdin is kept in a temporary file.
+	// If ValidateStrict is set, validation stops at the first invalid row
+	// instead of reading the whole source.
+	Validate       bool
+	ValidateStrict bool
+
+	// Fail before uploading if rows miss REQUIRED fields (after defaults of
+	// the schema are filled), with a RequiredFieldError listing them.
+	EnforceRequired bool
+
+	// What to do with a local SourceFile once it's loaded - AfterLoadDelete,
+	// AfterLoadMove (to ArchiveDir) or AfterLoadGzip (to SourceFile.gz).
+	// If it fails, Load returns the error although the data is loaded.
+	AfterLoad  string
+	ArchiveDir string
+
+	// Load into a date-sharded table, TableID + "_" + yyyymmdd (e.g.
+	// events_20240101), of ShardDate. With ShardField, a top level
+	// TIMESTAMP, DATE or DATETIME field, rows are instead split by their
+	// date in that field (timestamps in UTC), one load per shard. Every row
+	// needs a valid date, and the source is split before any shard is loaded.
+	// ShardDate is taken as a date in its own location.
+	ShardDate  time.Time
+	ShardField string
+
+	// Load gs:// SourceFile (e.g. gs://bucket/events/*) directly from GCS
+	// with hive partitioning, filling partition columns from the object
+	// paths. SourceFormat has to be set if SourceFile has no suffix.
+	HivePartitioning *HivePartitioning
+}
+
+// Hive partitioning of a load from GCS
+type HivePartitioning struct {
+	// How partition keys are typed - "AUTO" (default, inferred), "STRINGS",
+	// or "CUSTOM" with types in SourceURIPrefix, e.g.
+	// "gs://bucket/events/{dt:DATE}/{country:STRING}".
+	Mode string
+
+	// Common prefix of the object paths before the partition keys, e.g.
+	// "gs://bucket/events/".
+	SourceURIPrefix string
+
+	// Queries of the table created by the load need a partition filter.
+	RequirePartitionFilter bool
+}
+
+// Where completion of a Load or Dump is reported
+type NotifyConfig struct {
+	// URL the Completion is posted to as json (e.g. a Slack or Airflow webhook).
+	URL string
+
+	// Called with the Completion.
+	Callback func(Completion)
+
+	// Pub/Sub topic the Completion is published to as json, with "operation"
+	// and "status" attributes. Either a full name (projects/.../topics/...)
+	// or a topic of the client's project.
+	Topic string
+}
+
+// Pub/Sub publish request JSON structs
+type publishRequest struct {
+	Messages []pubsubMessage `json:"messages"`
+}
+type pubsubMessage struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Outcome of a Load or Dump
+type Completion struct {
+	// "load" or "dump".
+	Operation string `json:"operation"`
+	JobID     string `json:"jobId,omitempty"`
+	// Where the job ran, e.g. for GetQueryPlan.
+	Location string `json:"location,omitempty"`
+
+	// SUCCESS or FAILURE, and the error if it failed.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// Destination table (project.dataset.table) of loads, output of dumps.
+	Table  string `json:"table,omitempty"`
+	Output string `json:"output,omitempty"`
+
+	// Rows loaded or dumped, and bytes loaded.
+	Rows  uint64 `json:"rows"`
+	Bytes int64  `json:"bytes,omitempty"`
+
+	// Rows skipped by a dump with SkipBadRows or OversizeSkip.
+	Skipped uint64 `json:"skipped,omitempty"`
+
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// Pipeline file for Client.RunPipeline
+type Pipeline struct {
+	// Variables for {{name}} in the file. They override the date variables.
+	Vars  map[string]string `json:"vars" yaml:"vars"`
+	Steps []PipelineStep    `json:"steps" yaml:"steps"`
+}
+
+// Step of a pipeline. One of Load, Query, Extract and Dump is set.
+type PipelineStep struct {
+	Name string `json:"name" yaml:"name"`
+
+	// Steps that have to succeed before this one runs.
+	Needs []string `json:"needs" yaml:"needs"`
+
+	Load    *PipelineLoad    `json:"load" yaml:"load"`
+	Query   *PipelineQuery   `json:"query" yaml:"query"`
+	Extract *PipelineExtract `json:"extract" yaml:"extract"`
+	Dump    *PipelineDump    `json:"dump" yaml:"dump"`
+}
+
+// Load step, see LoadConfig
+type PipelineLoad struct {
+	Dataset        string `json:"dataset" yaml:"dataset"`
+	Table          string `json:"table" yaml:"table"`
+	Schema         string `json:"schema" yaml:"schema"`
+	Source         string `json:"source" yaml:"source"`
+	Format         string `json:"format" yaml:"format"`
+	Partitioning   string `json:"partitioning" yaml:"partitioning"`
+	PartitionField string `json:"partition_field" yaml:"partition_field"`
+	StagingBucket  string `json:"staging_bucket" yaml:"staging_bucket"`
+}
+
+// Query step. Results are written to the table if set, see MaterializeConfig.
+// Otherwise the query runs as a statement (e.g. DML).
+type PipelineQuery struct {
+	SQL       string `json:"sql" yaml:"sql"`
+	Dataset   string `json:"dataset" yaml:"dataset"`
+	Table     string `json:"table" yaml:"table"`
+	Write     string `json:"write" yaml:"write"`
+	Partition string `json:"partition" yaml:"partition"`
+}
+
+// Extract step, exporting the table to GCS
+type PipelineExtract struct {
+	Dataset string   `json:"dataset" yaml:"dataset"`
+	Table   string   `json:"table" yaml:"table"`
+	URIs    []string `json:"uris" yaml:"uris"`
+	// CSV (default), NEWLINE_DELIMITED_JSON, AVRO or PARQUET, and
+	// GZIP etc. to compress.
+	Format      string `json:"format" yaml:"format"`
+	Compression string `json:"compression" yaml:"compression"`
+}
+
+// Dump step, see DumpConfig
+type PipelineDump struct {
+	Query       string `json:"query" yaml:"query"`
+	Table       string `json:"table" yaml:"table"`
+	Output      string `json:"output" yaml:"output"`
+	Format      string `json:"format" yaml:"format"`
+	Delimiter   string `json:"delimiter" yaml:"delimiter"`
+	PrintFields bool   `json:"print_fields" yaml:"print_fields"`
+}
+
+// Runs loads, dumps and other jobs on cron schedules
+type Scheduler struct {
+	c    *Client
+	mu   sync.Mutex
+	jobs []*scheduledJob
+	wg   sync.WaitGroup
+
+	// Closed by Stop, nil while not started.
+	stop chan struct{}
+}
+
+// Job of a Scheduler, and its status
+type scheduledJob struct {
+	schedule cron.Schedule
+	fn       func(c *Client) error
+	status   ScheduleStatus
+}
+
+// Status of a scheduled job
+type ScheduleStatus struct {
+	Name     string
+	Schedule string
+
+	// Whether it's running now, and when it runs next.
+	Running bool
+	Next    time.Time
+
+	// Last run, and its error if it failed.
+	LastStart time.Time
+	LastEnd   time.Time
+	LastError error
+
+	// Number of runs finished and failed, and runs skipped because the
+	// previous one was still running.
+	Runs     uint64
+	Failures uint64
+	Skipped  uint64
+}
+
+// Object of S3 compatible storage to load from
+type S3Source struct {
+	// Endpoint of the storage ("s3.amazonaws.com" by default, or e.g.
+	// "minio.example.com:9000"), and whether to connect without TLS.
+	Endpoint string
+	Insecure bool
+	Region   string
+
+	// Credentials.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	Bucket string
+	Key    string
+}
+
+// Reads data to load from locations with a URL scheme (see RegisterSource)
+type Source interface {
+	// Open the data at the location. Size is -1 if it's not known.
+	Open(c *Client, u *url.URL) (r io.ReadCloser, size int64, err error)
+}
+
+// Writes dump output to locations with a URL scheme (see RegisterSink)
+type Sink interface {
+	// Create output at the location. It shouldn't show up there until
+	// the writer is committed.
+	Create(c *Client, u *url.URL, conf DumpConfig) (SinkWriter, error)
+
+	// Remove output created earlier, when a dump fails.
+	Remove(c *Client, u *url.URL) error
+}
+
+// Output being written to a Sink
+type SinkWriter interface {
+	io.Writer
+
+	// Make the output available once everything is written.
+	Commit() error
+
+	// Give up on the output.
+	Abort() error
+}
+
+// Converts values of a field type or column in dumps (see DumpConfig.Converters)
+type Converter interface {
+	// Convert a non-null value of the field, as the API returns it (a
+	// string, or for RECORDs {"f": [{"v": ...}, ...]}), to the value written.
+	// json outputs marshal it, and csv, sheets and SQL outputs write the
+	// result of its String method if it has one.
+	Convert(field *bigquery.TableFieldSchema, v interface{}) (interface{}, error)
+}
+
+// Converter calling a function
+type ConverterFunc func(field *bigquery.TableFieldSchema, v interface{}) (interface{}, error)
+
+func (f ConverterFunc) Convert(field *bigquery.TableFieldSchema, v interface{}) (interface{}, error) {
+	return f(field, v)
+}
+
+// Options for Client.Dump
+type DumpConfig struct {
+	// Output file and its format ("json", "csv", "arrow", "proto", "sqlite", "sql"
+	// or "sheets"). For json, csv, arrow and proto, Output may also be a URL (gs://,
+	// or any scheme registered with RegisterSink), or "-" for stdout.
+	Output string
+	Format string
+
+	// Query to run.
+	Query string
+
+	// Table to dump ("dataset.table" or "project.dataset.table"), used if
+	// Query is not set.
+	Table string
+
+	// Read Table as it was at this time. It has to be within the last 7 days.
+	// Dumps of a Query fail if it's set.
+	AsOf time.Time
+
+	// Dump only about this percentage (0 to 100) of rows, picked at random.
+	// Table is sampled by blocks with TABLESAMPLE, which only reads (and
+	// bills) the sampled part. Query results are filtered row by row, which
+	// costs the same as the whole query.
+	Sample float64
+
+	// Field separator for csv (default ","). "tab" means a tab.
+	Delimiter string
+
+	// Format json output.
+	Pretty bool
+
+	// Encode each row of json output instead of json.Marshal, e.g. to order
+	// keys, leave out nulls or write protobuf json. It gets the row as it
+	// would be marshaled, which it must not keep, and has to return a json
+	// value; rows are still written as elements of an array, but indenting
+	// them for Pretty is up to it.
+	MarshalRow func(row map[string]interface{}) ([]byte, error)
+
+	// Write field names on top of csv output.
+	PrintFields bool
+
+	// Csv quoting - QuoteMinimal (default), QuoteAlways or QuoteNone.
+	Quote string
+
+	// Character used to escape quotes in quoted csv fields, instead of doubling them.
+	// With QuoteNone, it's used to escape delimiters and newlines.
+	Escape string
+
+	// End csv lines with CRLF instead of LF.
+	CRLF bool
+
+	// Start each csv file with a UTF-8 byte order mark. With CRLF, Excel on
+	// Windows opens the file with the right encoding.
+	BOM bool
+
+	// Write integer values as strings in json output, so consumers parsing
+	// numbers as doubles don't lose precision on large values.
+	IntegerAsString bool
+
+	// How float values are written, FloatDecimal or FloatExponent.
+	// Default is the shortest representation, which may use an exponent.
+	FloatFormat string
+
+	// Number of digits after the decimal point for float values.
+	// 0 means as many as needed to represent the value exactly.
+	FloatDigits int
+
+	// Csv layouts (time.Format, e.g. "2006-01-02 15:04:05") of TIMESTAMP,
+	// DATE and DATETIME values. TIMESTAMPs are written in TimeZone (e.g.
+	// "Asia/Tokyo", UTC by default), as RFC3339 if only TimeZone is set.
+	TimestampLayout string
+	DateLayout      string
+	DatetimeLayout  string
+	TimeZone        string
+
+	// How values of a BigQuery type are represented in the output, keyed by type.
+	//   "TIMESTAMP"  - MapEpoch (seconds, default) or MapRFC3339 (keeps fractional seconds)
+	//   "NUMERIC"    - MapString (default), MapNumber (a json number), MapBigRat (*Decimal, a
+	//                  big.Rat) or MapFloat, same for "BIGNUMERIC". All but MapFloat are exact.
+	//   "BYTES"      - MapBase64 (default) or MapRaw
+	//   "JSON"       - the value as json (default) or MapString (json text as a string)
+	//   "INTERVAL"   - MapString (default, e.g. "1-2 3 4:5:6") or MapISO8601 ("P1Y2M3DT4H5M6S")
+	// Other types or values fail the dump.
+	TypeMapping map[string]string
+
+	// Converters replacing how values of a BigQuery type (e.g. "TIMESTAMP",
+	// or "GEOGRAPHY" which dumps don't know otherwise) are converted, keyed by
+	// type, and of a column of this dump ("addr.city" in RECORDs), which
+	// take precedence. Arrow outputs keep their own conversion.
+	Converters       map[string]Converter
+	ColumnConverters map[string]Converter
+
+	// Query timeout in milliseconds.
+	Timeout int64
+
+	// Maximum number of rows to get per page of results.
+	PageSize int64
+
+	// Only get these fields ("addr.city" for nested ones) from the query results,
+	// so unused columns of a wide result aren't transferred.
+	Fields []string
+
+	// Only select these columns ("addr.city" for nested ones) of the table or
+	// query results. Unlike Fields, the query itself is changed, so columns
+	// that aren't selected aren't scanned or billed either. Nested fields
+	// selected by a query are named by their last part, e.g. "city".
+	Columns []string
+
+	// Do not use cached query results, of BigQuery or of CacheDir.
+	NoCache bool
+
+	// Run the query in this session (see Client.RunScript), so temp tables
+	// created there can be used. The query has to be standard SQL.
+	SessionID string
+
+	// If either is set, the output is split into several files
+	// (output-00001.json, output-00002.json, ...) each one holding up to
+	// MaxRowsPerFile rows and/or about MaxBytesPerFile bytes.
+	MaxRowsPerFile  int
+	MaxBytesPerFile int64
+
+	// Save progress to ResumeFile (job ID, page token and how much output
+	// was written) after each page, so a dump that dies part way is
+	// continued by running it again with the same ResumeFile, as long as
+	// the job's results are still kept (about a day). Output written so far
+	// is kept when the dump fails. Only for json and csv output to local
+	// files, and not with Fields, CacheDir or Failover.
+	ResumeFile string
+
+	// Write output.manifest.json listing the output files with their size,
+	// MD5 and number of rows, so a partial transfer can be detected.
+	// Client.LoadManifest loads the files, checking them first. Only for
+	// json and csv output to files.
+	Manifest bool
+
+	// Output files are written to output.tmp, synced and then renamed, so a
+	// crash never leaves a truncated file under the final name.
+	// Set NoAtomic to write directly to the output file instead.
+	NoAtomic bool
+
+	// Keep files written so far when the dump fails, instead of removing them.
+	KeepPartial bool
+
+	// Write output.meta.json next to the output once the dump succeeds, with
+	// the schema, number of rows, query or table, job ID, bytes processed and
+	// timestamps, so consumers can check what they got. Not for sql and
+	// sheets output or stdout.
+	Metadata bool
+
+	// Permissions of output (and temp) files and of directories created for
+	// them. Defaults are 0666 and 0777, before umask.
+	FileMode os.FileMode
+	DirMode  os.FileMode
+
+	// Cache query results in CacheDir, keyed by project, location and query,
+	// so repeated dumps of the same query don't run it again. Cached results
+	// older than CacheTTL are not used (0 means they never expire).
+	// BypassCache, or NoCache, runs the query anyway and refreshes the cache.
+	// Cache files are only readable by the user unless FileMode is set, and
+	// dumps with Mask are never cached.
+	CacheDir    string
+	CacheTTL    time.Duration
+	BypassCache bool
+
+	// Report completion of the dump.
+	Notify NotifyConfig
+
+	// Reuse memory of converted rows once they're written out, which saves
+	// a lot of garbage collection on large dumps.
+	ReuseRows bool
+
+	// RECORD columns are written as nested objects (as json text in csv,
+	// sql and sheets output). If Flatten is set, each of their fields is a
+	// column of its own instead, named by its path (e.g. "addr.city").
+	// REPEATED fields are always written as arrays.
+	Flatten bool
+
+	// Limits of json and csv output: bytes of a single string value and
+	// of a whole encoded row. OversizeAction says what happens to a row over
+	// them - OversizeTruncate (default) cuts values down to MaxCellBytes
+	// ending with "...[truncated]", OversizeSkip skips the row, counting it
+	// in Completion.Skipped, and OversizeError fails with a *RowError.
+	// A row still over MaxRowBytes after truncating fails.
+	MaxCellBytes   int
+	MaxRowBytes    int
+	OversizeAction string
+
+	// Columns of types dumps don't know yet, e.g. ones BigQuery added, fail
+	// the rows they're in by default. UnknownTypeString writes them as
+	// STRING, with the value as BigQuery returns it, UnknownTypeSkip leaves
+	// them out, and UnknownTypeError fails the dump before any row.
+	UnknownTypeMode string
+
+	// Masking of columns, e.g. {"email": MaskHash, "name": MaskFake}, done
+	// before rows are written so PII never reaches the output:
+	// MaskHash writes the SHA-256 (hex) of MaskSalt + value, MaskRedact
+	// writes null, MaskTruncate keeps the first 4 characters ("truncate:2"
+	// keeps 2), and MaskFake replaces each digit and letter (of STRING
+	// columns) with a random one, keeping the shape. The same value is
+	// always masked the same way. Only top level columns can be masked, and
+	// RECORD and REPEATED ones only redacted.
+	Mask     map[string]string
+	MaskSalt string
+
+	// Check the query before running it, see Client.LintQuery. Issues fail
+	// the dump with a *LintError or are passed to Lint.Warn.
+	Lint *LintConfig
+
+	// Output names of columns, e.g. {"user_id": "UserID"}, used for csv
+	// headers, json keys and columns of other formats instead of the names
+	// in the results. Only top level columns can be renamed.
+	Rename map[string]string
+
+	// Skip rows whose values can't be converted, counting them in
+	// Completion.Skipped, instead of failing with a *RowError.
+	SkipBadRows bool
+
+	// Table the rows are written to if Format is "sqlite" or "sql" ("results"
+	// by default). The sqlite table is dropped and created again on each dump,
+	// other tables are created if they don't exist.
+	SQLTable string
+
+	// If Format is "sql", rows are written to the database of SQLDriver
+	// (e.g. "postgres" or "mysql", imported by the caller) and Output is its
+	// data source name. Rows are inserted SQLBatchSize (500 by default) at
+	// a time, or with COPY for "postgres". If SQLTruncate is set, existing
+	// rows of the table are deleted first.
+	SQLDriver    string
+	SQLBatchSize int
+	SQLTruncate  bool
+
+	// If Format is "proto", each row is written as a message of ProtoMessage
+	// (its full name, e.g. "shop.v1.Order"), preceded by its size as a varint.
+	// ProtoDescriptor is the descriptor set file it's in, written by protoc
+	// --descriptor_set_out with --include_imports. Columns go to fields of
+	// their name, or the one ProtoFields maps them to ("addr.city" for
+	// fields of RECORDs, which go to message fields).
+	ProtoDescriptor string
+	ProtoMessage    string
+	ProtoFields     map[string]string
+
+	// If Format is "sheets", Output is the ID (or URL) of a Google Sheet
+	// the service account can edit, and rows are written to its SheetTab
+	// ("Sheet1" by default), created if it doesn't exist and emptied first
+	// otherwise. PrintFields adds a header row.
+	SheetTab string
+
+	// Replicas in other locations the query is run against in turn if it
+	// fails, e.g. cross-region DR copies of the datasets it reads.
+	Failover []FailoverConfig
+
+	// If set, {{name}} in Query, Table and Output is replaced with the
+	// variable, see Expand. An empty map gives the date variables only.
+	Vars map[string]string
+}
+
 // Internal job configuration struct
 type jobConf struct {
-	Conf jobMainConf `json:"configuration"`
+	Reference *jobReference `json:"jobReference,omitempty"`
+	Conf      jobMainConf   `json:"configuration"`
+}
+type jobReference struct {
+	Location string `json:"location"`
 }
 type jobMainConf struct {
 	Load jobLoadConf `json:"load"`
 }
 type jobLoadConf struct {
-	Format      string      `json:"sourceFormat"`
-	Schema      Schema      `json:"schema"`
-	Destination Destination `json:"destinationTable"`
+	Format       string            `json:"sourceFormat"`
+	Schema       Schema            `json:"schema"`
+	Destination  Destination       `json:"destinationTable"`
+	Partitioning *TimePartitioning `json:"timePartitioning,omitempty"`
+	Encryption   *encryptionConf   `json:"destinationEncryptionConfiguration,omitempty"`
+}
+type encryptionConf struct {
+	KMSKeyName string `json:"kmsKeyName"`
 }
 
 // Table schema JSON structs
 type Schema struct {
-	Fields []TableField `json:"fields"`
+	Fields []TableField `json:"fields,omitempty"`
 }
 type TableField struct {
 	Name   string       `json:"name"`
 	Type   string       `json:"type"`
 	Mode   string       `json:"mode"`
 	Fields []TableField `json:"fields"`
+	// Value loaded where the field is missing or null, "now()" for the time
+	// the load started. Filled in before upload, see applyDefaults.
+	Default string `json:"default,omitempty"`
 }
 type Destination struct {
 	ProjectID string `json:"projectId"`
 	DatasetID string `json:"datasetId"`
 	TableID   string `json:"tableId"`
 }
+type TimePartitioning struct {
+	Type         string `json:"type"`
+	Field        string `json:"field,omitempty"`
+	ExpirationMs int64  `json:"expirationMs,string,omitempty"`
+}
 
 // Internal field type definition
 type fieldType struct {
 	name  string
 	ftype string
+
+	// Schema of the field, and where its cell is: the index in the row, then
+	// in each RECORD it's nested in.
+	field *bigquery.TableFieldSchema
+	path  []int
 }
 
 // Error message structure from BigQuery
@@ -40,5 +934,779 @@ type ErrorResponse struct {
 	Error ErrorMessage `json:"error"`
 }
 type ErrorMessage struct {
-	Message string `json:"message"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Errors  []ErrorItem `json:"errors"`
+}
+
+// Single error of an error response.
+// Location tells what the error is about, e.g. the invalid schema field.
+type ErrorItem struct {
+	Reason       string `json:"reason"`
+	Domain       string `json:"domain"`
+	Message      string `json:"message"`
+	Location     string `json:"location"`
+	LocationType string `json:"locationType"`
+}
+
+// Error returned when a load upload request is not OK
+type UploadError struct {
+	Status     string
+	StatusCode int
+	Message    string
+	Errors     []ErrorItem
+}
+
+func (e *UploadError) Error() string {
+	var msg = "Did not get OK, got " + e.Status
+	if e.Message != "" {
+		msg += " (" + e.Message + ")"
+	}
+	for _, item := range e.Errors {
+		if item.Message == e.Message && item.Location == "" {
+			continue
+		}
+		msg += " - " + item.Reason + ": " + item.Message
+		if item.Location != "" {
+			msg += " (" + item.Location + ")"
+		}
+	}
+	return msg
+}
+
+// Size and checksums of uploaded data
+type checksum struct {
+	size   int64
+	crc32c uint32
+	md5    string
+}
+
+// Object resource returned by GCS
+type gcsObject struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size,string"`
+	CRC32C  string `json:"crc32c"`
+	MD5Hash string `json:"md5Hash"`
+}
+
+// Manifest of a backup made by Client.BackupDataset
+type backupManifest struct {
+	Dataset string        `json:"dataset"`
+	Created time.Time     `json:"created"`
+	Tables  []backupTable `json:"tables"`
+}
+type backupTable struct {
+	Table        string            `json:"table"`
+	Partitioning *TimePartitioning `json:"partitioning,omitempty"`
+}
+
+// Page of GCS objects.list
+type gcsList struct {
+	Items         []gcsObject `json:"items"`
+	NextPageToken string      `json:"nextPageToken"`
+}
+
+// Counts bytes written to it
+type sizeWriter int64
+
+// Computes checksum of data written to it
+type checksumWriter struct {
+	crc  hash.Hash32
+	md5  hash.Hash
+	size int64
+}
+
+// Error returned when the data BigQuery received doesn't match what was sent
+type IntegrityError struct {
+	Source        string
+	Reason        string
+	SentBytes     int64
+	ReceivedBytes int64
+
+	// Checksums of the data sent, set when those GCS reports for an object
+	// uploaded to StagingBucket don't match. Other loads only check the size.
+	CRC32C uint32
+	MD5    string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("Integrity check failed for %s (%s) - sent %d bytes (crc32c %08x, md5 %s), BigQuery read %d bytes",
+		e.Source, e.Reason, e.SentBytes, e.CRC32C, e.MD5, e.ReceivedBytes)
+}
+
+// Write dispositions
+const (
+	WriteEmpty    = "WRITE_EMPTY"
+	WriteAppend   = "WRITE_APPEND"
+	WriteTruncate = "WRITE_TRUNCATE"
+)
+
+// Options for Client.MaterializeQuery
+type MaterializeConfig struct {
+	// Query to run.
+	Query string
+
+	// Table to write results to. ProjectID defaults to the client's project.
+	Destination Destination
+
+	// WriteEmpty (default), WriteAppend or WriteTruncate.
+	WriteDisposition string
+
+	// Partition to write, e.g. "20240101" for a day partitioned table.
+	Partition string
+
+	// Do not use cached query results.
+	NoCache bool
+
+	// Do not create the destination dataset if it doesn't exist.
+	NoCreateDataset bool
+
+	// If set, {{name}} in Query, Destination.TableID and Partition is
+	// replaced with the variable, see Expand.
+	Vars map[string]string
+}
+
+// Replicated datasets in another location
+type FailoverConfig struct {
+	// Location of the replicas, e.g. "europe-west1".
+	Location string
+
+	// Datasets of the query ("dataset" or "project.dataset") mapped to their
+	// replicas, e.g. "sales" to "sales_dr" or "prod.sales" to "dr-project.sales".
+	Datasets map[string]string
+}
+
+// Options for Client.ApplyCDC
+type CDCConfig struct {
+	// Key columns identifying a row of the table.
+	Keys []string
+
+	// Column telling the change, "insert", "update" or "delete" ("op" by
+	// default). It's not written to the table.
+	OpColumn string
+
+	// Column ordering changes of the same row, e.g. a sequence number or
+	// commit timestamp. Required if the data can have more than one change of
+	// a row: rows are not kept in the order of the file, and without it the
+	// MERGE fails on a row with several changes.
+	OrderColumn string
+}
+
+// Options for Client.VerifyLoad
+type VerifyConfig struct {
+	// Columns whose values are compared as well as the number of rows.
+	// Values are compared as text, so this suits STRING and INTEGER columns
+	// but not FLOAT or TIMESTAMP ones.
+	Columns []string
+
+	// Condition selecting the loaded rows if the table has others as well,
+	// e.g. "load_date = '2024-01-01'".
+	Where string
+}
+
+// Result of Client.VerifyLoad
+type Reconciliation struct {
+	SourceRows int64
+	TableRows  int64
+	Columns    []ColumnReconciliation
+
+	// Whether the number of rows and all the columns match.
+	OK bool
+}
+
+// Comparison of a column's values, as the sum of a hash of each non-null value
+type ColumnReconciliation struct {
+	Name       string
+	SourceHash int64
+	TableHash  int64
+	Match      bool
+}
+
+// Result of Client.ValidateLoad
+type ValidationReport struct {
+	// Lines read and rows with problems.
+	Lines   int64
+	Invalid int64
+
+	// Problems found, up to the first 100.
+	Problems []ValidationProblem
+}
+
+// Something wrong with a row of the source
+type ValidationProblem struct {
+	// Line of the source, from 1.
+	Line int64
+
+	// Field the problem is with, e.g. "address.city", "" for the whole row.
+	Field   string
+	Message string
+}
+
+// Options for Client.IncrementalDump
+type IncrementalConfig struct {
+	// Column only ever increasing, e.g. "updated_at" or "id".
+	Column string
+
+	// Local file the highest value dumped so far is kept in.
+	StateFile string
+}
+
+// Metadata file of a dump
+type dumpMetadata struct {
+	Output         string                       `json:"output"`
+	Format         string                       `json:"format"`
+	Query          string                       `json:"query,omitempty"`
+	Table          string                       `json:"table,omitempty"`
+	JobID          string                       `json:"jobId,omitempty"`
+	Schema         []*bigquery.TableFieldSchema `json:"schema"`
+	Rows           uint64                       `json:"rows"`
+	Skipped        uint64                       `json:"skipped,omitempty"`
+	BytesProcessed int64                        `json:"bytesProcessed"`
+	CacheHit       bool                         `json:"cacheHit,omitempty"`
+	Started        time.Time                    `json:"started"`
+	Finished       time.Time                    `json:"finished"`
+}
+
+// Manifest of a dump's output files
+type dumpManifest struct {
+	Output  string         `json:"output"`
+	Format  string         `json:"format"`
+	Rows    uint64         `json:"rows"`
+	Created time.Time      `json:"created"`
+	Files   []manifestFile `json:"files"`
+}
+type manifestFile struct {
+	// Name without the directory, the file is next to the manifest.
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	MD5  string `json:"md5"`
+	Rows uint64 `json:"rows"`
+}
+
+// Resume file of a dump, saved after each page
+type dumpProgress struct {
+	Query     string `json:"query"`
+	JobID     string `json:"jobId"`
+	Location  string `json:"location,omitempty"`
+	PageToken string `json:"pageToken"`
+
+	// Output files created, whether the last one is still being written, and
+	// its rows and bytes so far.
+	Files []string `json:"files"`
+	Open  bool     `json:"open"`
+	Rows  uint64   `json:"rows"`
+	Size  int64    `json:"size"`
+
+	Total    uint64         `json:"total"`
+	Read     uint64         `json:"read"`
+	Skipped  uint64         `json:"skipped,omitempty"`
+	Manifest []manifestFile `json:"manifest,omitempty"`
+	Updated  time.Time      `json:"updated"`
+}
+
+// State file of an incremental dump
+type watermarkState struct {
+	Column    string    `json:"column"`
+	Watermark string    `json:"watermark"`
+	Type      string    `json:"type"`
+	Updated   time.Time `json:"updated"`
+}
+
+// Exact NUMERIC or BIGNUMERIC value, see MapBigRat. Written to json as a
+// number and to other outputs in decimal notation.
+type Decimal struct {
+	big.Rat
+}
+
+// Value of a RANGE column in dumps, written as {"start": ..., "end": ...}
+// to json and as "[start, end)" to other outputs. A nil bound is UNBOUNDED.
+type Range struct {
+	Start *string `json:"start"`
+	End   *string `json:"end"`
+}
+
+// Options for Client.DumpDataset
+type DatasetDumpConfig struct {
+	// Tables dumped at once, 4 by default.
+	Parallelism int
+
+	// Only dump tables matching this (path.Match, e.g. "events_*").
+	Pattern string
+
+	// Dump views, materialized views and external tables with a query.
+	Views bool
+}
+
+// Dump of a table by DumpDataset
+type TableDump struct {
+	// project.dataset.table
+	Table  string
+	Output string
+	Rows   uint64
+	Err    error
+}
+
+// Error returned by DumpDataset when tables failed to dump
+type DatasetDumpError struct {
+	Failed []TableDump
+}
+
+func (e *DatasetDumpError) Error() string {
+	var msg = fmt.Sprintf("%d tables failed to dump", len(e.Failed))
+	for _, t := range e.Failed {
+		msg += "\n" + t.Table + " - " + t.Err.Error()
+	}
+	return msg
+}
+
+// Options for Client.LoadDataset
+type DatasetLoadConfig struct {
+	// Tables loaded at once, 4 by default.
+	Parallelism int
+}
+
+// Load of a table by LoadDataset
+type TableLoad struct {
+	// project.dataset.table
+	Table  string
+	Source string
+	Err    error
+}
+
+// Error returned by LoadDataset when tables failed to load
+type DatasetLoadError struct {
+	Failed []TableLoad
+}
+
+func (e *DatasetLoadError) Error() string {
+	var msg = fmt.Sprintf("%d tables failed to load", len(e.Failed))
+	for _, t := range e.Failed {
+		msg += "\n" + t.Table + " - " + t.Err.Error()
+	}
+	return msg
+}
+
+// Error returned by a load with EnforceRequired when rows miss REQUIRED fields
+type RequiredFieldError struct {
+	// Rows missing fields, and the fields of the first ones.
+	Rows    int64
+	Missing []ValidationProblem
+}
+
+func (e *RequiredFieldError) Error() string {
+	var msg = fmt.Sprintf("%d rows miss required fields", e.Rows)
+	for _, p := range e.Missing {
+		msg += fmt.Sprintf("\nline %d - %s", p.Line, p.Field)
+	}
+	return msg
+}
+
+// Options for Client.LoadDirectory
+type DirectoryConfig struct {
+	// Directory the files are in, not including subdirectories.
+	Dir string
+
+	// Only load files matching this (filepath.Match, e.g. "*.json").
+	Pattern string
+
+	// Local file the files loaded so far are kept in.
+	StateFile string
+}
+
+// State file of LoadDirectory
+type directoryState struct {
+	Files map[string]loadedFile `json:"files"`
+}
+type loadedFile struct {
+	Size   int64     `json:"size"`
+	MD5    string    `json:"md5"`
+	Loaded time.Time `json:"loaded"`
+}
+
+// Error converting a row of dump results
+type RowError struct {
+	// Number of the row in the results, from 1.
+	Row uint64
+
+	// Cells of the row as BigQuery returned them, in json.
+	Raw string
+
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("Error converting row %d - %s", e.Row, e.Err)
+}
+
+// Options for Client.RunScript
+type ScriptConfig struct {
+	// Script to run, statements separated by ";".
+	Script string
+
+	// Run in this session.
+	SessionID string
+
+	// Create a new session for the script.
+	CreateSession bool
+
+	// How values of SELECT results are converted, as DumpConfig.TypeMapping.
+	TypeMapping map[string]string
+}
+
+// Result of Client.RunScript
+type ScriptResult struct {
+	// Job of the whole script.
+	JobID string
+
+	// Session the script ran in, if any.
+	SessionID string
+
+	// Results of each statement, in the order they ran.
+	Statements []StatementResult
+}
+
+// Result of one statement in a script
+type StatementResult struct {
+	JobID          string
+	StatementType  string
+	Text           string
+	AffectedRows   int64
+	BytesProcessed int64
+
+	// Rows returned by a SELECT.
+	Rows []map[string]interface{}
+}
+
+// Routine types
+const (
+	RoutineFunction      = "SCALAR_FUNCTION"
+	RoutineTableFunction = "TABLE_VALUED_FUNCTION"
+	RoutineProcedure     = "PROCEDURE"
+)
+
+// Options of query linting, see Client.LintQuery
+type LintConfig struct {
+	// Tables this large (10 GiB by default) are flagged by LintSelectStar.
+	LargeTableBytes int64
+
+	// Queries processing more bytes are flagged by LintCost, if it's set.
+	MaxBytesProcessed int64
+
+	// Rules whose issues fail the dump. Others are only warnings.
+	Errors []string
+
+	// Called with each warning.
+	Warn func(LintIssue)
+}
+
+// Problem found in a query by linting
+type LintIssue struct {
+	// Rule, e.g. LintSelectStar.
+	Rule string
+	// Table the issue is about, if it's about one (project.dataset.table).
+	Table   string
+	Message string
+}
+
+// Error returned when linting finds issues set to fail a dump
+type LintError struct {
+	Issues []LintIssue
+}
+
+func (e *LintError) Error() string {
+	var msg = "Query failed linting"
+	for i, issue := range e.Issues {
+		if i == 0 {
+			msg += " - "
+		} else {
+			msg += "; "
+		}
+		msg += issue.Rule + ": " + issue.Message
+	}
+	return msg
+}
+
+// Options for Client.Diff
+type DiffConfig struct {
+	// Sides to compare, each a table ("dataset.table" or
+	// "project.dataset.table") or a standard SQL query.
+	Left  string
+	Right string
+
+	// Columns identifying a row ("addr.city" for nested ones).
+	Keys []string
+
+	// File differences are written to, and its format ("json" by default,
+	// or "csv").
+	Output string
+	Format string
+}
+
+// Number of rows of each kind of difference found by Client.Diff
+type DiffReport struct {
+	Added   uint64
+	Removed uint64
+	Changed uint64
+}
+
+// BigQuery connection to an external database. One of CloudSQL and Spanner
+// is set.
+type Connection struct {
+	ConnectionID string
+	// Location defaults to the client's.
+	Location     string
+	FriendlyName string
+	Description  string
+
+	CloudSQL *CloudSQLConnection
+	Spanner  *SpannerConnection
+}
+
+// Cloud SQL database of a connection
+type CloudSQLConnection struct {
+	// "project:region:instance".
+	InstanceID string
+	Database   string
+	// "MYSQL" or "POSTGRES".
+	Type string
+	// Credentials are only sent, never returned.
+	Username string
+	Password string
+}
+
+// Spanner database (projects/.../instances/.../databases/...) of a connection
+type SpannerConnection struct {
+	Database       string
+	UseParallelism bool
+}
+
+// Connection API JSON structs
+type connectionResource struct {
+	Name         string              `json:"name,omitempty"`
+	FriendlyName string              `json:"friendlyName,omitempty"`
+	Description  string              `json:"description,omitempty"`
+	CloudSQL     *cloudSQLProperties `json:"cloudSql,omitempty"`
+	Spanner      *spannerProperties  `json:"cloudSpanner,omitempty"`
+}
+type cloudSQLProperties struct {
+	InstanceID string              `json:"instanceId"`
+	Database   string              `json:"database"`
+	Type       string              `json:"type"`
+	Credential *cloudSQLCredential `json:"credential,omitempty"`
+}
+type cloudSQLCredential struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+type spannerProperties struct {
+	Database       string `json:"database"`
+	UseParallelism bool   `json:"useParallelism,omitempty"`
+}
+type connectionList struct {
+	Connections   []connectionResource `json:"connections"`
+	NextPageToken string               `json:"nextPageToken"`
+}
+
+// UDF or stored procedure
+type Routine struct {
+	// ProjectID defaults to the client's project.
+	ProjectID string
+	DatasetID string
+	RoutineID string
+
+	// RoutineFunction (default), RoutineTableFunction or RoutineProcedure.
+	Type string
+
+	// "SQL" or "JAVASCRIPT".
+	Language string
+
+	// Definition of the routine, e.g. "x * 2" for a SQL function.
+	Body string
+
+	Arguments   []RoutineArgument
+	ReturnType  string
+	Description string
+
+	// GCS paths of libraries for JavaScript functions.
+	Libraries []string
+}
+
+// Argument of a routine. Type is a standard SQL type such as "INT64".
+type RoutineArgument struct {
+	Name string
+	Type string
+}
+
+// Row access policy on a table
+type RowAccessPolicy struct {
+	DatasetID string
+	TableID   string
+	PolicyID  string
+
+	// Standard SQL condition rows have to match, e.g. "region = 'JP'".
+	Filter string
+
+	// Who the policy applies to, e.g. "user:alice@example.com", "group:...".
+	Grantees []string
+}
+
+// Metadata of a table
+type TableMetadata struct {
+	// "TABLE", "VIEW", "EXTERNAL", etc.
+	Type        string
+	Location    string
+	Description string
+
+	NumRows  uint64
+	NumBytes int64
+
+	Created      time.Time
+	LastModified time.Time
+	// Zero if the table doesn't expire.
+	Expires time.Time
+
+	Schema []TableField
+}
+
+// Size of a table, see Client.ListTableSizes
+type TableSize struct {
+	Table        string
+	Rows         int64
+	Bytes        int64
+	LastModified time.Time
+}
+
+// Partition of a table, see Client.ListPartitions
+type Partition struct {
+	// e.g. "20240101", or "__NULL__" and "__UNPARTITIONED__".
+	ID           string
+	Rows         int64
+	Bytes        int64
+	LastModified time.Time
+}
+
+// Profile of a column, see Client.ColumnProfile
+type ColumnStats struct {
+	Name string
+	Type string
+
+	Rows  int64
+	Nulls int64
+	// Approximate number of distinct values.
+	Distinct int64
+
+	// Min and max values as text, "" if all are null.
+	Min string
+	Max string
+}
+
+// Execution plan and statistics of a query job
+type QueryPlan struct {
+	JobID    string
+	Started  time.Time
+	Finished time.Time
+
+	BytesProcessed int64
+	BytesBilled    int64
+	CacheHit       bool
+
+	// Slot milliseconds used, and the average number of slots over the run.
+	SlotMs   int64
+	AvgSlots float64
+
+	// Total of the stages.
+	ShuffleOutputBytes int64
+
+	Stages []QueryStage
+}
+
+// Stage of a query plan
+type QueryStage struct {
+	ID     int64
+	Name   string
+	Status string
+
+	Started  time.Time
+	Finished time.Time
+
+	RecordsRead               int64
+	RecordsWritten            int64
+	ShuffleOutputBytes        int64
+	ShuffleOutputBytesSpilled int64
+	SlotMs                    int64
+
+	// Time the slowest worker spent on each part of the stage, in
+	// milliseconds.
+	WaitMsMax    int64
+	ReadMsMax    int64
+	ComputeMsMax int64
+	WriteMsMax   int64
+
+	// Steps of the stage, e.g. "READ: $1:id, FROM dataset.table".
+	Steps []string
+}
+
+// Error returned when a BigQuery job fails
+type JobError struct {
+	JobID string
+
+	// Error that made the job fail.
+	Result JobErrorItem
+
+	// All errors the job reported. For a load job, these include the
+	// bad records with their location in the source.
+	Errors []JobErrorItem
+
+	// Number of bad records in a load job.
+	BadRecords int64
+}
+
+// Single error of a job.
+// Reason is BigQuery's error reason such as "invalid", "quotaExceeded" or
+// "rateLimitExceeded", Location tells where it happened (e.g. a file or a field).
+type JobErrorItem struct {
+	Reason   string
+	Message  string
+	Location string
+}
+
+func (e *JobError) Error() string {
+	var msg = fmt.Sprintf("Job %s failed - %s: %s", e.JobID, e.Result.Reason, e.Result.Message)
+	if e.Result.Location != "" {
+		msg += " (" + e.Result.Location + ")"
+	}
+	if len(e.Errors) > 1 {
+		msg += fmt.Sprintf(", %d errors returned", len(e.Errors))
+	}
+	if e.BadRecords != 0 {
+		msg += fmt.Sprintf(", %d bad records", e.BadRecords)
+	}
+	return msg
+}
+
+// Check whether the job failed for the reason, e.g. "quotaExceeded".
+func (e *JobError) HasReason(reason string) bool {
+	if e.Result.Reason == reason {
+		return true
+	}
+	for _, item := range e.Errors {
+		if item.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Values of a range of a Google Sheet.
+type sheetsValues struct {
+	Values [][]interface{} `json:"values"`
+}
+
+// Tabs of a Google Sheet.
+type sheetsSpreadsheet struct {
+	Sheets []struct {
+		Properties struct {
+			Title string `json:"title"`
+		} `json:"properties"`
+	} `json:"sheets"`
 }
@@ -0,0 +1,163 @@
+package bqwrapper
+
+import (
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+)
+
+// Handles columns of types dumps don't convert, as set in
+// DumpConfig.UnknownTypeMode, before rows reach the writer.
+type unknownTypeWriter struct {
+	outputWriter
+	mode string
+	conv converters
+
+	// Schema rows are written with, and whether it differs from the one
+	// of the results.
+	fields  []*bigquery.TableFieldSchema
+	changed bool
+}
+
+func (w *unknownTypeWriter) page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+	if w.fields == nil {
+		var err error
+		if w.fields, w.changed, err = w.schema(fields); err != nil {
+			return err
+		}
+		if len(w.fields) == 0 {
+			return errors.New("No columns left after skipping unknown types")
+		}
+	}
+	if w.changed && w.mode == UnknownTypeSkip {
+		for _, row := range rows {
+			row.F = w.cells(fields, row.F)
+		}
+	}
+	return w.outputWriter.page(w.fields, rows)
+}
+
+// Schema with columns of unknown types, also in RECORDs, written as STRING
+// or left out. Returns whether any column was.
+func (w *unknownTypeWriter) schema(fields []*bigquery.TableFieldSchema) ([]*bigquery.TableFieldSchema, bool, error) {
+	var result []*bigquery.TableFieldSchema
+	var changed bool
+	for _, field := range fields {
+		switch {
+		case isRecord(field.Type):
+			sub, ch, err := w.schema(field.Fields)
+			if err != nil {
+				return nil, false, err
+			}
+			if ch {
+				changed = true
+				if len(sub) == 0 {
+					continue
+				}
+				var f = *field
+				f.Fields = sub
+				field = &f
+			}
+		case !w.knownType(field.Type):
+			switch w.mode {
+			case UnknownTypeError:
+				return nil, false, fmt.Errorf("Unsupported field type %s on %s", field.Type, field.Name)
+			case UnknownTypeSkip:
+				changed = true
+				continue
+			}
+			changed = true
+			var f = *field
+			f.Type = "STRING"
+			field = &f
+		}
+		result = append(result, field)
+	}
+	return result, changed, nil
+}
+
+// Cells of the columns kept, with the kept fields of RECORDs.
+func (w *unknownTypeWriter) cells(fields []*bigquery.TableFieldSchema, cells []*bigquery.TableCell) []*bigquery.TableCell {
+	var result = make([]*bigquery.TableCell, 0, len(cells))
+	for i, field := range fields {
+		if i >= len(cells) {
+			break
+		}
+		switch {
+		case isRecord(field.Type):
+			if !w.keepRecord(field) {
+				continue
+			}
+			cells[i].V = w.nested(field, cells[i].V)
+		case !w.knownType(field.Type):
+			continue
+		}
+		result = append(result, cells[i])
+	}
+	return result
+}
+
+// Value of a RECORD column, or of each of a REPEATED one, without the
+// fields left out.
+func (w *unknownTypeWriter) nested(field *bigquery.TableFieldSchema, v interface{}) interface{} {
+	if field.Mode != "REPEATED" {
+		return w.record(field.Fields, v)
+	}
+	list, _ := v.([]interface{})
+	for _, item := range list {
+		if cell, ok := item.(map[string]interface{}); ok {
+			cell["v"] = w.record(field.Fields, cell["v"])
+		}
+	}
+	return v
+}
+
+// Record value ({"f": [{"v": ...}, ...]}) without the fields left out.
+func (w *unknownTypeWriter) record(fields []*bigquery.TableFieldSchema, v interface{}) interface{} {
+	rec, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	cells, _ := rec["f"].([]interface{})
+	var kept = make([]interface{}, 0, len(cells))
+	for i, field := range fields {
+		if i >= len(cells) {
+			break
+		}
+		switch {
+		case isRecord(field.Type):
+			if !w.keepRecord(field) {
+				continue
+			}
+			if cell, ok := cells[i].(map[string]interface{}); ok {
+				cell["v"] = w.nested(field, cell["v"])
+			}
+		case !w.knownType(field.Type):
+			continue
+		}
+		kept = append(kept, cells[i])
+	}
+	rec["f"] = kept
+	return rec
+}
+
+// Whether a RECORD has fields left, it's left out otherwise.
+func (w *unknownTypeWriter) keepRecord(field *bigquery.TableFieldSchema) bool {
+	for _, sub := range field.Fields {
+		if w.knownType(sub.Type) || isRecord(sub.Type) && w.keepRecord(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether dumps convert values of the type, see convertCell, or the dump has
+// a converter for it. RECORDs are made of fields of their own types.
+func (w *unknownTypeWriter) knownType(ftype string) bool {
+	switch ftype {
+	case "STRING", "DATE", "DATETIME", "TIME", "INTEGER", "FLOAT", "BOOLEAN", "TIMESTAMP",
+		"NUMERIC", "BIGNUMERIC", "BYTES", "INTERVAL", "RANGE", "JSON":
+		return true
+	}
+	return w.conv.types[ftype] != nil
+}
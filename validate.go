@@ -0,0 +1,310 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Longest row BigQuery loads.
+const maxRowBytes = 100 << 20
+
+// Number of problems a validation report keeps.
+const maxValidationProblems = 100
+
+// Check conf.SourceFile against the schema without loading it: malformed
+// lines, values that don't fit the type of their field, missing REQUIRED
+// fields, fields not in the schema and rows over BigQuery's 100 MB limit.
+// CSV records are also checked for the number of columns, newlines in
+// quoted fields and invalid UTF-8.
+// If conf.ValidateStrict is set, it stops at the first invalid row.
+func (c *Client) ValidateLoad(conf LoadConfig) (*ValidationReport, error) {
+	// Required params check.
+	if conf.SchemaFile == "" || conf.SourceFile == "" {
+		return nil, errors.New("missing params")
+	}
+	if err := expandFields(conf.Vars, &conf.SourceFile); err != nil {
+		return nil, err
+	}
+
+	r, _, err := c.openSource(conf.SourceFile)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return validateSource(conf, conf.SourceFile, r)
+}
+
+// Validate the source of a load before uploading it if conf.Validate is set,
+// returning the source to upload: r rewound, or opened again if it can't be.
+func (c *Client) validateLoad(conf LoadConfig, r io.ReadCloser) (io.ReadCloser, error) {
+	if !conf.Validate {
+		return r, nil
+	}
+	report, err := validateSource(conf, conf.SourceFile, r)
+	if err == nil && len(report.Problems) != 0 {
+		var p = report.Problems[0]
+		if p.Field != "" {
+			p.Message = p.Field + " " + p.Message
+		}
+		err = fmt.Errorf("Source has %d invalid rows, first at line %d - %s", report.Invalid, p.Line, p.Message)
+	}
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	if s, ok := r.(io.Seeker); ok {
+		if _, err = s.Seek(0, io.SeekStart); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("Error reading source - %s", err)
+		}
+		return r, nil
+	}
+	r.Close()
+	r, _, err = c.openSource(conf.SourceFile)
+	return r, err
+}
+
+// Read the source and check each row against the schema.
+func validateSource(conf LoadConfig, source string, r io.Reader) (*ValidationReport, error) {
+	fields, err := readSchema(conf.SchemaFile)
+	if err != nil {
+		return nil, err
+	}
+	var report = &ValidationReport{}
+	switch loadFormat(conf, source) {
+	case "CSV":
+		return report, validateCSV(conf, fields, r, report)
+	case "NEWLINE_DELIMITED_JSON":
+	default:
+		return nil, errors.New("Unsupported source file format")
+	}
+
+	var br = bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) != 0 {
+			report.Lines++
+			report.add(validateJSONLine(fields, report.Lines, line))
+		} else if len(line) != 0 {
+			report.Lines++
+		}
+		if err == io.EOF || conf.ValidateStrict && report.Invalid != 0 {
+			return report, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading source - %s", err)
+		}
+	}
+}
+
+// Read csv records and check each against the schema, in the same order.
+func validateCSV(conf LoadConfig, fields []TableField, r io.Reader, report *ValidationReport) error {
+	var cr = csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			report.Lines = int64(perr.Line)
+			report.add([]ValidationProblem{{Line: int64(perr.StartLine), Message: "malformed csv - " + perr.Err.Error()}})
+		} else if err != nil {
+			return fmt.Errorf("Error reading source - %s", err)
+		} else {
+			line, _ := cr.FieldPos(0)
+			report.Lines = int64(line)
+			report.add(validateCSVRecord(fields, int64(line), record))
+		}
+		if conf.ValidateStrict && report.Invalid != 0 {
+			return nil
+		}
+	}
+}
+
+// Problems of a csv record.
+func validateCSVRecord(fields []TableField, line int64, record []string) []ValidationProblem {
+	var problems []ValidationProblem
+	if len(record) != len(fields) {
+		problems = append(problems, ValidationProblem{Line: line,
+			Message: fmt.Sprintf("%d columns, the schema has %d", len(record), len(fields))})
+	}
+
+	var size int
+	for i, val := range record {
+		size += len(val)
+		if i >= len(fields) {
+			continue
+		}
+		var field = fields[i]
+		var msg string
+		switch {
+		case !utf8.ValidString(val):
+			msg = "not valid UTF-8"
+		case strings.ContainsAny(val, "\r\n"):
+			msg = "newline in quoted field"
+		case val == "":
+			// Loaded as NULL.
+			if field.Mode == "REQUIRED" && field.Default == "" {
+				msg = "missing required field"
+			}
+		default:
+			msg = checkValue(field.Type, val)
+		}
+		if msg != "" {
+			problems = append(problems, ValidationProblem{Line: line, Field: field.Name, Message: msg})
+		}
+	}
+	if size > maxRowBytes {
+		problems = append(problems, ValidationProblem{Line: line, Message: "row is longer than 100 MB"})
+	}
+	return problems
+}
+
+// Count an invalid row, keeping its problems up to maxValidationProblems.
+func (r *ValidationReport) add(problems []ValidationProblem) {
+	if len(problems) == 0 {
+		return
+	}
+	r.Invalid++
+	for _, p := range problems {
+		if len(r.Problems) == maxValidationProblems {
+			return
+		}
+		r.Problems = append(r.Problems, p)
+	}
+}
+
+// Problems of a line of newline delimited json.
+func validateJSONLine(fields []TableField, line int64, by []byte) []ValidationProblem {
+	if len(by) > maxRowBytes {
+		return []ValidationProblem{{Line: line, Message: "row is longer than 100 MB"}}
+	}
+	var row map[string]interface{}
+	var dec = json.NewDecoder(bytes.NewReader(by))
+	dec.UseNumber()
+	if err := dec.Decode(&row); err != nil {
+		return []ValidationProblem{{Line: line, Message: "malformed json - " + err.Error()}}
+	}
+
+	var problems = validateRecord(fields, "", row)
+	for i := range problems {
+		problems[i].Line = line
+	}
+	return problems
+}
+
+// Problems of a record, fields named with their parents as prefix.
+func validateRecord(fields []TableField, prefix string, row map[string]interface{}) []ValidationProblem {
+	var problems []ValidationProblem
+	var known = make(map[string]bool, len(fields))
+	for _, field := range fields {
+		known[field.Name] = true
+		var name = prefix + field.Name
+		var val, ok = row[field.Name]
+		if !ok || val == nil {
+			if field.Mode == "REQUIRED" && field.Default == "" {
+				problems = append(problems, ValidationProblem{Field: name, Message: "missing required field"})
+			}
+			continue
+		}
+		if field.Mode != "REPEATED" {
+			problems = append(problems, validateValue(field, name, val)...)
+			continue
+		}
+		list, ok := val.([]interface{})
+		if !ok {
+			problems = append(problems, ValidationProblem{Field: name, Message: "not an array"})
+			continue
+		}
+		for i, v := range list {
+			problems = append(problems, validateValue(field, name+"["+strconv.Itoa(i)+"]", v)...)
+		}
+	}
+	var unknown []string
+	for name := range row {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		problems = append(problems, ValidationProblem{Field: prefix + name, Message: "not in the schema"})
+	}
+	return problems
+}
+
+// Problems of a single value of the field.
+func validateValue(field TableField, name string, val interface{}) []ValidationProblem {
+	if field.Type == "RECORD" || field.Type == "STRUCT" {
+		row, ok := val.(map[string]interface{})
+		if !ok {
+			return []ValidationProblem{{Field: name, Message: "not an object"}}
+		}
+		return validateRecord(field.Fields, name+".", row)
+	}
+	if err := checkValue(field.Type, val); err != "" {
+		return []ValidationProblem{{Field: name, Message: err}}
+	}
+	return nil
+}
+
+// Why a json value can't be loaded as the type, "" if it can. Numbers and
+// booleans may be quoted, as BigQuery accepts them either way.
+func checkValue(ftype string, val interface{}) string {
+	var s string
+	switch v := val.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = string(v)
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		if ftype == "JSON" {
+			return ""
+		}
+		return "not a " + strings.ToLower(ftype) + " value"
+	}
+
+	var err error
+	switch ftype {
+	case "INTEGER", "INT64":
+		_, err = strconv.ParseInt(s, 10, 64)
+	case "FLOAT", "FLOAT64":
+		_, err = strconv.ParseFloat(s, 64)
+	case "NUMERIC", "BIGNUMERIC":
+		// Not through a float, which takes NaN and Inf.
+		if _, ok := parseDecimal(s); !ok {
+			err = strconv.ErrSyntax
+		}
+	case "BOOLEAN", "BOOL":
+		_, err = strconv.ParseBool(s)
+	case "BYTES":
+		_, err = base64.StdEncoding.DecodeString(s)
+	case "DATE":
+		_, err = time.Parse("2006-01-02", s)
+	case "TIMESTAMP", "DATETIME", "TIME":
+		if _, ok := val.(bool); ok {
+			return "not a " + strings.ToLower(ftype) + " value"
+		}
+	}
+	if err != nil {
+		return "invalid " + strings.ToLower(ftype) + " value " + strconv.Quote(s)
+	}
+	return ""
+}
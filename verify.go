@@ -0,0 +1,193 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Compare conf.SourceFile with what's in the table after loading it: the
+// number of rows, and a hash of the values of each of v.Columns. A load
+// that silently lost or changed rows doesn't match.
+//
+// The source is read again, so it can't be stdin.
+func (c *Client) VerifyLoad(conf LoadConfig, v VerifyConfig) (*Reconciliation, error) {
+	c.Defaults.load(&conf)
+
+	// Required params check.
+	if conf.DatasetID == "" || conf.TableID == "" || conf.SchemaFile == "" || conf.SourceFile == "" {
+		return nil, errors.New("missing params")
+	}
+	if err := expandFields(conf.Vars, &conf.TableID, &conf.SourceFile); err != nil {
+		return nil, err
+	}
+
+	var result = &Reconciliation{Columns: make([]ColumnReconciliation, len(v.Columns))}
+	for i, col := range v.Columns {
+		result.Columns[i].Name = col
+	}
+	if err := c.sourceSums(conf, result); err != nil {
+		return nil, err
+	}
+	if err := c.tableSums(conf, v.Where, result); err != nil {
+		return nil, err
+	}
+
+	result.OK = result.SourceRows == result.TableRows
+	for i := range result.Columns {
+		var col = &result.Columns[i]
+		col.Match = col.SourceHash == col.TableHash
+		result.OK = result.OK && col.Match
+	}
+	return result, nil
+}
+
+// Count rows of the source and sum hashes of the columns.
+func (c *Client) sourceSums(conf LoadConfig, result *Reconciliation) error {
+	fields, err := readSchema(conf.SchemaFile)
+	if err != nil {
+		return err
+	}
+	var index = make([]int, len(result.Columns))
+	for i, col := range result.Columns {
+		index[i] = -1
+		for j, f := range fields {
+			if f.Name == col.Name {
+				index[i] = j
+			}
+		}
+		if index[i] < 0 {
+			return fmt.Errorf("Column %s is not in the schema", col.Name)
+		}
+	}
+
+	var format = loadFormat(conf, conf.SourceFile)
+	if format == "" {
+		return errors.New("Unsupported source file format")
+	}
+	r, _, err := c.openSource(conf.SourceFile)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// CSV columns are in the order of the schema.
+	if format == "CSV" {
+		var cr = csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		for {
+			record, err := cr.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("Error reading source - %s", err)
+			}
+			result.SourceRows++
+			for i, j := range index {
+				// Empty fields are loaded as NULL.
+				if j < len(record) && record[j] != "" {
+					result.Columns[i].SourceHash += valueHash(record[j])
+				}
+			}
+		}
+	}
+
+	var br = bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) != 0 {
+			result.SourceRows++
+			if len(index) != 0 {
+				var row map[string]interface{}
+				var dec = json.NewDecoder(bytes.NewReader(line))
+				dec.UseNumber()
+				if err := dec.Decode(&row); err != nil {
+					return fmt.Errorf("Error reading source row %d - %s", result.SourceRows, err)
+				}
+				for i := range index {
+					var col = &result.Columns[i]
+					switch val := row[col.Name].(type) {
+					case nil:
+					case string:
+						col.SourceHash += valueHash(val)
+					case json.Number:
+						col.SourceHash += valueHash(string(val))
+					case bool:
+						col.SourceHash += valueHash(strconv.FormatBool(val))
+					default:
+						return fmt.Errorf("Column %s is not a single value", col.Name)
+					}
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error reading source - %s", err)
+		}
+	}
+}
+
+// Count rows of the table and sum hashes of the columns the same way.
+func (c *Client) tableSums(conf LoadConfig, where string, result *Reconciliation) error {
+	var exprs = []string{"COUNT(*)"}
+	for _, col := range result.Columns {
+		exprs = append(exprs, "COALESCE(SUM(CAST(CONCAT('0x', SUBSTR(TO_HEX(MD5(CAST(`"+col.Name+
+			"` AS STRING))), 1, 8)) AS INT64)), 0)")
+	}
+	var query = "SELECT " + strings.Join(exprs, ", ") + " FROM " + tableName(c.ProjectID, conf.DatasetID, conf.TableID)
+	if where != "" {
+		query += " WHERE " + where
+	}
+
+	var req = &bigquery.QueryRequest{
+		Kind:         "bigquery#queryRequest",
+		Query:        query,
+		Location:     c.Location,
+		UseLegacySql: new(bool),
+	}
+	var values []int64
+	_, err := c.runQuery(context.Background(), req, 0, func(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+		for _, row := range rows {
+			for _, cell := range row.F {
+				s, _ := cell.V.(string)
+				n, err := strconv.ParseInt(s, 10, 64)
+				if err != nil {
+					return fmt.Errorf("Invalid result %v - %s", cell.V, err)
+				}
+				values = append(values, n)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(values) != len(exprs) {
+		return errors.New("unexpected query result")
+	}
+
+	result.TableRows = values[0]
+	for i := range result.Columns {
+		result.Columns[i].TableHash = values[i+1]
+	}
+	return nil
+}
+
+// Hash of a value as text, the first 4 bytes of its MD5.
+func valueHash(s string) int64 {
+	var sum = md5.Sum([]byte(s))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
@@ -0,0 +1,630 @@
+package bqwrapper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"google.golang.org/api/bigquery/v2"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ends cells cut short by MaxCellBytes.
+const truncatedMarker = "...[truncated]"
+
+// Returned for a row over the size limits that is skipped.
+var errSkipRow = errors.New("row skipped")
+
+// Byte order mark put at the start of csv files with DumpConfig.BOM.
+const utf8BOM = "\xef\xbb\xbf"
+
+// Called with each page of rows and their schema as results are read.
+type pageFunc func(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error
+
+// Where dump output goes.
+type outputWriter interface {
+	// Write out a page of rows.
+	page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error
+	// Finish the output once all rows are written.
+	close() error
+	// Give up on the output.
+	abort()
+	// Number of rows written.
+	count() uint64
+	// Number of bad rows skipped.
+	skippedRows() uint64
+}
+
+// Tells where in the results a row failing conversion is, and skips it if
+// SkipBadRows is set. Embedded in each outputWriter.
+type rowTracker struct {
+	skip bool
+
+	// Rows of pages done so far, and rows skipped.
+	read    uint64
+	skipped uint64
+}
+
+// Error for the i'th row of the page failing with err, or nil if it's to be
+// skipped.
+func (t *rowTracker) badRow(row *bigquery.TableRow, i int, err error) error {
+	if t.skip {
+		t.skipped++
+		return nil
+	}
+	var rerr = &RowError{Row: t.read + uint64(i) + 1, Err: err}
+	if by, jerr := json.Marshal(row.F); jerr == nil {
+		rerr.Raw = string(by)
+	}
+	return rerr
+}
+
+// Count rows of a page once it's done.
+func (t *rowTracker) pageDone(n int) {
+	t.read += uint64(n)
+}
+
+// Number of bad rows skipped.
+func (t *rowTracker) skippedRows() uint64 {
+	return t.skipped
+}
+
+// Writer for the output format of conf.
+func (c *Client) newOutput(conf DumpConfig) outputWriter {
+	var w outputWriter
+	switch conf.Format {
+	case "sqlite", "sql":
+		w = newSQLWriter(conf)
+	case "arrow":
+		w = newArrowWriter(c, conf)
+	case "proto":
+		w = newProtoWriter(c, conf)
+	case "sheets":
+		w = newSheetsWriter(c, conf)
+	default:
+		w = newDumpWriter(c, conf)
+	}
+	// Metadata records the schema as it's written, after renaming and
+	// masking.
+	if conf.Metadata {
+		w = &metadataWriter{outputWriter: w}
+	}
+	if len(conf.Rename) != 0 {
+		w = &renameWriter{outputWriter: w, rename: conf.Rename}
+	}
+	if len(conf.Mask) != 0 {
+		w = &maskWriter{outputWriter: w, mask: conf.Mask, salt: conf.MaskSalt}
+	}
+	if conf.UnknownTypeMode != "" {
+		w = &unknownTypeWriter{outputWriter: w, mode: conf.UnknownTypeMode, conv: dumpConverters(conf)}
+	}
+	return w
+}
+
+// The writer w wraps, nil if it doesn't wrap one.
+func wrappedOutput(w outputWriter) outputWriter {
+	switch v := w.(type) {
+	case *renameWriter:
+		return v.outputWriter
+	case *maskWriter:
+		return v.outputWriter
+	case *metadataWriter:
+		return v.outputWriter
+	case *unknownTypeWriter:
+		return v.outputWriter
+	}
+	return nil
+}
+
+// Renames columns as set in DumpConfig.Rename before rows reach the writer.
+type renameWriter struct {
+	outputWriter
+	rename map[string]string
+
+	// Schema with the columns renamed.
+	fields []*bigquery.TableFieldSchema
+}
+
+func (w *renameWriter) page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+	if w.fields == nil {
+		var names = make(map[string]bool, len(fields))
+		for _, field := range fields {
+			names[field.Name] = true
+		}
+		for from := range w.rename {
+			if !names[from] {
+				return fmt.Errorf("No such column %s to rename", from)
+			}
+		}
+
+		var renamed = make(map[string]bool, len(fields))
+		for _, field := range fields {
+			if to, ok := w.rename[field.Name]; ok {
+				var f = *field
+				f.Name = to
+				field = &f
+			}
+			if renamed[field.Name] {
+				return fmt.Errorf("Duplicate column %s after renaming", field.Name)
+			}
+			renamed[field.Name] = true
+			w.fields = append(w.fields, field)
+		}
+	}
+	return w.outputWriter.page(w.fields, rows)
+}
+
+// Writes dump output as pages of rows arrive, so the whole result never has to
+// be kept in memory. If MaxRowsPerFile/MaxBytesPerFile is set, output rotates
+// through output-00001.json, output-00002.json, etc.
+type dumpWriter struct {
+	rowTracker
+	c    *Client
+	conf DumpConfig
+
+	// Csv columns, field names sorted alphabetically so the order is always same,
+	// and the encoded header line.
+	names  []string
+	header []byte
+
+	// Fields in schema order, index of each csv column in them, and the csv
+	// record being built.
+	fields []fieldType
+	index  []int
+	record []string
+	nf     numberFormat
+	tf     timeFormat
+	conv   converters
+
+	// Files created so far and the one being written.
+	files []string
+	out   SinkWriter
+	w     *bufio.Writer
+
+	// With Manifest, checksums of the file being written and files done.
+	sum      *checksumWriter
+	manifest []manifestFile
+
+	// Encoded row, and csv writer writing into it.
+	buf   bytes.Buffer
+	csv   *csv.Writer
+	comma rune
+
+	// Rows and bytes in the current file, and rows in all files.
+	rows  uint64
+	size  int64
+	total uint64
+}
+
+func newDumpWriter(c *Client, conf DumpConfig) *dumpWriter {
+	var w = &dumpWriter{c: c, conf: conf, comma: ',', nf: newNumberFormat(conf), tf: newTimeFormat(conf), conv: dumpConverters(conf)}
+	w.skip = conf.SkipBadRows
+
+	// Set custom delimiter if specified.
+	if conf.Delimiter != "" {
+		// Tab is a special word. If a word "tab" is defined, use tab.
+		if conf.Delimiter == "tab" {
+			w.comma = rune('\t')
+		} else {
+			w.comma = rune(conf.Delimiter[0])
+		}
+	}
+	w.csv = csv.NewWriter(&w.buf)
+	w.csv.Comma = w.comma
+	w.csv.UseCRLF = conf.CRLF
+
+	return w
+}
+
+// Convert a page of rows and write them out.
+func (w *dumpWriter) page(fields []*bigquery.TableFieldSchema, rows []*bigquery.TableRow) error {
+	if w.names == nil {
+		w.fields = resultColumns(fields, w.conf.Flatten)
+		var pos = make(map[string]int, len(w.fields))
+		w.names = make([]string, 0, len(w.fields))
+		for i, col := range w.fields {
+			w.names = append(w.names, col.name)
+			pos[col.name] = i
+		}
+		sort.Strings(w.names)
+		w.index = make([]int, len(w.names))
+		for i, name := range w.names {
+			w.index[i] = pos[name]
+		}
+
+		// If we need to print fields, they go on top of each file.
+		if w.conf.Format == "csv" && w.conf.PrintFields {
+			if err := w.encodeCSV(w.names); err != nil {
+				return err
+			}
+			w.header = append([]byte(nil), w.buf.Bytes()...)
+		}
+	}
+
+	// Csv rows are converted straight into records, without building maps.
+	if w.conf.Format == "csv" {
+		return w.pageCSV(rows)
+	}
+
+	result, err := toRows(fields, rows, w.conf.TypeMapping, w.conv, w.conf.Flatten, &w.rowTracker)
+	if err != nil {
+		return err
+	}
+	formatNumbers(result, w.conf)
+
+	for _, row := range result {
+		if err = w.write(row); err != nil && err != errSkipRow {
+			return err
+		}
+	}
+	if w.conf.ReuseRows {
+		releaseRows(result)
+	}
+	return nil
+}
+
+// Convert a page of rows into csv records and write them out.
+func (w *dumpWriter) pageCSV(rows []*bigquery.TableRow) error {
+	if w.record == nil {
+		w.record = make([]string, len(w.names))
+	}
+
+	var val interface{}
+	var err error
+	var ok, bad bool
+	for n, row := range rows {
+		bad = false
+		for i, idx := range w.index {
+			var v = w.fields[idx].value(row)
+			if val, ok, err = w.tf.format(w.fields[idx], v); !ok {
+				val, err = convertValue(w.fields[idx], v, w.conf.TypeMapping, w.conv)
+			}
+			if err != nil {
+				if err = w.badRow(row, n, err); err != nil {
+					return err
+				}
+				bad = true
+				break
+			}
+			if w.record[i], err = w.limitCell(w.names[i], csvString(w.nf.format(val))); err != nil {
+				if err != errSkipRow {
+					return err
+				}
+				bad = true
+				break
+			}
+		}
+		if bad {
+			continue
+		}
+
+		w.buf.Reset()
+		if err = w.encodeCSV(w.record); err != nil {
+			return err
+		}
+		if err = w.emit(); err != nil && err != errSkipRow {
+			return err
+		}
+	}
+	w.pageDone(len(rows))
+	return nil
+}
+
+// Write a row.
+func (w *dumpWriter) write(row map[string]interface{}) error {
+	for name, val := range row {
+		if s, ok := val.(string); ok {
+			var err error
+			if row[name], err = w.limitCell(name, s); err != nil {
+				return err
+			}
+		}
+	}
+	if err := w.encode(row); err != nil {
+		return err
+	}
+	return w.emit()
+}
+
+// Limit a cell value to MaxCellBytes, cutting it short with a marker, or
+// failing the row as OversizeAction says.
+func (w *dumpWriter) limitCell(name, s string) (string, error) {
+	if w.conf.MaxCellBytes <= 0 || len(s) <= w.conf.MaxCellBytes {
+		return s, nil
+	}
+	if w.conf.OversizeAction == "" || w.conf.OversizeAction == OversizeTruncate {
+		return truncateCell(s, w.conf.MaxCellBytes), nil
+	}
+	return "", w.oversize(fmt.Errorf("%s is %d bytes, over MaxCellBytes", name, len(s)))
+}
+
+// Error for a row over the size limits, errSkipRow if it's to be skipped.
+// Rows are written in order, so the row's number is the number of rows
+// written and skipped so far.
+func (w *dumpWriter) oversize(err error) error {
+	if w.conf.OversizeAction == OversizeSkip {
+		w.skipped++
+		return errSkipRow
+	}
+	return &RowError{Row: w.total + w.skipped + 1, Err: err}
+}
+
+// Cut s down to max bytes, ending with truncatedMarker, without splitting
+// a UTF-8 character.
+func truncateCell(s string, max int) string {
+	var n = max - len(truncatedMarker)
+	if n < 0 {
+		n = max
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	if n+len(truncatedMarker) > max {
+		return s[:n]
+	}
+	return s[:n] + truncatedMarker
+}
+
+// Write the encoded row in buf, rotating to the next file first if
+// the current one is full.
+func (w *dumpWriter) emit() error {
+	if w.conf.MaxRowBytes > 0 && w.buf.Len() > w.conf.MaxRowBytes {
+		return w.oversize(fmt.Errorf("row is %d bytes, over MaxRowBytes", w.buf.Len()))
+	}
+	var sep = w.separator()
+
+	if w.out != nil && w.rows > 0 &&
+		((w.conf.MaxRowsPerFile > 0 && w.rows >= uint64(w.conf.MaxRowsPerFile)) ||
+			(w.conf.MaxBytesPerFile > 0 && w.size+int64(len(sep)+w.buf.Len()) > w.conf.MaxBytesPerFile)) {
+		if err := w.finish(); err != nil {
+			return err
+		}
+	}
+	if w.out == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+		sep = w.separator()
+	}
+
+	w.w.WriteString(sep)
+	if _, err := w.w.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+	w.rows++
+	w.total++
+	w.size += int64(len(sep) + w.buf.Len())
+	return nil
+}
+
+// Encode a row into buf.
+func (w *dumpWriter) encode(row map[string]interface{}) error {
+	w.buf.Reset()
+
+	if w.conf.Format == "json" {
+		var by []byte
+		var err error
+		switch {
+		case w.conf.MarshalRow != nil:
+			by, err = w.conf.MarshalRow(row)
+		case w.conf.Pretty:
+			by, err = json.MarshalIndent(row, "\t", "\t")
+		default:
+			by, err = json.Marshal(row)
+		}
+		if err != nil {
+			return err
+		}
+		w.buf.Write(by)
+		return nil
+	}
+
+	var record = make([]string, len(w.names))
+	var val interface{}
+	var ok bool
+	for i, name := range w.names {
+		if val, ok = row[name]; ok {
+			record[i] = csvString(val)
+		}
+	}
+	return w.encodeCSV(record)
+}
+
+// Csv representation of a converted value.
+func csvString(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return string(v)
+	case json.RawMessage:
+		return string(v)
+	case Range:
+		return v.String()
+	case *Decimal:
+		return v.String()
+	case map[string]interface{}, []interface{}:
+		return scalarValue(v).(string)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// RECORD, REPEATED and JSON values as json, and RANGE and exact NUMERIC
+// values, and others with a String method (e.g. of registered converters),
+// as text, for outputs only taking single values.
+func scalarValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}, []interface{}:
+		by, _ := json.Marshal(val)
+		return string(by)
+	case json.RawMessage:
+		return string(v)
+	case json.Number:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return val
+}
+
+// Encode a csv record into buf, with the configured quoting.
+func (w *dumpWriter) encodeCSV(record []string) error {
+	// Go's csv writer is good enough for the default quoting.
+	if (w.conf.Quote == "" || w.conf.Quote == QuoteMinimal) && w.conf.Escape == "" {
+		w.csv.Write(record)
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+
+	for i, field := range record {
+		if i > 0 {
+			w.buf.WriteRune(w.comma)
+		}
+		w.buf.WriteString(csvField(field, w.comma, w.conf.Quote, w.conf.Escape))
+	}
+	if w.conf.CRLF {
+		w.buf.WriteString("\r\n")
+	} else {
+		w.buf.WriteString("\n")
+	}
+	return nil
+}
+
+// What goes before the next row in the current file.
+func (w *dumpWriter) separator() string {
+	if w.conf.Format != "json" {
+		return ""
+	}
+	switch {
+	case w.conf.Pretty && w.rows == 0:
+		return "\n\t"
+	case w.conf.Pretty:
+		return ",\n\t"
+	case w.rows == 0:
+		return ""
+	}
+	return ","
+}
+
+// Open the next output file and write its header.
+func (w *dumpWriter) open() error {
+	var name = w.conf.Output
+	if w.conf.MaxRowsPerFile > 0 || w.conf.MaxBytesPerFile > 0 {
+		name = splitName(w.conf.Output, len(w.files)+1)
+	}
+
+	out, err := w.c.createOutput(name, w.conf)
+	if err != nil {
+		return err
+	}
+	w.files = append(w.files, name)
+	w.out = out
+	if w.conf.Manifest {
+		w.sum = newChecksumWriter()
+		w.w = bufio.NewWriter(io.MultiWriter(out, w.sum))
+	} else {
+		w.w = bufio.NewWriter(out)
+	}
+	w.rows = 0
+	w.size = 0
+
+	if w.conf.Format == "json" {
+		w.w.WriteString("[")
+		w.size++
+	} else {
+		if w.conf.BOM {
+			w.w.WriteString(utf8BOM)
+			w.size += int64(len(utf8BOM))
+		}
+		w.w.Write(w.header)
+		w.size += int64(len(w.header))
+	}
+	return nil
+}
+
+// Write the footer and close the current file.
+func (w *dumpWriter) finish() error {
+	if w.conf.Format == "json" {
+		switch {
+		case w.conf.Pretty && w.rows > 0:
+			w.w.WriteString("\n]")
+		case w.conf.Pretty:
+			w.w.WriteString("]")
+		default:
+			w.w.WriteString("]\n")
+		}
+	}
+
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	var err = w.out.Commit()
+	w.out = nil
+	if err == nil && w.sum != nil {
+		var sum = w.sum.checksum()
+		var name = w.files[len(w.files)-1]
+		w.manifest = append(w.manifest, manifestFile{
+			Name: name[strings.LastIndex(name, "/")+1:],
+			Size: sum.size,
+			MD5:  sum.md5,
+			Rows: w.rows,
+		})
+	}
+	return err
+}
+
+// Finish the output. A result with no rows still creates an (empty) output file.
+func (w *dumpWriter) close() error {
+	if w.out == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if err := w.finish(); err != nil {
+		w.abort()
+		return err
+	}
+	if w.conf.Manifest {
+		if err := w.writeManifest(); err != nil {
+			w.abort()
+			return err
+		}
+	}
+	return nil
+}
+
+// Number of rows written to all files.
+func (w *dumpWriter) count() uint64 {
+	return w.total
+}
+
+// Give up on the output, removing files written so far.
+// If KeepPartial is set, they are left as they are for debugging. The file
+// being written is then left under its temporary name.
+func (w *dumpWriter) abort() {
+	var files = w.files
+	if w.out != nil {
+		w.w.Flush()
+		w.out.Abort()
+		w.out = nil
+		files = files[:len(files)-1]
+	}
+	if w.conf.KeepPartial {
+		return
+	}
+	for _, name := range files {
+		w.c.removeOutput(name)
+	}
+}
@@ -0,0 +1,39 @@
+package bqwrapper
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func BenchmarkDumpCSV(b *testing.B) {
+	benchmarkDump(b, DumpConfig{Format: "csv", PrintFields: true})
+}
+
+func BenchmarkDumpJSON(b *testing.B) {
+	benchmarkDump(b, DumpConfig{Format: "json"})
+}
+
+func BenchmarkDumpJSONPretty(b *testing.B) {
+	benchmarkDump(b, DumpConfig{Format: "json", Pretty: true, ReuseRows: true})
+}
+
+// Write pages of 1000 rows to a file in the format of conf.
+func benchmarkDump(b *testing.B, conf DumpConfig) {
+	conf.Output = filepath.Join(b.TempDir(), "out")
+	if err := checkDumpConfig(&conf); err != nil {
+		b.Fatal(err)
+	}
+	var fields, rows = testSchema(), testRows(0, 1000)
+	var w = newDumpWriter(&Client{}, conf)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := w.page(fields, rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if err := w.close(); err != nil {
+		b.Fatal(err)
+	}
+}